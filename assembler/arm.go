@@ -0,0 +1,424 @@
+package assembler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/arch/arm/armasm"
+)
+
+// thumbNop is the encoding of the Thumb nop (mov r8, r8), which is available on every Thumb architecture and is
+// used to pad Thumb code out to a full WORD
+const thumbNop = 0x46c0
+
+func init() {
+	RegisterBackend(armBackend{})
+}
+
+// armBackend is the ArchBackend for arm
+type armBackend struct{}
+
+func (armBackend) Arch() string {
+	return "arm"
+}
+
+func (armBackend) MinGoVersion() int {
+	return 0
+}
+
+func (armBackend) GNUTargets() []string {
+	return []string{"arm"}
+}
+
+func (armBackend) ByteOrder() binary.ByteOrder {
+	return binary.LittleEndian
+}
+
+// ObjdumpShowsValues returns true, as objdump shows ARM instructions as 32-bit values and Thumb instructions as
+// halfword values
+func (armBackend) ObjdumpShowsValues() bool {
+	return true
+}
+
+// Directives returns only WORD = 4 bytes, as the Go assembler has no smaller directive for arm - ARM instructions are
+// always 4 bytes, and Thumb instructions and data which doesn't fill whole WORD's are packed into WORD's by
+// WriteInstructions
+func (armBackend) Directives() []Directive {
+	return []Directive{{"WORD", 4}}
+}
+
+func (armBackend) Translate(instr MachineInstruction, w io.Writer) error {
+	return instr.writeARMSupported(w)
+}
+
+// IsPadding returns whether the instruction is the ARM nop, or the mov r0, r0 used for it before ARMv6K
+func (armBackend) IsPadding(instr MachineInstruction) bool {
+	if instr.Thumb || len(instr.Bytes) != 4 {
+		return false
+	}
+	enc := binary.BigEndian.Uint32(instr.Bytes)
+	return enc == 0xe320f000 || enc == 0xe1a00000
+}
+
+// PCAlign returns false, as the Go assembler doesn't have PCALIGN for arm
+func (armBackend) PCAlign() (PCAlignment, bool) {
+	return PCAlignment{}, false
+}
+
+func (armBackend) TranslationNeedsVerification() bool {
+	return false
+}
+
+func (armBackend) branch(instr MachineInstruction, symname func(uint64) (string, uint64)) (pcRelative, uint64, string) {
+	return instr.armBranch(symname)
+}
+
+func (armBackend) call(instr MachineInstruction) (directCall, bool) {
+	if instr.Thumb || len(instr.Bytes) != 4 {
+		return directCall{}, false
+	}
+	goInstr, err := armasm.Decode(instr.littleEndianBytes("arm"), armasm.ModeARM)
+	if err != nil {
+		return directCall{}, false
+	}
+	rel, ok := goInstr.Args[0].(armasm.PCRel)
+	// the conditional forms come before the unconditional one (i.e. B_EQ to B)
+	isB, isBL := goInstr.Op >= armasm.B_EQ && goInstr.Op <= armasm.B, goInstr.Op >= armasm.BL_EQ && goInstr.Op <= armasm.BL
+	if !ok || !isB && !isBL {
+		return directCall{}, false
+	}
+	return directCall{
+		call:        isBL,
+		conditional: goInstr.Op != armasm.B && goInstr.Op != armasm.BL,
+		// reading the PC in ARM state gives the address of the instruction + 8
+		target: instr.Address + 8 + uint64(int64(rel)),
+	}, true
+}
+
+// writesFunction returns whether any of the instructions are Thumb instructions, which have to be packed into
+// WORD's and switched to, or data which doesn't fill whole WORD's, see writeARMPackedInstructions
+func (armBackend) writesFunction(instrs []MachineInstruction) bool {
+	for _, instr := range instrs {
+		if instr.Thumb || instr.Data && len(instr.Bytes)%4 != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (armBackend) writeFunction(w io.Writer, instrs []MachineInstruction, tryTranslate bool) error {
+	return writeARMPackedInstructions(w, instrs, tryTranslate)
+}
+
+// summaryClass splits up the ARM instructions by instruction set extension (i.e. VFP and NEON), and counts the
+// Thumb instructions separately
+func (armBackend) summaryClass(instr MachineInstruction, class string) string {
+	if instr.Thumb {
+		return "Thumb " + class
+	}
+	return instr.armExtension() + " " + class
+}
+
+// nativeABI is the AAPCS calling convention with hardware floating point, the Go assembler saves the link register
+// itself, and R10 is the g register of Go
+func (armBackend) nativeABI() nativeABI {
+	return nativeABI{
+		word:       4,
+		mov:        "MOVW",
+		sp:         "R13",
+		argBase:    4,
+		args:       []string{"R0", "R1", "R2", "R3"},
+		result:     "R0",
+		saved:      []string{"R4", "R5", "R6", "R7", "R8", "R9", "R11"},
+		savedFloat: []string{"F8", "F9", "F10", "F11", "F12", "F13", "F14", "F15"},
+		movFloat:   "MOVD",
+		g:          []string{"r10", "sl"},
+	}
+}
+
+// IsMappingSymbol returns whether the symbol is one of the ELF mapping symbols, which mark the start of ARM code ($a),
+// Thumb code ($t), A64 or RISC-V code ($x) or data ($d) in a section rather than being a function or an object
+// themselves
+// Any of them can have a suffix after a ".", i.e. "$d.1", and on RISC-V $x can also be followed by the ISA string of
+// the code, i.e. "$xrv64i2p1_m2p0"
+func (s Symbol) IsMappingSymbol() bool {
+	for _, name := range []string{"$a", "$t", "$x", "$d"} {
+		if s.Name == name || strings.HasPrefix(s.Name, name+".") {
+			return true
+		}
+	}
+	return strings.HasPrefix(s.Name, "$xrv")
+}
+
+// ApplyMappingSymbols sets whether each of the instructions in section is a Thumb instruction or data inside of the
+// code (i.e. a literal pool) according to the mapping symbols, as these can only be told apart this way
+// The mapping symbols are used for ARM, ARM64 and RISCV64 objects, the latter two only having $x and $d
+func ApplyMappingSymbols(instrs []MachineInstruction, section string, mappingSyms []Symbol) {
+	// Only the mapping symbols for this section are relevant, and they are looked up by address
+	var sectionSyms []Symbol
+	for _, sym := range mappingSyms {
+		if sym.Section == section && sym.IsMappingSymbol() {
+			sectionSyms = append(sectionSyms, sym)
+		}
+	}
+	sort.SliceStable(sectionSyms, func(i, j int) bool {
+		return sectionSyms[i].ValueAddressField < sectionSyms[j].ValueAddressField
+	})
+
+	for i := range instrs {
+		// the mapping symbol in effect is the last one at or before the instruction
+		mapping := ""
+		for _, sym := range sectionSyms {
+			if sym.ValueAddressField > instrs[i].Address {
+				break
+			}
+			mapping = sym.Name
+		}
+		instrs[i].Thumb = strings.HasPrefix(mapping, "$t")
+		instrs[i].Data = strings.HasPrefix(mapping, "$d")
+	}
+}
+
+// thumbParcels returns the 16-bit parcels that make up the Thumb instruction, in the order they appear in memory
+// objdump shows 32-bit Thumb instructions as 2 halfword values in memory order, i.e. "f8d0 3004", so the parcels are
+// decoded from the bytes as is
+func (instr MachineInstruction) thumbParcels() ([]uint16, error) {
+	if len(instr.Bytes)%2 != 0 {
+		return nil, fmt.Errorf("Thumb instruction \"%s\" at %#x isn't made of halfwords", instr.Command, instr.Address)
+	}
+	parcels := make([]uint16, 0, len(instr.Bytes)/2)
+	for i := 0; i < len(instr.Bytes); i += 2 {
+		parcels = append(parcels, binary.BigEndian.Uint16(instr.Bytes[i:]))
+	}
+	return parcels, nil
+}
+
+// writeARMPackedInstructions writes out the instructions of an arm function which contains Thumb code, or data which
+// doesn't fill whole WORD's
+// Go only runs in ARM state, and the Go assembler only knows ARM instructions (armasm can't decode Thumb
+// instructions either), so Thumb instructions are always written out as data - packed into WORD's, as 16-bit
+// Thumb instructions are only 2 bytes long, along with the data in between them (i.e. a literal pool)
+// A function that starts with Thumb code gets an entry veneer which switches to Thumb state, and if it's last
+// instruction is Thumb code (even if there is a literal pool after it), an exit veneer switches back to ARM state for
+// the RET which follows the function. Switching between the 2 inside the function is left to the native code (i.e.
+// with bx), as it would be without Go
+func writeARMPackedInstructions(w io.Writer, instrs []MachineInstruction, tryTranslate bool) error {
+	if len(instrs) > 0 && instrs[0].Thumb {
+		writeThumbEntryVeneer(w)
+	}
+
+	h := halfwordWriter{w: w}
+	endsInThumb := false
+	// the byte of data which doesn't fill a halfword yet, if any
+	var pending []byte
+	for i, instr := range instrs {
+		switch {
+		case instr.Data:
+			data := append(pending, instr.MemoryBytes("arm")...)
+			if len(data)%2 != 0 && i == len(instrs)-1 {
+				// the function ends with the data, so it can be padded out
+				data = append(data, 0)
+			}
+			pending = nil
+			if len(data)%2 != 0 {
+				pending = []byte{data[len(data)-1]}
+				data = data[:len(data)-1]
+			}
+			parcels := make([]uint16, 0, len(data)/2)
+			for j := 0; j < len(data); j += 2 {
+				parcels = append(parcels, binary.LittleEndian.Uint16(data[j:]))
+			}
+			h.write(instr, parcels)
+			continue
+		case len(pending) != 0:
+			return fmt.Errorf("instruction \"%s\" at %#x follows data which doesn't fill a halfword, which can't be packed into WORD's",
+				strings.TrimSpace(instr.InstructionString), instr.Address)
+		case instr.Thumb:
+			parcels, err := instr.thumbParcels()
+			if err != nil {
+				return err
+			}
+			h.write(instr, parcels)
+		default:
+			if !h.aligned() {
+				return fmt.Errorf("ARM instruction \"%s\" at %#x doesn't start on a 4 byte boundary after Thumb code or data",
+					strings.TrimSpace(instr.InstructionString), instr.Address)
+			}
+			if err := instr.WriteOutput("arm", w, tryTranslate); err != nil {
+				return err
+			}
+		}
+		endsInThumb = instr.Thumb
+	}
+
+	if endsInThumb {
+		h.pad(thumbNop, "nop")
+		writeThumbExitVeneer(w)
+	} else {
+		// only data can be left over after ARM code, which is never executed
+		h.pad(0, "zeros")
+	}
+
+	return nil
+}
+
+// writeThumbEntryVeneer writes the ARM instructions that switch to Thumb state for the instruction following them
+// In ARM state reading the PC gives the address of the current instruction + 8, which is the instruction after the
+// bx, and setting the lowest bit of the address makes bx switch to Thumb state
+func writeThumbEntryVeneer(w io.Writer) {
+	fmt.Fprintln(w, "    // switch to Thumb state")
+	fmt.Fprintf(w, "    WORD $0xe28fc001; \t// add\tip\tpc\t#1\t\n")
+	fmt.Fprintf(w, "    WORD $0xe12fff1c; \t// bx\tip\t\n")
+}
+
+// writeThumbExitVeneer writes the Thumb instructions that switch back to ARM state for the instruction following them
+// In Thumb state reading the PC gives the address of the current instruction + 4, which is the WORD after the bx as
+// long as the bx is WORD aligned, and the lowest bit of the address being clear makes bx switch to ARM state
+func writeThumbExitVeneer(w io.Writer) {
+	fmt.Fprintln(w, "    // switch back to ARM state")
+	fmt.Fprintf(w, "    WORD $0x%04x4778; \t// bx\tpc\t// nop\t\n", thumbNop)
+}
+
+// armVFPOps are the VFP instructions the Go assembler can express, as named by armasm.GoSyntax without their
+// condition. The comparisons aren't included, as the Go assembler always adds a vmrs after them
+var armVFPOps = stringSet(`
+ADDF ADDD SUBF SUBD MULF MULD NMULF NMULD MULAF MULAD MULSF MULSD NMULAF NMULAD NMULSF NMULSD DIVF DIVD
+NEGF NEGD ABSF ABSD SQRTF SQRTD MOVF MOVD MOVFD MOVDF MOVWF MOVWF.U MOVWD MOVWD.U MOVFW MOVFW.U MOVDW MOVDW.U
+`)
+
+// armOddSingleReg matches an odd numbered single precision register in the output of armasm.GoSyntax, which
+// the Go assembler can't name - it's F registers are the even ones
+var armOddSingleReg = regexp.MustCompile(`\bS\d+\b`)
+
+// writeARMSupported translates an arm instruction into plan9 syntax using armasm
+func (instr MachineInstruction) writeARMSupported(w io.Writer) error {
+	// the arm decoder expects the bytes in little endian, whatever the byte order of the object
+	instrBytes := instr.littleEndianBytes("arm")
+	// to translate this machine instruction into plan9 assembly, first see if it can be decoded
+	goInstr, err := armasm.Decode(instrBytes, armasm.ModeARM)
+	if err != nil {
+		// Then we couldn't decode this instruction and we should
+		// use the WORD method
+		return fmt.Errorf(unrecognizedInstr, instr.Command)
+	}
+
+	if kind, _, _ := instr.armBranch(noSymbols); kind != notPCRelative {
+		// without a label the Go assembler can't encode the PC-relative operand, so it has to stay as it is,
+		// see WriteInstructions for branches that can be written with labels
+		return fmt.Errorf(unrecognizedInstr, instr.Command)
+	}
+
+	goSyntax := armasm.GoSyntax(goInstr, instr.Address, nil, nil)
+	if instr.armExtension() == armVFP && !armVFPSyntaxAccepted(goSyntax) {
+		return fmt.Errorf(unrecognizedInstr, instr.Command)
+	}
+
+	fmt.Fprintf(w, "%s \t", goSyntax)
+	return nil
+}
+
+// armVFPSyntaxAccepted returns whether the Go assembler encodes the VFP instruction from armasm.GoSyntax into the
+// same instruction again
+func armVFPSyntaxAccepted(goSyntax string) bool {
+	fields := strings.SplitN(goSyntax, " ", 2)
+	op := fields[0]
+	// the condition is the last suffix, i.e. "ADDD.EQ", but the unsigned conversions also have a ".U" suffix
+	if i := strings.LastIndex(op, "."); i >= 0 && op[i:] != ".U" {
+		op = op[:i]
+	}
+	if !armVFPOps[op] || len(fields) != 2 {
+		return false
+	}
+
+	// immediates are shown as they are encoded rather than as the floating point value, and moves between single
+	// precision and core registers (MOVW) aren't included above, as the Go assembler uses the D register form
+	return !armOddSingleReg.MatchString(fields[1]) && !strings.Contains(fields[1], "$")
+}
+
+// ARM extensions which instructions can belong to, see armExtension
+const (
+	armCore = "core"
+	armVFP  = "VFP"
+	armNEON = "NEON"
+)
+
+// armExtension returns the extension of the ARM instruction set the instruction belongs to, i.e. whether it is a
+// VFP or an Advanced SIMD (NEON) instruction, as the 2 share the coprocessor 10 and 11 encodings
+func (instr MachineInstruction) armExtension() string {
+	if instr.Thumb || len(instr.Bytes) != 4 {
+		return armCore
+	}
+	enc := binary.BigEndian.Uint32(instr.Bytes)
+	switch {
+	case enc>>25 == 0x79:
+		// Advanced SIMD data processing instructions
+		return armNEON
+	case enc>>24 == 0xf4 && enc&(1<<20) == 0:
+		// Advanced SIMD element and structure loads and stores
+		return armNEON
+	case enc>>28 == 0xf:
+		return armCore
+	case (enc>>25)&0x7 == 0x6 || (enc>>24)&0xf == 0xe:
+		// coprocessor instructions, for coprocessors 10 and 11
+		if (enc>>9)&0x7 != 0x5 {
+			return armCore
+		}
+		if (enc>>24)&0xf == 0xe && enc&(1<<4) != 0 && enc&(1<<8) != 0 && enc&(1<<23) != 0 && enc&(1<<20) == 0 {
+			// vdup from a core register
+			return armNEON
+		}
+		return armVFP
+	}
+	return armCore
+}
+
+// armBranch returns how the ARM instruction depends on it's address, see MachineInstruction.branch
+func (instr MachineInstruction) armBranch(symname func(uint64) (string, uint64)) (pcRelative, uint64, string) {
+	if instr.Thumb || len(instr.Bytes) != 4 {
+		return positionDependent, 0, ""
+	}
+	// the arm decoder expects the bytes in little endian, whatever the byte order of the object
+	instrBytes := instr.littleEndianBytes("arm")
+	goInstr, err := armasm.Decode(instrBytes, armasm.ModeARM)
+	if err != nil {
+		// we don't know what this is, so it has to stay where it is
+		return positionDependent, 0, ""
+	}
+
+	kind := notPCRelative
+	var target uint64
+	for i, arg := range goInstr.Args {
+		switch arg := arg.(type) {
+		case armasm.PCRel:
+			if goInstr.Op < armasm.B_EQ || goInstr.Op > armasm.B {
+				// i.e. BL or BLX, which the Go assembler would treat as a call
+				return positionDependent, 0, ""
+			}
+			// reading the PC in ARM state gives the address of the instruction + 8
+			kind, target = labelBranch, instr.Address+8+uint64(int64(arg))
+		case armasm.Mem:
+			if arg.Base == armasm.PC {
+				// PC-relative loads and stores, i.e. from a literal pool
+				return positionDependent, 0, ""
+			}
+		case armasm.RegShift:
+			if arg.Reg == armasm.PC {
+				return positionDependent, 0, ""
+			}
+		case armasm.Reg:
+			// Only writing to the PC is fine, i.e. "mov pc, lr", which is the first argument of anything but a store
+			if arg == armasm.PC && (i != 0 || strings.HasPrefix(goInstr.Op.String(), "STR")) {
+				return positionDependent, 0, ""
+			}
+		}
+	}
+	if kind == notPCRelative {
+		return notPCRelative, 0, ""
+	}
+
+	return labelBranch, target, armasm.GoSyntax(goInstr, instr.Address, symname, nil)
+}
@@ -0,0 +1,384 @@
+package assembler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/arch/arm64/arm64asm"
+)
+
+func init() {
+	RegisterBackend(arm64Backend{})
+}
+
+// arm64Backend is the ArchBackend for arm64
+type arm64Backend struct{}
+
+func (arm64Backend) Arch() string {
+	return "arm64"
+}
+
+func (arm64Backend) MinGoVersion() int {
+	return 5
+}
+
+func (arm64Backend) GNUTargets() []string {
+	return []string{"aarch64"}
+}
+
+func (arm64Backend) ByteOrder() binary.ByteOrder {
+	return binary.LittleEndian
+}
+
+func (arm64Backend) ObjdumpShowsValues() bool {
+	return true
+}
+
+// Directives returns DWORD = 8 bytes and WORD = 4 bytes, as arm64 doesn't have LONG's (32-bit's are WORD's instead)
+// and the Go assembler has no smaller directive for arm64 - data inside of the code which doesn't fill whole WORD's
+// is packed into WORD's by WriteInstructions
+func (arm64Backend) Directives() []Directive {
+	return []Directive{{"DWORD", 8}, {"WORD", 4}}
+}
+
+// writesFunction returns whether any of the instructions don't fill whole WORD's, see writeWordPackedInstructions
+func (arm64Backend) writesFunction(instrs []MachineInstruction) bool {
+	return !wordsFill(instrs)
+}
+
+func (arm64Backend) writeFunction(w io.Writer, instrs []MachineInstruction, tryTranslate bool) error {
+	return writeWordPackedInstructions("arm64", w, instrs, tryTranslate)
+}
+
+func (arm64Backend) Translate(instr MachineInstruction, w io.Writer) error {
+	return instr.writeARM64Supported(w)
+}
+
+func (arm64Backend) IsPadding(instr MachineInstruction) bool {
+	return len(instr.Bytes) == 4 && binary.BigEndian.Uint32(instr.Bytes) == 0xd503201f
+}
+
+func (arm64Backend) PCAlign() (PCAlignment, bool) {
+	return PCAlignment{GoVersion: 12, Min: 8, Max: 2048}, true
+}
+
+// TranslationNeedsVerification returns true, as arm64asm.GoSyntax doesn't always produce syntax the Go assembler
+// understands, or encodes the same way
+func (arm64Backend) TranslationNeedsVerification() bool {
+	return true
+}
+
+// goVersion returns the Go release known to accept a vector instruction, any other instruction is accepted since
+// the arm64 port
+func (b arm64Backend) goVersion(instr MachineInstruction, goSyntax string) int {
+	op := strings.TrimSuffix(strings.SplitN(goSyntax, " ", 2)[0], ".P")
+	if !arm64VectorOps[op] {
+		return b.MinGoVersion()
+	}
+	if minor, ok := arm64VectorGoVersions[op]; ok {
+		return minor
+	}
+	return LatestGoVersion
+}
+
+func (arm64Backend) branch(instr MachineInstruction, symname func(uint64) (string, uint64)) (pcRelative, uint64, string) {
+	return instr.arm64Branch(symname)
+}
+
+func (arm64Backend) call(instr MachineInstruction) (directCall, bool) {
+	if len(instr.Bytes) != 4 {
+		return directCall{}, false
+	}
+	goInstr, err := arm64asm.Decode(instr.littleEndianBytes("arm64"))
+	if err != nil || (goInstr.Op != arm64asm.BL && goInstr.Op != arm64asm.B) {
+		return directCall{}, false
+	}
+	// B.cond is a B with the condition as it's first argument
+	for _, arg := range goInstr.Args {
+		if rel, ok := arg.(arm64asm.PCRel); ok {
+			_, conditional := goInstr.Args[0].(arm64asm.Cond)
+			return directCall{
+				call:        goInstr.Op == arm64asm.BL,
+				conditional: conditional,
+				target:      instr.Address + uint64(int64(rel)),
+			}, true
+		}
+	}
+	return directCall{}, false
+}
+
+// nativeABI is the AAPCS64 calling convention, the Go assembler saves the frame pointer and the link register itself,
+// and R28 is the g register of Go
+func (arm64Backend) nativeABI() nativeABI {
+	return nativeABI{
+		word:       8,
+		mov:        "MOVD",
+		sp:         "RSP",
+		argBase:    8,
+		args:       []string{"R0", "R1", "R2", "R3", "R4", "R5", "R6", "R7"},
+		result:     "R0",
+		saved:      []string{"R19", "R20", "R21", "R22", "R23", "R24", "R25", "R26", "R27"},
+		savedFloat: []string{"F8", "F9", "F10", "F11", "F12", "F13", "F14", "F15"},
+		movFloat:   "FMOVD",
+		g:          []string{"x28", "w28"},
+	}
+}
+
+// resolveReferences rewrites the ADRP and ADD pairs which put the address of a data symbol into a register into a
+// single MOVD of the address of the Go symbol, which the Go assembler expands into the same pair
+func (arm64Backend) resolveReferences(instrs []MachineInstruction, refs dataReferences) error {
+	for i := range instrs {
+		for _, reloc := range instrs[i].Relocations {
+			name, addend := reloc.target()
+			if !refs.isData(name) || reloc.Type != "R_AARCH64_ADR_PREL_PG_HI21" {
+				continue
+			}
+			if i+1 == len(instrs) || !instrs[i+1].hasRelocation("R_AARCH64_ADD_ABS_LO12_NC", reloc.Symbol) {
+				return instrs[i].referenceError(reloc, "the ADRP isn't followed by an ADD of the low 12 bits of the address")
+			}
+			reg, ok := arm64AddressPair(instrs[i], instrs[i+1])
+			if !ok {
+				return instrs[i].referenceError(reloc, "the ADD following the ADRP doesn't add the low 12 bits to the same register")
+			}
+			ref, ok := refs.reference(name, addend)
+			if !ok {
+				return instrs[i].referenceError(reloc, fmt.Sprintf("%s isn't inside of any data symbol", reloc.Symbol))
+			}
+			instrs[i].SymbolReference = fmt.Sprintf("MOVD $%s, R%d", ref, reg)
+			instrs[i+1].InReference = true
+		}
+	}
+	return nil
+}
+
+// arm64AddressPair returns the number of the register the ADRP and ADD pair puts an address into, or false if the
+// instructions aren't an ADRP and an ADD of that same register into itself
+func arm64AddressPair(adrp, add MachineInstruction) (int, bool) {
+	adrpInst, err := arm64asm.Decode(adrp.littleEndianBytes("arm64"))
+	if err != nil || adrpInst.Op != arm64asm.ADRP {
+		return 0, false
+	}
+	addInst, err := arm64asm.Decode(add.littleEndianBytes("arm64"))
+	if err != nil || addInst.Op != arm64asm.ADD {
+		return 0, false
+	}
+	reg, ok := adrpInst.Args[0].(arm64asm.Reg)
+	if !ok || reg < arm64asm.X0 || reg > arm64asm.X30 {
+		return 0, false
+	}
+	dst, ok := addInst.Args[0].(arm64asm.RegSP)
+	if !ok || arm64asm.Reg(dst) != reg {
+		return 0, false
+	}
+	src, ok := addInst.Args[1].(arm64asm.RegSP)
+	if !ok || arm64asm.Reg(src) != reg {
+		return 0, false
+	}
+	return int(reg - arm64asm.X0), true
+}
+
+// arm64VectorOps are the mnemonics of the ASIMD and crypto instructions the Go assembler knows, any other vector
+// instruction is written out as a WORD
+var arm64VectorOps = stringSet(`
+AESD AESE AESIMC AESMC
+SHA1C SHA1H SHA1M SHA1P SHA1SU0 SHA1SU1 SHA256H SHA256H2 SHA256SU0 SHA256SU1 SHA512H SHA512H2 SHA512SU0 SHA512SU1
+VABS VADD VADDP VADDV VAND VBCAX VBIC VBIF VBIT VBSL VCLS VCLZ VCMEQ VCMGE VCMGT VCMHI VCMHS VCMLE VCMLT VCMTST
+VCNT VDUP VEOR VEOR3 VEXT VFABS VFADD VFADDP VFCMEQ VFCMGE VFCMGT VFCMLE VFCMLT VFCVTL VFCVTL2 VFCVTN VFCVTN2
+VFCVTZS VFCVTZU VFDIV VFMAX VFMAXNM VFMAXNMP VFMAXNMV VFMAXP VFMAXV VFMIN VFMINNM VFMINNMP VFMINNMV VFMINP
+VFMINV VFMLA VFMLS VFMUL VFNEG VFRINTM VFRINTN VFRINTP VFRINTZ VFSQRT VFSUB
+VLD1 VLD1R VLD2 VLD2R VLD3 VLD3R VLD4 VLD4R VMLA VMLS VMOV VMOVI VMUL VNEG VNOT VORN VORR
+VPMULL VPMULL2 VRAX1 VRBIT VREV16 VREV32 VREV64 VSCVTF VSHADD VSHL VSHRN VSHRN2 VSLI VSMAX VSMAXP VSMAXV
+VSMIN VSMINP VSMINV VSMLAL VSMLAL2 VSMLSL VSMLSL2 VSMULL VSMULL2 VSQABS VSQADD VSQNEG VSQSHL VSQSUB VSQXTN
+VSQXTN2 VSQXTUN VSQXTUN2 VSRHADD VSRI VSRSHR VSSHL VSSHLL VSSHLL2 VSSHR VST1 VST2 VST3 VST4 VSUB VSXTL VSXTL2
+VTBL VTBX VTRN1 VTRN2 VUADDLV VUADDW VUADDW2 VUCVTF VUHADD VUMAX VUMAXP VUMAXV VUMIN VUMINP VUMINV VUMLAL
+VUMLAL2 VUMLSL VUMLSL2 VUMULL VUMULL2 VUQADD VUQSHL VUQSUB VUQXTN VUQXTN2 VURHADD VUSHL VUSHLL VUSHLL2 VUSHR
+VUSRA VUXTL VUXTL2 VUZP1 VUZP2 VXAR VXTN VXTN2 VZIP1 VZIP2
+`)
+
+// arm64VectorGoVersions are the Go releases known to accept the vector instructions, keyed by the minor version
+// of the release - any other instruction in arm64VectorOps is only known to be accepted by LatestGoVersion
+var arm64VectorGoVersions = goVersions(map[int]string{
+	11: `
+AESD AESE AESIMC AESMC SHA1C SHA1H SHA1M SHA1P SHA1SU0 SHA1SU1 SHA256H SHA256H2 SHA256SU0 SHA256SU1
+VADD VADDP VADDV VAND VCMEQ VDUP VEOR VLD1 VMOV VORR VREV32 VST1 VSUB VUADDLV
+`,
+	13: `
+VBIF VBIT VBSL VCNT VEXT VFMLA VFMLS VLD1R VLD2 VLD2R VLD3 VLD3R VLD4 VLD4R VMOVI VPMULL VPMULL2 VREV16 VREV64
+VSHL VSLI VSRI VST2 VST3 VST4 VTBL VUADDW VUADDW2 VUMAX VUMIN VUSHLL VUSHLL2 VUSHR VUSRA VUXTL VUXTL2
+VUZP1 VUZP2 VZIP1 VZIP2
+`,
+	21: `
+SHA512H SHA512H2 SHA512SU0 SHA512SU1 VBCAX VBIC VCMTST VEOR3 VNOT VORN VRAX1 VTBX VTRN1 VTRN2 VXAR
+`,
+})
+
+// arm64FloatReg matches a scalar floating point register in the output of arm64asm.GoSyntax
+var arm64FloatReg = regexp.MustCompile(`\bF(\d+)\b`)
+
+// arm64VectorRenames are the vector instructions which the Go assembler knows under another name than
+// arm64asm.GoSyntax uses
+var arm64VectorRenames = map[string]string{
+	"VMVN": "VNOT",
+}
+
+// stringSet returns a set of the whitespace separated fields
+func stringSet(fields string) map[string]bool {
+	set := make(map[string]bool)
+	for _, field := range strings.Fields(fields) {
+		set[field] = true
+	}
+	return set
+}
+
+// writeARM64Supported translates an arm64 instruction into plan9 syntax using arm64asm
+func (instr MachineInstruction) writeARM64Supported(w io.Writer) error {
+	// the arm64 decoder expects the bytes in little endian, whatever the byte order of the object
+	instrBytes := instr.littleEndianBytes("arm64")
+	// to translate this machine instruction into plan9 assembly, first see if it can be decoded
+	goInstr, err := arm64asm.Decode(instrBytes)
+	if err != nil {
+		// Then we couldn't decode this instruction and we should
+		// use the WORD method
+		return fmt.Errorf(unrecognizedInstr, instr.Command)
+	}
+
+	if kind, _, _ := instr.arm64Branch(noSymbols); kind != notPCRelative {
+		// without a label the Go assembler can't encode the PC-relative operand, so it has to stay as it is,
+		// see WriteInstructions for branches that can be written with labels
+		return fmt.Errorf(unrecognizedInstr, instr.Command)
+	}
+
+	goSyntax := arm64asm.GoSyntax(goInstr, instr.Address, nil, nil)
+	if isARM64Vector(goInstr, goSyntax) {
+		var ok bool
+		goSyntax, ok = arm64VectorSyntax(goSyntax, arm64PostIndex(goInstr))
+		if !ok {
+			return fmt.Errorf(unrecognizedInstr, instr.Command)
+		}
+	}
+
+	fmt.Fprintf(w, "%s \t", goSyntax)
+	return nil
+}
+
+// isARM64Vector returns whether the instruction is an ASIMD or crypto instruction, i.e. one with a vector
+// register operand
+func isARM64Vector(inst arm64asm.Inst, goSyntax string) bool {
+	for _, arg := range inst.Args {
+		switch arg.(type) {
+		case arm64asm.RegisterWithArrangement, arm64asm.RegisterWithArrangementAndIndex:
+			return true
+		}
+	}
+	return strings.HasPrefix(goSyntax, "AES") || strings.HasPrefix(goSyntax, "SHA")
+}
+
+// arm64PostIndex returns whether the instruction is a load or store which updates it's base register after the
+// access, i.e. "st4 {v19.2d-v22.2d}, [x0], #64"
+func arm64PostIndex(inst arm64asm.Inst) bool {
+	for _, arg := range inst.Args {
+		if mem, ok := arg.(arm64asm.MemImmediate); ok && (mem.Mode == arm64asm.AddrPostIndex || mem.Mode == arm64asm.AddrPostReg) {
+			return true
+		}
+	}
+	return false
+}
+
+// arm64VectorSyntax returns the ASIMD or crypto instruction from arm64asm.GoSyntax in the syntax the Go assembler
+// uses, or false if the Go assembler doesn't have the instruction
+// postIndex is whether the instruction updates it's base register after the access, which arm64asm only adds the
+// ".P" suffix for on some of the loads and stores (i.e. not on LD2 to LD4 and ST2 to ST4 in older revisions of x/arch)
+func arm64VectorSyntax(goSyntax string, postIndex bool) (string, bool) {
+	fields := strings.SplitN(goSyntax, " ", 2)
+	op, operands := fields[0], ""
+	if len(fields) == 2 {
+		operands = fields[1]
+	}
+
+	// the post-index suffix is the same for every load and store
+	suffix := ""
+	if strings.HasSuffix(op, ".P") || postIndex {
+		op, suffix = strings.TrimSuffix(op, ".P"), ".P"
+	}
+
+	// arm64asm doesn't prefix vector floating point and conversion instructions with a V, as it does for the others
+	if !strings.HasPrefix(op, "V") && !strings.HasPrefix(op, "AES") && !strings.HasPrefix(op, "SHA") {
+		op = "V" + op
+	}
+	if renamed, ok := arm64VectorRenames[op]; ok {
+		op = renamed
+	}
+	if !arm64VectorOps[op] {
+		return "", false
+	}
+
+	switch op {
+	case "VST2", "VST3", "VST4":
+		// arm64asm only puts the register list first for VST1, the Go assembler always expects it first
+		if i := strings.Index(operands, ", ["); i >= 0 {
+			operands = operands[i+2:] + ", " + operands[:i]
+		}
+	case "VFCMEQ", "VFCMGE", "VFCMGT", "VFCMLE", "VFCMLT":
+		// comparisons against zero take a floating point zero
+		if strings.HasPrefix(operands, "$0, ") {
+			operands = "$(0.0)" + strings.TrimPrefix(operands, "$0")
+		}
+	case "VMOVI":
+		// the Go assembler only has the byte arrangements of MOVI
+		if !strings.Contains(operands, ".B") {
+			return "", false
+		}
+	case "VFMAXV", "VFMAXNMV", "VFMINV", "VFMINNMV":
+		// the scalar result of reductions is named as a vector register
+		operands = arm64FloatReg.ReplaceAllString(operands, "V$1")
+	}
+
+	if strings.HasPrefix(op, "VF") {
+		// The Go assembler only has the vector forms of the floating point instructions on single and double
+		// precision, without scalar operands, elements or fixed point conversions
+		if arm64FloatReg.MatchString(operands) || strings.ContainsAny(operands, "[$") && !strings.HasPrefix(operands, "$(0.0)") ||
+			strings.Contains(operands, ".H") {
+			return "", false
+		}
+	}
+
+	return op + suffix + " " + operands, true
+}
+
+// arm64Branch returns how the arm64 instruction depends on it's address, see MachineInstruction.branch
+func (instr MachineInstruction) arm64Branch(symname func(uint64) (string, uint64)) (pcRelative, uint64, string) {
+	if len(instr.Bytes) != 4 {
+		return positionDependent, 0, ""
+	}
+	// the arm64 decoder expects the bytes in little endian, whatever the byte order of the object
+	instrBytes := instr.littleEndianBytes("arm64")
+	goInstr, err := arm64asm.Decode(instrBytes)
+	if err != nil {
+		// we don't know what this is, so it has to stay where it is
+		return positionDependent, 0, ""
+	}
+
+	for _, arg := range goInstr.Args {
+		rel, ok := arg.(arm64asm.PCRel)
+		if !ok {
+			continue
+		}
+		switch goInstr.Op {
+		case arm64asm.B, arm64asm.CBZ, arm64asm.CBNZ, arm64asm.TBZ, arm64asm.TBNZ:
+			target := instr.Address + uint64(int64(rel))
+			goSyntax := arm64asm.GoSyntax(goInstr, instr.Address, symname, nil)
+			// arm64asm doesn't look up the targets of branches, it always counts them in instructions
+			if name, _ := symname(target); name != "" {
+				goSyntax = strings.Replace(goSyntax, fmt.Sprintf("%d(PC)", int64(rel)/4), name+"(SB)", 1)
+			}
+			return labelBranch, target, goSyntax
+		}
+		// i.e. BL, which the Go assembler would treat as a call, or ADR and literal loads
+		return positionDependent, 0, ""
+	}
+
+	return notPCRelative, 0, ""
+}
@@ -0,0 +1,213 @@
+package assembler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestWriteInstructionsThumb(t *testing.T) {
+	instrs := []MachineInstruction{
+		{Command: "push", Arguments: []string{"{r7", "lr}"}, Bytes: []byte{0xb5, 0x80}, Thumb: true},
+		{Command: "ldr.w", Arguments: []string{"r3", "[r0", "#4]"}, Bytes: []byte{0xf8, 0xd0, 0x30, 0x04}, Thumb: true},
+		{Command: "adds", Arguments: []string{"r0", "r3", "#1"}, Bytes: []byte{0x1c, 0x58}, Thumb: true},
+		{Command: "pop", Arguments: []string{"{r7", "pc}"}, Bytes: []byte{0xbd, 0x80}, Thumb: true},
+	}
+	var buf bytes.Buffer
+	err := WriteInstructions("arm", &buf, instrs, true)
+	want := "// switch to Thumb state WORD $0xe28fc001; // add ip pc #1 WORD $0xe12fff1c; // bx ip " +
+		"WORD $0xf8d0b580; // push {r7 lr} // ldr.w r3 [r0 #4] WORD $0x1c583004; // adds r0 r3 #1 " +
+		"WORD $0x46c0bd80; // pop {r7 pc} // padded with nop // switch back to ARM state WORD $0x46c04778; // bx pc // nop"
+	if got := adjustWhitespace(buf.String()); err != nil || got != want {
+		t.Errorf("Unable to write Thumb instructions, got: (err=%v,\noutput=%s\n) want: (err=nil,\noutput=%s\n).", err, got, want)
+	}
+
+	// a Thumb instruction on it's own can't be written out
+	buf.Reset()
+	err = instrs[0].WriteOutput("arm", &buf, true)
+	if err == nil || buf.Len() != 0 {
+		t.Errorf("Expected an error for Thumb instruction (instr=%v), got: (err=%v, output=%s).", instrs[0], err, buf.String())
+	}
+}
+
+func TestApplyMappingSymbols(t *testing.T) {
+	mappingSyms := []Symbol{
+		{Name: "$t", Section: ".text", ValueAddressField: 8},
+		{Name: "$a", Section: ".text", ValueAddressField: 0},
+		{Name: "$t", Section: ".text.other", ValueAddressField: 0},
+		{Name: "$d", Section: ".text", ValueAddressField: 12},
+	}
+	instrs := []MachineInstruction{
+		{Address: 0},
+		{Address: 4},
+		{Address: 8},
+		{Address: 10},
+		{Address: 12},
+	}
+	ApplyMappingSymbols(instrs, ".text", mappingSyms)
+	for i, want := range []struct{ thumb, data bool }{{false, false}, {false, false}, {true, false}, {true, false}, {false, true}} {
+		if instrs[i].Thumb != want.thumb || instrs[i].Data != want.data {
+			t.Errorf("Unable to apply mapping symbols to instruction at %#x, got: (thumb=%t, data=%t) want: (thumb=%t, data=%t).", instrs[i].Address, instrs[i].Thumb, instrs[i].Data, want.thumb, want.data)
+		}
+	}
+}
+
+func TestApplyMappingSymbolsRISCV64(t *testing.T) {
+	mappingSyms := []Symbol{
+		{Name: "$xrv64i2p1_m2p0_a2p1_c2p0", Section: ".text", ValueAddressField: 0},
+		{Name: "$d", Section: ".text", ValueAddressField: 4},
+		{Name: "$xrv64i2p1_m2p0_a2p1_c2p0", Section: ".text", ValueAddressField: 8},
+	}
+	instrs := []MachineInstruction{{Address: 0}, {Address: 4}, {Address: 8}}
+	ApplyMappingSymbols(instrs, ".text", mappingSyms)
+	for i, data := range []bool{false, true, false} {
+		if instrs[i].Data != data || instrs[i].Thumb {
+			t.Errorf("Unable to apply riscv64 mapping symbols to instruction at %#x, got: (thumb=%t, data=%t) want: (thumb=false, data=%t).", instrs[i].Address, instrs[i].Thumb, instrs[i].Data, data)
+		}
+	}
+}
+
+func TestIsMappingSymbol(t *testing.T) {
+	tables := []struct {
+		name    string
+		mapping bool
+	}{
+		{"$a", true},
+		{"$d.1", true},
+		{"$x", true},
+		// RISC-V code can be marked with the ISA string it needs
+		{"$xrv64i2p1_m2p0_a2p1_c2p0", true},
+		{"$xrv32i2p1.2", true},
+		{"$data", false},
+		{"main", false},
+	}
+	for _, table := range tables {
+		if got := (Symbol{Name: table.name}).IsMappingSymbol(); got != table.mapping {
+			t.Errorf("Unable to tell if %s is a mapping symbol, got: %t want: %t.", table.name, got, table.mapping)
+		}
+	}
+}
+
+func TestARMSummaryClass(t *testing.T) {
+	instrs := []MachineInstruction{
+		// add r0, r0, r1
+		{Command: "add", Arguments: []string{"r0", "r0", "r1"}, Bytes: []byte{0xe0, 0x80, 0x00, 0x01}},
+		// vadd.f64 d0, d0, d1
+		{Command: "vadd.f64", Arguments: []string{"d0", "d0", "d1"}, Bytes: []byte{0xee, 0x30, 0x0b, 0x01}},
+		{Command: "adds", Arguments: []string{"r0", "r3", "#1"}, Bytes: []byte{0x1c, 0x58}, Thumb: true},
+	}
+	backend, _ := Backend("arm")
+	if writer := backend.(functionWriter); !writer.writesFunction(instrs) || writer.writesFunction(instrs[:2]) {
+		t.Errorf("Unable to tell which arm functions have Thumb code.")
+	}
+	var classes []string
+	for _, instr := range instrs {
+		classes = append(classes, instr.summaryClass("arm", true, false))
+	}
+	want := "core translated, VFP translated, Thumb raw"
+	if got := strings.Join(classes, ", "); got != want {
+		t.Errorf("Unable to classify arm instructions, got: %s want: %s.", got, want)
+	}
+}
+
+func TestWriteInstructionsARMData(t *testing.T) {
+	tt := []struct {
+		name   string
+		instrs []MachineInstruction
+		want   string
+		err    string
+	}{
+		{
+			name: "literal pool which doesn't fill a WORD",
+			instrs: []MachineInstruction{
+				{Address: 0x0, Command: "mov", Arguments: []string{"r1", "r0"}, Bytes: []byte{0xe1, 0xa0, 0x10, 0x00}},
+				{Address: 0x4, Command: ".word", Arguments: []string{"0x01020304"}, Bytes: []byte{0x01, 0x02, 0x03, 0x04}, Data: true},
+				{Address: 0x8, Command: ".short", Arguments: []string{"0x0506"}, Bytes: []byte{0x05, 0x06}, Data: true},
+			},
+			want: "MOVW R0, R1 // mov r1 r0 WORD $0x01020304; // data .word 0x01020304 " +
+				"WORD $0x00000506; // data .short 0x0506 // padded with zeros",
+		},
+		{
+			// the exit veneer goes after the literal pool, as the function doesn't end with Thumb code
+			name: "Thumb code with a literal pool",
+			instrs: []MachineInstruction{
+				{Address: 0x0, Command: "ldr", Arguments: []string{"r0", "[pc", "#0]"}, Bytes: []byte{0x48, 0x00}, Thumb: true},
+				{Address: 0x2, Command: "bx", Arguments: []string{"lr"}, Bytes: []byte{0x47, 0x70}, Thumb: true},
+				{Address: 0x4, Command: ".word", Arguments: []string{"0x01020304"}, Bytes: []byte{0x01, 0x02, 0x03, 0x04}, Data: true},
+			},
+			want: "// switch to Thumb state WORD $0xe28fc001; // add ip pc #1 WORD $0xe12fff1c; // bx ip " +
+				"WORD $0x47704800; // ldr r0 [pc #0] // bx lr WORD $0x01020304; // data .word 0x01020304 " +
+				"// switch back to ARM state WORD $0x46c04778; // bx pc // nop",
+		},
+		{
+			name: "data which doesn't fill a halfword",
+			instrs: []MachineInstruction{
+				{Address: 0x0, Command: ".byte", Arguments: []string{"0x01"}, Bytes: []byte{0x01}, Data: true},
+				{Address: 0x1, InstructionString: "adds r0, #1", Command: "adds", Arguments: []string{"r0", "#1"}, Bytes: []byte{0x30, 0x01}, Thumb: true},
+			},
+			err: `instruction "adds r0, #1" at 0x1 follows data which doesn't fill a halfword`,
+		},
+	}
+
+	for _, tc := range tt {
+		var buf bytes.Buffer
+		err := WriteInstructions("arm", &buf, tc.instrs, true)
+		switch {
+		case tc.err != "":
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("Unable to reject %s, got: (err=%v) want: (err=%s).", tc.name, err, tc.err)
+			}
+		case err != nil:
+			t.Errorf("Unable to write %s : %v", tc.name, err)
+		case adjustWhitespace(buf.String()) != tc.want:
+			t.Errorf("Unable to write %s, got:\n%s\nwant:\n%s", tc.name, adjustWhitespace(buf.String()), tc.want)
+		}
+	}
+}
+
+func TestWriteInstructionsARM64Data(t *testing.T) {
+	// a table of bytes in the code which doesn't fill a WORD
+	instrs := []MachineInstruction{
+		{Address: 0x0, Command: "ret", Bytes: []byte{0xd6, 0x5f, 0x03, 0xc0}},
+		{Address: 0x4, Command: ".byte", Arguments: []string{"0x01"}, Bytes: []byte{0x01}, Data: true},
+		{Address: 0x5, Command: ".short", Arguments: []string{"0x0203"}, Bytes: []byte{0x02, 0x03}, Data: true},
+	}
+	var buf bytes.Buffer
+	err := WriteInstructions("arm64", &buf, instrs, false)
+	want := "WORD $0xd65f03c0; // ret WORD $0x00020301; // data .byte 0x01 // data .short 0x0203 // padded with zeros"
+	if got := adjustWhitespace(buf.String()); err != nil || got != want {
+		t.Errorf("Unable to write arm64 data, got: (err=%v,\noutput=%s\n) want: (err=nil,\noutput=%s\n).", err, got, want)
+	}
+}
+
+func TestWriteInstructionsBigEndian(t *testing.T) {
+	// the instructions end up in little endian like in a BE8 image, while the data stays in big endian
+	tt := []struct {
+		arch   string
+		instrs []MachineInstruction
+		want   string
+	}{
+		{"arm", []MachineInstruction{
+			{Command: "add", Arguments: []string{"r0", "r0", "r1"}, Bytes: []byte{0xe0, 0x80, 0x00, 0x01}},
+			{Address: 0x4, Command: ".word", Arguments: []string{"0x01020304"}, Bytes: []byte{0x01, 0x02, 0x03, 0x04}, Data: true},
+		}, "WORD $0xe0800001; // add r0 r0 r1 WORD $0x04030201; // data .word 0x01020304"},
+		{"arm", []MachineInstruction{
+			{Command: "adds", Arguments: []string{"r0", "#1"}, Bytes: []byte{0x30, 0x01}, Thumb: true},
+		}, "// switch to Thumb state WORD $0xe28fc001; // add ip pc #1 WORD $0xe12fff1c; // bx ip " +
+			"WORD $0x46c03001; // adds r0 #1 // padded with nop // switch back to ARM state WORD $0x46c04778; // bx pc // nop"},
+		{"arm64", []MachineInstruction{
+			{Command: "ret", Bytes: []byte{0xd6, 0x5f, 0x03, 0xc0}},
+		}, "WORD $0xd65f03c0; // ret"},
+	}
+	for _, tc := range tt {
+		for i := range tc.instrs {
+			tc.instrs[i].BytesEndianness = binary.BigEndian
+		}
+		var buf bytes.Buffer
+		err := WriteInstructions(tc.arch, &buf, tc.instrs, true)
+		if got := adjustWhitespace(buf.String()); err != nil || got != tc.want {
+			t.Errorf("Unable to write big endian %s instructions, got: (err=%v,\noutput=%s\n) want: (err=nil,\noutput=%s\n).", tc.arch, err, got, tc.want)
+		}
+	}
+}
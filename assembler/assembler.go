@@ -1,12 +1,13 @@
 package assembler
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
-
-	"golang.org/x/arch/arm/armasm"
-	"golang.org/x/arch/arm64/arm64asm"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -23,7 +24,8 @@ type MachineInstruction struct {
 	InstructionString string
 	// The bytes corresponding to the actual machine instruction assembled
 	Bytes []byte
-	// The endianness of the instruction bytes
+	// The byte order of the object file the instruction is from - note that Bytes are in the order objdump shows them,
+	// which is a value rather than memory order for most RISC architectures, see MemoryBytes
 	BytesEndianness binary.ByteOrder
 	// The command (or opcode) of the instruction
 	Command string
@@ -39,6 +41,63 @@ type MachineInstruction struct {
 	Comment string
 	// The address of the instruction (i.e. the PC)
 	Address uint64
+	// Any relocations in the object file which apply to the bytes of this instruction
+	Relocations []Relocation
+	// Whether this is a Thumb instruction rather than an ARM instruction, see ApplyMappingSymbols
+	Thumb bool
+	// Whether this is data inside of the code (i.e. a literal pool) rather than an instruction, which is always
+	// written out as it's bytes, see ApplyMappingSymbols
+	Data bool
+	// The alignment the instruction has to be placed at, as alignment padding in front of it was taken out, see
+	// AlignPadding
+	Align int
+	// Whether the instruction has to be written out as it's bytes even when translating, i.e. because the Go
+	// assembler doesn't encode the translation into the same bytes, see goasm.Verifier
+	KeepBytes bool
+	// The instruction in Go syntax referring to the Go symbols for what it's relocations point at, which is always
+	// written out instead of the bytes, as they only hold a placeholder for the linker, see ResolveDataReferences
+	SymbolReference string
+	// The name of the function in the object file the instruction calls or jumps to, if it's SymbolReference is the
+	// call or jump to the Go symbol for it, see ResolveCalls
+	Callee string
+	// Whether the instruction is already part of the SymbolReference of the instruction before it, i.e. the ADD of an
+	// arm64 ADRP/ADD pair, or of the JumpTable of an instruction before it, in which case it's only written out as a
+	// comment
+	InReference bool
+	// The jump through a table of addresses in the function the instruction starts, which is written out as a ladder
+	// of compares and jumps to labels in place of it and the instructions marked InReference after it, see
+	// ResolveJumpTables
+	JumpTable *JumpTable
+}
+
+// Relocation represents a relocation entry of an object file, i.e. a spot in an instruction
+// that the linker is expected to fill in with the address of some symbol
+type Relocation struct {
+	// The address of the bytes the relocation applies to
+	Address uint64
+	// The type of the relocation, i.e. "R_386_PC32"
+	Type string
+	// The symbol the relocation refers to, as reported by the assembler, including any addend, i.e. ".rodata-0x4"
+	Symbol string
+}
+
+// relocationAddend matches the addend objdump prints after the symbol of a relocation, with the symbol and the
+// addend as 2 subgroups
+var relocationAddend = regexp.MustCompile(`^(.+?)([+-]0x[0-9a-f]+)$`)
+
+// target returns the name of the symbol the relocation refers to and the addend, which is 0 if there is none
+// Note that objects with REL relocations (i.e. on 386 and arm) keep the addend in the bytes of the instruction
+// instead, which is up to the architecture to decode
+func (r Relocation) target() (string, int64) {
+	matches := relocationAddend.FindStringSubmatch(r.Symbol)
+	if matches == nil {
+		return r.Symbol, 0
+	}
+	addend, err := strconv.ParseInt(matches[2], 0, 64)
+	if err != nil {
+		return r.Symbol, 0
+	}
+	return matches[1], addend
 }
 
 // Assembler is a generic assembler implementation interface
@@ -54,6 +113,13 @@ type Assembler interface {
 	// processing ParseObjectSymbols return value) and should produce a map of those symbols to their
 	// respective instructions
 	ProcessMachineCodeToInstructions(string, map[string]Symbol) (map[string][]MachineInstruction, error)
+	// ProcessDataSymbols will take a map of symbol names -> symbols in the data sections (see Symbol.IsData) and
+	// should produce a map of those symbols to their contents
+	ProcessDataSymbols(string, map[string]Symbol) (map[string][]byte, error)
+	// ProcessDataRelocations will take an object file and should produce a map of the sections holding data to the
+	// relocations applying to them, with the Address of each being the offset into the section and the Symbol
+	// including the addend, even for objects which keep it in the bytes of the section
+	ProcessDataRelocations(string) (map[string][]Relocation, error)
 	// Architecture returns the architecture that this compiler runs for
 	Architecture() string
 }
@@ -110,6 +176,14 @@ func (i invalidAssembler) ProcessMachineCodeToInstructions(string, map[string]Sy
 	return nil, fmt.Errorf("unimplemented assembler")
 }
 
+func (i invalidAssembler) ProcessDataSymbols(string, map[string]Symbol) (map[string][]byte, error) {
+	return nil, fmt.Errorf("unimplemented assembler")
+}
+
+func (i invalidAssembler) ProcessDataRelocations(string) (map[string][]Relocation, error) {
+	return nil, fmt.Errorf("unimplemented assembler")
+}
+
 func (i invalidAssembler) Architecture() string {
 	return "invalid"
 }
@@ -128,12 +202,46 @@ func (instr MachineInstruction) errIsUnsupported(err error, arch string) bool {
 // tryTranslate controls whether or not to attempt to translate this instruction to Golang syntax
 // and output that instead
 func (instr MachineInstruction) WriteOutput(arch string, w io.Writer, tryTranslate bool) error {
+	if instr.InReference {
+		// the instruction was already written out with the one before it
+		fmt.Fprintf(w, "    ")
+		instr.writeComment(w)
+		fmt.Fprintln(w)
+		return nil
+	}
+	// some position independent code can't be expressed in Go, so check for it before writing anything
+	if err := instr.checkPIC(arch); err != nil {
+		return err
+	}
+	if instr.Thumb {
+		// Thumb code needs to be packed into WORD's and switched to, as Go only runs in ARM state
+		return fmt.Errorf("Thumb instruction \"%s\" at %#x can only be written along with the instructions around it, see WriteInstructions",
+			strings.TrimSpace(instr.InstructionString), instr.Address)
+	}
+	if !instr.fitsDirectives(arch) {
+		// i.e. there is no directive for less than 4 bytes on riscv64 for a compressed instruction
+		return fmt.Errorf("instruction \"%s\" at %#x can only be written along with the instructions around it, as there is no directive for it's %d bytes on %s, see WriteInstructions",
+			strings.TrimSpace(instr.InstructionString), instr.Address, len(instr.Bytes), arch)
+	}
+
 	// Write out the indentation for this instruction
 	fmt.Fprintf(w, "    ")
 
 	// Switch on the method to use for outputting this instruction
+	thunkReg, isThunkCall := instr.PCThunkRegister(arch)
 	switch {
-	case tryTranslate:
+	case instr.SymbolReference != "":
+		// references to symbols are always written out, as the bytes don't point anywhere until they are linked
+		fmt.Fprintf(w, "%s \t", instr.SymbolReference)
+	case instr.Data:
+		// data would only be decoded into whatever instruction has the same bytes
+		instr.writePlan9Unsupported(arch, w)
+	case isThunkCall:
+		// calls to the PC thunks always need to be rewritten, as the thunk itself is emitted separately
+		writePCThunkCall(w, thunkReg)
+	case tryTranslate && !instr.KeepBytes && instr.byteOrder(arch) == ByteOrder(arch):
+		// instructions from an object for the variant of arch in the other byte order would be encoded differently
+		// when translated, so they are only ever written as their bytes
 		err := instr.writePlan9Supported(arch, w)
 		// if there was no error, exit the switch, otherwise fallback on
 		// using unsupported opcode syntax
@@ -149,10 +257,7 @@ func (instr MachineInstruction) WriteOutput(arch string, w io.Writer, tryTransla
 	}
 
 	// Now we add the actual instructions as a new column for each command/argument
-	fmt.Fprintf(w, "// %s\t", instr.Command)
-	for _, arg := range instr.Arguments {
-		fmt.Fprintf(w, "%s\t", arg)
-	}
+	instr.writeComment(w)
 
 	fmt.Fprintln(w)
 
@@ -160,105 +265,303 @@ func (instr MachineInstruction) WriteOutput(arch string, w io.Writer, tryTransla
 
 }
 
-func reverseEndianness(byteSlice []byte) {
-	for i, j := 0, len(byteSlice)-1; i < j; i, j = i+1, j-1 {
-		byteSlice[i], byteSlice[j] = byteSlice[j], byteSlice[i]
+// Translation returns the instruction translated into plan9 syntax, as it would be written out by WriteOutput
+// It returns false if the instruction isn't translated on it's own, which includes instructions with a
+// SymbolReference, as they can't be assembled without the symbols they refer to
+func (instr MachineInstruction) Translation(arch string) (string, bool) {
+	if instr.SymbolReference != "" || instr.InReference || instr.JumpTable != nil || instr.Thumb || instr.Data || !instr.fitsDirectives(arch) || instr.isPCThunkCall(arch) ||
+		instr.byteOrder(arch) != ByteOrder(arch) {
+		return "", false
 	}
+	var buf bytes.Buffer
+	if err := instr.writePlan9Supported(arch, &buf); err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(buf.String()), true
 }
 
-func (instr MachineInstruction) writePlan9Unsupported(arch string, w io.Writer) error {
-	// First check whether the architecture specified is 32-bit or 64-bit
-	// default to 64-bit
-	maxBits := 64
-	switch arch {
-	case "amd64",
-		"arm64":
-		maxBits = 64
-	case "arm":
-		maxBits = 32
-	}
-
-	// Calculate the prefixes to use based on the number of bits
-	var prefixes []string
-	var lengths []int
-	if maxBits == 64 && arch == "arm64" {
-		// arm64 architecture doesn't support LONG's as 32-bit's instead
-		// 32-bit instructions are WORD's
-		prefixes = []string{
-			"QUAD $0x%02x%02x%02x%02x%02x%02x%02x%02x; \t",
-			"WORD $0x%02x%02x%02x%02x; \t",
-			"BYTE $0x%02x; \t",
+// MemoryBytes returns the bytes of the instruction in the order they are found in memory
+// objdump shows the instructions of most RISC architectures as a single value rather than as bytes (and Thumb
+// instructions as halfword values), which are stored in the byte order of the object
+func (instr MachineInstruction) MemoryBytes(arch string) []byte {
+	memBytes := make([]byte, len(instr.Bytes))
+	copy(memBytes, instr.Bytes)
+	if !objdumpShowsValues(arch) || instr.byteOrder(arch) == binary.BigEndian {
+		return memBytes
+	}
+	valueLen := len(memBytes)
+	if instr.Thumb {
+		valueLen = 2
+	}
+	for i := 0; i+valueLen <= len(memBytes); i += valueLen {
+		reverseEndianness(memBytes[i : i+valueLen])
+	}
+	return memBytes
+}
+
+// littleEndianBytes returns the bytes of the instruction as they would be in memory on a little endian target,
+// which is what the decoders for arm, arm64, loong64 and riscv64 expect
+func (instr MachineInstruction) littleEndianBytes(arch string) []byte {
+	instrBytes := instr.MemoryBytes(arch)
+	if instr.byteOrder(arch) == binary.BigEndian {
+		reverseEndianness(instrBytes)
+	}
+	return instrBytes
+}
+
+// byteOrder returns the byte order of the object the instruction is from, which is assumed to be the byte order Go
+// uses for arch if it isn't known
+func (instr MachineInstruction) byteOrder(arch string) binary.ByteOrder {
+	if instr.BytesEndianness != nil {
+		return instr.BytesEndianness
+	}
+	return ByteOrder(arch)
+}
+
+// isBE8 returns whether the instruction is from an object in the other byte order than Go uses for arch, where Go
+// has no variant of arch in that byte order (see ArchForByteOrder), i.e. big endian arm or arm64
+// These are written out the way the linker lays out a BE8 image, with the instructions in little endian (the only
+// way Go runs them) and the data in the code left in big endian
+func (instr MachineInstruction) isBE8(arch string) bool {
+	order := instr.byteOrder(arch)
+	return order != ByteOrder(arch) && ArchForByteOrder(arch, order) == arch
+}
+
+// fitsDirectives returns whether the instruction can be written out as data on it's own, which it can't if it's
+// bytes don't fill a whole number of the smallest data directive, i.e. a 2 byte compressed instruction on riscv64
+func (instr MachineInstruction) fitsDirectives(arch string) bool {
+	backend, ok := Backend(arch)
+	if !ok {
+		return true
+	}
+	directives := backend.Directives()
+	return len(instr.Bytes)%directives[len(directives)-1].Size == 0
+}
+
+// PCThunkRegister returns the Go name of the register loaded by the PC thunk the instruction calls, if it's a call
+// to one of the thunks position independent code on arch reads the PC with, see WritePCThunk
+func (instr MachineInstruction) PCThunkRegister(arch string) (string, bool) {
+	backend, _ := Backend(arch)
+	if caller, ok := backend.(pcThunkCaller); ok {
+		return caller.pcThunkRegister(instr)
+	}
+	return "", false
+}
+
+func (instr MachineInstruction) isPCThunkCall(arch string) bool {
+	_, ok := instr.PCThunkRegister(arch)
+	return ok
+}
+
+// checkPIC returns an error if the instruction is position independent code which can't be written in Go for arch
+func (instr MachineInstruction) checkPIC(arch string) error {
+	backend, _ := Backend(arch)
+	if caller, ok := backend.(pcThunkCaller); ok {
+		return caller.checkPIC(instr)
+	}
+	return nil
+}
+
+// objdumpShowsValues returns whether objdump shows the instructions of arch as values rather than as bytes in
+// memory order, see ArchBackend
+func objdumpShowsValues(arch string) bool {
+	backend, ok := Backend(arch)
+	return ok && backend.ObjdumpShowsValues()
+}
+
+// ByteOrder returns the byte order Go uses for arch, which is the order data directives like WORD are written in
+func ByteOrder(arch string) binary.ByteOrder {
+	if backend, ok := Backend(arch); ok {
+		return backend.ByteOrder()
+	}
+	return binary.LittleEndian
+}
+
+// ArchForByteOrder returns the Go architecture for an object assembled for arch in the byte order, for the
+// architectures Go supports in both byte orders, i.e. a mips assembler run with -EL produces mipsle objects
+func ArchForByteOrder(arch string, order binary.ByteOrder) string {
+	if order == nil {
+		return arch
+	}
+	pairs := map[string]string{
+		"mips":   "mipsle",
+		"mips64": "mips64le",
+		"ppc64":  "ppc64le",
+	}
+	for bigEndian, littleEndian := range pairs {
+		switch {
+		case arch == bigEndian && order == binary.LittleEndian:
+			return littleEndian
+		case arch == littleEndian && order == binary.BigEndian:
+			return bigEndian
 		}
-		lengths = []int{
-			8,
-			4,
-			1,
+	}
+	return arch
+}
+
+// writeComment writes out the native instruction as a comment, with a column for the command and each argument
+func (instr MachineInstruction) writeComment(w io.Writer) {
+	if instr.Data {
+		fmt.Fprintf(w, "// data\t%s\t", instr.Command)
+	} else {
+		fmt.Fprintf(w, "// %s\t", instr.Command)
+	}
+	for _, arg := range instr.Arguments {
+		fmt.Fprintf(w, "%s\t", arg)
+	}
+}
+
+// WriteInstructions writes out all of the instructions of a function with WriteOutput, taking care of anything
+// that depends on more than a single instruction
+func WriteInstructions(arch string, w io.Writer, instrs []MachineInstruction, tryTranslate bool) error {
+	backend, _ := Backend(arch)
+	if writer, ok := backend.(functionWriter); ok && writer.writesFunction(instrs) {
+		return writer.writeFunction(w, instrs, tryTranslate)
+	}
+	slotter, hasDelaySlots := backend.(delaySlotter)
+
+	// Branches inside the function are written with labels for their targets when translating, so that
+	// translated instructions which the Go assembler encodes with a different size don't break them
+	var labels map[uint64]string
+	useLabels := false
+	if tryTranslate && labelsAllowed(arch, instrs) {
+		labels, useLabels = branchLabels(arch, instrs)
+	}
+
+	for i, instr := range instrs {
+		if instr.Align != 0 {
+			fmt.Fprintf(w, "    PCALIGN $%d\n", instr.Align)
 		}
-	} else if maxBits == 64 {
-		// Other 64 bit architecture's have QUAD = 8 bytes, LONG = 4 bytes, WORD = 2 bytes, BYTE = 1 byte
-		prefixes = []string{
-			"QUAD $0x%02x%02x%02x%02x%02x%02x%02x%02x; \t",
-			"LONG $0x%02x%02x%02x%02x; \t",
-			"WORD $0x%02x%02x; \t",
-			"BYTE $0x%02x; \t",
+		if label, ok := labels[instr.Address]; ok && useLabels {
+			fmt.Fprintf(w, "%s:\n", label)
 		}
-		lengths = []int{
-			8,
-			4,
-			2,
-			1,
+		if instr.JumpTable != nil {
+			if !useLabels {
+				return fmt.Errorf("instruction \"%s\" at %#x jumps through the table at %s, which can only be written out with labels for it's entries",
+					strings.TrimSpace(instr.InstructionString), instr.Address, instr.JumpTable.Table)
+			}
+			instr.writeJumpTable(w, labels)
+			continue
 		}
-	} else if maxBits == 32 {
-		// TODO : check other 32-bit architecures to see what isa length they support...
-		// To my knowledge, ARM, PowerPC, and MIPS all only support fixed width 32-bit instructions,
-		// but others may allow/more
-		// However, on 386, we also have LONG, but it's not clear from the plan 9 assembler reference what size
-		// LONG is : https://9p.io/sys/doc/asm.html
-		// So for now, just assume that every 32-bit architecture only allows WORD's and BYTE's
-		prefixes = []string{
-			"WORD $0x%02x%02x%02x%02x; \t",
-			"BYTE $0x%02x; \t",
+		if useLabels && instr.movesWithLabels(arch) {
+			if kind, _, _ := instr.branch(arch, noSymbols); kind == labelBranch {
+				instr.writeBranch(arch, w, labels)
+				continue
+			}
 		}
-		lengths = []int{
-			4,
-			1,
+
+		translate := tryTranslate
+		if hasDelaySlots && i > 0 && slotter.hasDelaySlot(instrs[i-1]) {
+			// The Go assembler fills the delay slot of any branch it knows about with a NOP, so a branch
+			// and the instruction in it's delay slot must stay exactly as they are, otherwise the native
+			// delay slot would be executed after the branch is taken
+			fmt.Fprintln(w, "    // branch delay slot")
+			translate = false
+		} else if hasDelaySlots && slotter.hasDelaySlot(instr) {
+			translate = false
 		}
-	} else {
+
+		err := instr.WriteOutput(arch, w, translate)
+		if err != nil {
+			return err
+		}
+	}
+
+	// branches to the end of the function go to the RET that follows it
+	if useLabels {
+		last := instrs[len(instrs)-1]
+		if label, ok := labels[last.Address+uint64(len(last.Bytes))]; ok {
+			fmt.Fprintf(w, "%s:\n", label)
+		}
+	}
+
+	return nil
+}
+
+// WriteSummary writes out a comment with how many of the instructions of a function were translated and how many
+// were written out as raw bytes, split up by the instruction set extensions on arm (i.e. VFP and NEON)
+func WriteSummary(arch string, w io.Writer, instrs []MachineInstruction, tryTranslate bool) {
+	_, useLabels := branchLabels(arch, instrs)
+
+	counts := make(map[string]int)
+	var classes []string
+	for _, instr := range instrs {
+		class := instr.summaryClass(arch, tryTranslate, useLabels)
+		if counts[class] == 0 {
+			classes = append(classes, class)
+		}
+		counts[class]++
+	}
+
+	summary := make([]string, 0, len(classes))
+	for _, class := range classes {
+		summary = append(summary, fmt.Sprintf("%d %s", counts[class], class))
+	}
+	fmt.Fprintf(w, "    // summary: %s\n", strings.Join(summary, ", "))
+}
+
+// summaryClass returns the class of the instruction for WriteSummary
+func (instr MachineInstruction) summaryClass(arch string, tryTranslate, useLabels bool) string {
+	backend, _ := Backend(arch)
+	translated := instr.SymbolReference != "" || instr.InReference || instr.JumpTable != nil
+	_, hasDelaySlots := backend.(delaySlotter)
+	if tryTranslate && !instr.KeepBytes && !hasDelaySlots && !translated {
+		_, translated = instr.Translation(arch)
+		if useLabels && instr.movesWithLabels(arch) {
+			if kind, _, _ := instr.branch(arch, noSymbols); kind == labelBranch {
+				translated = true
+			}
+		}
+	}
+	class := "raw"
+	if translated {
+		class = "translated"
+	}
+	if instr.Data {
+		return "data"
+	}
+
+	if classifier, ok := backend.(instructionClassifier); ok {
+		return classifier.summaryClass(instr, class)
+	}
+	return class
+}
+
+func reverseEndianness(byteSlice []byte) {
+	for i, j := 0, len(byteSlice)-1; i < j; i, j = i+1, j-1 {
+		byteSlice[i], byteSlice[j] = byteSlice[j], byteSlice[i]
+	}
+}
+
+func (instr MachineInstruction) writePlan9Unsupported(arch string, w io.Writer) error {
+	backend, ok := Backend(arch)
+	if !ok {
 		// unsupported architecture, unsure what to do, so fail
 		return fmt.Errorf("unsupported architecture: %s", arch)
 	}
 
-	// Iterate over the various lengths to insert, inserting as many of the bytes as we can
+	// Iterate over the various directives to insert, inserting as many of the bytes as we can
 	// for each size
-	opcodes := instr.Bytes
-	for i, byteLen := range lengths {
+	// The directives are written in the byte order Go uses for arch, so the bytes are taken in the order they are
+	// in memory and reversed when that is little endian, which puts the same bytes into memory whatever the byte
+	// order of the object or the way objdump shows them, except for the instructions of big endian arm and arm64
+	// objects, see isBE8
+	opcodes := instr.MemoryBytes(arch)
+	if instr.isBE8(arch) && !instr.Data {
+		opcodes = instr.littleEndianBytes(arch)
+	}
+	for _, directive := range backend.Directives() {
 		// While we have more opcodes than the current size, add that size
-		for len(opcodes) >= byteLen {
-			// This trick let's us use the variadic argument to Fprintf - we put all of
-			// the opcodes into a []interface{}, rather than use the []byte directly
-			// Note that using the []byte directly doesn't work because you can't cast a []type
-			// into an []interface{} without looping over each element of the []type, casting each
-			// element into an interface{} because an interface{} contains more than just the underlying
-			// object
-			args := make([]interface{}, byteLen)
-			for i, opcode := range opcodes[:byteLen] {
-				args[i] = opcode
-			}
-			// For some reason the plan9 assembler puts down data for 32 bit architectures in the order they appear
-			// but for 64-bit architecture's swaps the endianness, so for 64-bit we need to reverse the endianness of the bytes
-			// them into the array
-			// TODO: apparently amd64 is the only architecture that needs it's bytes reversed? Should investigate...
-			// arm64 doesn't need it's bytes reversed here
-			if arch == "amd64" {
-				for i, j := 0, len(args)-1; i < j; i, j = i+1, j-1 {
-					args[i], args[j] = args[j], args[i]
-				}
+		for len(opcodes) >= directive.Size {
+			value := make([]byte, directive.Size)
+			copy(value, opcodes)
+			if backend.ByteOrder() == binary.LittleEndian {
+				reverseEndianness(value)
 			}
-
-			fmt.Fprintf(w, prefixes[i], args...)
+			fmt.Fprintf(w, "%s $0x%x; \t", directive.Name, value)
 
 			// Drop these bytes for next time
-			opcodes = opcodes[byteLen:]
+			opcodes = opcodes[directive.Size:]
 		}
 	}
 
@@ -266,38 +569,9 @@ func (instr MachineInstruction) writePlan9Unsupported(arch string, w io.Writer)
 }
 
 func (instr MachineInstruction) writePlan9Supported(arch string, w io.Writer) error {
-	switch arch {
-	case "arm":
-		// the arm decoder expects the bytes in little endian
-		instrBytes := make([]byte, len(instr.Bytes))
-		copy(instrBytes, instr.Bytes)
-		reverseEndianness(instrBytes)
-		// to translate this machine instruction into plan9 assembly, first see if it can be decoded
-		goInstr, err := armasm.Decode(instrBytes, armasm.ModeARM)
-		if err != nil {
-			// Then we couldn't decode this instruction and we should
-			// use the WORD method
-			return fmt.Errorf(unrecognizedInstr, instr.Command)
-		}
-
-		fmt.Fprintf(w, "%s \t", armasm.GoSyntax(goInstr, instr.Address, nil, nil))
-	case "arm64":
-		// the arm decoder expects the bytes in little endian
-		instrBytes := make([]byte, len(instr.Bytes))
-		copy(instrBytes, instr.Bytes)
-		reverseEndianness(instrBytes)
-		// to translate this machine instruction into plan9 assembly, first see if it can be decoded
-		goInstr, err := arm64asm.Decode(instrBytes)
-		if err != nil {
-			// Then we couldn't decode this instruction and we should
-			// use the WORD method
-			return fmt.Errorf(unrecognizedInstr, instr.Command)
-		}
-
-		fmt.Fprintf(w, "%s \t", arm64asm.GoSyntax(goInstr, instr.Address, nil, nil))
-	default:
+	backend, ok := Backend(arch)
+	if !ok {
 		return fmt.Errorf(unsupportedArch, arch)
 	}
-
-	return nil
+	return backend.Translate(instr, w)
 }
@@ -2,6 +2,7 @@ package assembler
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"regexp"
 	"strings"
@@ -53,6 +54,49 @@ func TestInstructionFormatHex(t *testing.T) {
 			nil,
 			"WORD $0xf42007dd; // vld1.64 {d0} [r0 :64]!",
 		},
+		// VFP instructions
+		{MachineInstruction{
+			Command:   "vadd.f64",
+			Arguments: []string{"d0", "d1", "d2"},
+		},
+			"ee310b02",
+			"arm",
+			true,
+			nil,
+			"ADDD F2, F1, F0 // vadd.f64 d0 d1 d2",
+		},
+		{MachineInstruction{
+			Command:   "vldr",
+			Arguments: []string{"d0", "[r0", "#8]"},
+		},
+			"ed900b02",
+			"arm",
+			true,
+			nil,
+			"MOVD 0x8(R0), F0 // vldr d0 [r0 #8]",
+		},
+		// the Go assembler can only name the even single precision registers
+		{MachineInstruction{
+			Command:   "vadd.f32",
+			Arguments: []string{"s0", "s1", "s2"},
+		},
+			"ee300a81",
+			"arm",
+			true,
+			nil,
+			"WORD $0xee300a81; // vadd.f32 s0 s1 s2",
+		},
+		// the Go assembler follows comparisons with a vmrs
+		{MachineInstruction{
+			Command:   "vcmp.f64",
+			Arguments: []string{"d0", "d1"},
+		},
+			"eeb40b41",
+			"arm",
+			true,
+			nil,
+			"WORD $0xeeb40b41; // vcmp.f64 d0 d1",
+		},
 		{MachineInstruction{
 			Command:   "vld1.64",
 			Arguments: []string{"{d0}", "[r0 :64]! "},
@@ -85,6 +129,417 @@ func TestInstructionFormatHex(t *testing.T) {
 			nil,
 			"MOVD 8(RSP), R0 // ldr x0 [sp #8]",
 		},
+		// ASIMD and crypto instructions
+		{MachineInstruction{
+			Command:   "eor",
+			Arguments: []string{"v0.16b", "v19.16b", "v25.16b"},
+		},
+			"6e391e60",
+			"arm64",
+			true,
+			nil,
+			"VEOR V25.B16, V19.B16, V0.B16 // eor v0.16b v19.16b v25.16b",
+		},
+		{MachineInstruction{
+			Command:   "st4",
+			Arguments: []string{"{v19.2d-v22.2d}", "[x0]", "#64"},
+		},
+			"4c9f0c13",
+			"arm64",
+			true,
+			nil,
+			"VST4.P [V19.D2, V20.D2, V21.D2, V22.D2], 64(R0) // st4 {v19.2d-v22.2d} [x0] #64",
+		},
+		{MachineInstruction{
+			Command:   "ld4",
+			Arguments: []string{"{v0.4s-v3.4s}", "[x0]", "x1"},
+		},
+			"4cc10800",
+			"arm64",
+			true,
+			nil,
+			"VLD4.P (R0)(R1), [V0.S4, V1.S4, V2.S4, V3.S4] // ld4 {v0.4s-v3.4s} [x0] x1",
+		},
+		{MachineInstruction{
+			Command:   "fcmeq",
+			Arguments: []string{"v3.4s", "v2.4s", "#0.0"},
+		},
+			"4ea0d843",
+			"arm64",
+			true,
+			nil,
+			"VFCMEQ $(0.0), V2.S4, V3.S4 // fcmeq v3.4s v2.4s #0.0",
+		},
+		{MachineInstruction{
+			Command:   "aese",
+			Arguments: []string{"v0.16b", "v1.16b"},
+		},
+			"4e284820",
+			"arm64",
+			true,
+			nil,
+			"AESE V1.B16, V0.B16 // aese v0.16b v1.16b",
+		},
+		// the Go assembler only has MOVI for bytes
+		{MachineInstruction{
+			Command:   "movi",
+			Arguments: []string{"v16.2d", "#0x0"},
+		},
+			"6f00e410",
+			"arm64",
+			true,
+			nil,
+			"WORD $0x6f00e410; // movi v16.2d #0x0",
+		},
+
+		// AMD64 tests
+		{MachineInstruction{
+			Command:   "mov",
+			Arguments: []string{"%rsp", "%rbp"},
+		},
+			"4889e5",
+			"amd64",
+			false,
+			nil,
+			"WORD $0x8948; BYTE $0xe5; // mov %rsp %rbp",
+		},
+		{MachineInstruction{
+			Command:   "mov",
+			Arguments: []string{"%rsp", "%rbp"},
+		},
+			"4889e5",
+			"amd64",
+			true,
+			nil,
+			"MOVQ SP, BP // mov %rsp %rbp",
+		},
+		{MachineInstruction{
+			Command:   "mov",
+			Arguments: []string{"%edi", "-0x4(%rbp)"},
+		},
+			"897dfc",
+			"amd64",
+			true,
+			nil,
+			"MOVL DI, -0x4(BP) // mov %edi -0x4(%rbp)",
+		},
+		// displacement forced to 32-bits by a relocation, which the Go assembler would shorten
+		{MachineInstruction{
+			Command:   "mov",
+			Arguments: []string{"0x0(%rbx)", "%eax"},
+		},
+			"8b8300000000",
+			"amd64",
+			true,
+			nil,
+			"LONG $0x0000838b; WORD $0x0000; // mov 0x0(%rbx) %eax",
+		},
+		// relative branches can't be translated
+		{MachineInstruction{
+			Command:   "call",
+			Arguments: []string{"5"},
+		},
+			"e800000000",
+			"amd64",
+			true,
+			nil,
+			"LONG $0x000000e8; BYTE $0x00; // call 5",
+		},
+		// the Go assembler picks its own encoding for 64-bit immediate moves
+		{MachineInstruction{
+			Command:   "mov",
+			Arguments: []string{"$0x1", "%rax"},
+		},
+			"48c7c001000000",
+			"amd64",
+			true,
+			nil,
+			"LONG $0x01c0c748; WORD $0x0000; BYTE $0x00; // mov $0x1 %rax",
+		},
+
+		// 386 tests
+		{MachineInstruction{
+			Command:   "mov",
+			Arguments: []string{"0x4(%esp)", "%edx"},
+		},
+			"8b542404",
+			"386",
+			false,
+			nil,
+			"LONG $0x0424548b; // mov 0x4(%esp) %edx",
+		},
+		{MachineInstruction{
+			Command:   "mov",
+			Arguments: []string{"0x4(%esp)", "%edx"},
+		},
+			"8b542404",
+			"386",
+			true,
+			nil,
+			"MOVL 0x4(SP), DX // mov 0x4(%esp) %edx",
+		},
+		{MachineInstruction{
+			Command:   "mov",
+			Arguments: []string{"%ecx", "%eax"},
+		},
+			"89c8",
+			"386",
+			false,
+			nil,
+			"WORD $0xc889; // mov %ecx %eax",
+		},
+		// calls to the PC thunks are always rewritten
+		{MachineInstruction{
+			Command:   "call",
+			Arguments: []string{"1 <GetPC+0x1>"},
+			Relocations: []Relocation{
+				{Address: 1, Type: "R_386_PC32", Symbol: "__x86.get_pc_thunk.cx"},
+			},
+		},
+			"e8fcffffff",
+			"386",
+			false,
+			nil,
+			"CALL x86_get_pc_thunk_cx<>(SB) // call 1 <GetPC+0x1>",
+		},
+		{MachineInstruction{
+			Command:   "call",
+			Arguments: []string{"10 <__x86.get_pc_thunk.bx>"},
+		},
+			"e80b000000",
+			"386",
+			true,
+			nil,
+			"CALL x86_get_pc_thunk_bx<>(SB) // call 10 <__x86.get_pc_thunk.bx>",
+		},
+
+		// PPC64 tests
+		// objdump shows the bytes in memory order, so little endian needs them reversed
+		{MachineInstruction{
+			Command:   "mflr",
+			Arguments: []string{"r0"},
+		},
+			"a602087c",
+			"ppc64le",
+			false,
+			nil,
+			"WORD $0x7c0802a6; // mflr r0",
+		},
+		{MachineInstruction{
+			Command:   "mflr",
+			Arguments: []string{"r0"},
+		},
+			"7c0802a6",
+			"ppc64",
+			false,
+			nil,
+			"WORD $0x7c0802a6; // mflr r0",
+		},
+		{MachineInstruction{
+			Command:   "mflr",
+			Arguments: []string{"r0"},
+		},
+			"a602087c",
+			"ppc64le",
+			true,
+			nil,
+			"MOVD LR,R0 // mflr r0",
+		},
+		{MachineInstruction{
+			Command:   "ld",
+			Arguments: []string{"r5", "16(r3)"},
+		},
+			"e8a30010",
+			"ppc64",
+			true,
+			nil,
+			"MOVD 16(R3),R5 // ld r5 16(r3)",
+		},
+		// the disassembler puts the immediate in the wrong place for the Go assembler
+		{MachineInstruction{
+			Command:   "addi",
+			Arguments: []string{"r3", "r3", "1"},
+		},
+			"01006338",
+			"ppc64le",
+			true,
+			nil,
+			"WORD $0x38630001; // addi r3 r3 1",
+		},
+		// branches are never translated
+		{MachineInstruction{
+			Command:   "b",
+			Arguments: []string{"0x8"},
+		},
+			"08000048",
+			"ppc64le",
+			true,
+			nil,
+			"WORD $0x48000008; // b 0x8",
+		},
+
+		// MIPS tests
+		// objdump shows MIPS instructions as a 32-bit value for both byte orders
+		{MachineInstruction{
+			Command:   "addiu",
+			Arguments: []string{"sp", "sp", "-32"},
+		},
+			"27bdffe0",
+			"mips",
+			true,
+			nil,
+			"WORD $0x27bdffe0; // addiu sp sp -32",
+		},
+		{MachineInstruction{
+			Command:   "addiu",
+			Arguments: []string{"sp", "sp", "-32"},
+		},
+			"27bdffe0",
+			"mipsle",
+			true,
+			nil,
+			"WORD $0x27bdffe0; // addiu sp sp -32",
+		},
+		{MachineInstruction{
+			Command:   "daddu",
+			Arguments: []string{"v0", "a0", "a1"},
+		},
+			"0085102d",
+			"mips64le",
+			false,
+			nil,
+			"WORD $0x0085102d; // daddu v0 a0 a1",
+		},
+		// a little endian object written out for big endian mips
+		{MachineInstruction{
+			Command:         "addiu",
+			Arguments:       []string{"sp", "sp", "-32"},
+			BytesEndianness: binary.LittleEndian,
+		},
+			"27bdffe0",
+			"mips",
+			false,
+			nil,
+			"WORD $0xe0ffbd27; // addiu sp sp -32",
+		},
+
+		// S390X tests
+		{MachineInstruction{
+			Command:   "stmg",
+			Arguments: []string{"%r6", "%r15", "48(%r15)"},
+		},
+			"eb6ff0300024",
+			"s390x",
+			true,
+			nil,
+			"WORD $0xeb6ff030; BYTE $0x00; BYTE $0x24; // stmg %r6 %r15 48(%r15)",
+		},
+		{MachineInstruction{
+			Command:   "aghi",
+			Arguments: []string{"%r15", "-160"},
+		},
+			"a7fbff60",
+			"s390x",
+			false,
+			nil,
+			"WORD $0xa7fbff60; // aghi %r15 -160",
+		},
+		{MachineInstruction{
+			Command:   "br",
+			Arguments: []string{"%r14"},
+		},
+			"07fe",
+			"s390x",
+			false,
+			nil,
+			"BYTE $0x07; BYTE $0xfe; // br %r14",
+		},
+
+		// LOONG64 tests
+		{MachineInstruction{
+			Command:   "addi.d",
+			Arguments: []string{"$sp", "$sp", "-16"},
+		},
+			"02ffc063",
+			"loong64",
+			true,
+			nil,
+			"ADDV $-16, R3 // addi.d $sp $sp -16",
+		},
+		{MachineInstruction{
+			Command:   "addi.d",
+			Arguments: []string{"$sp", "$sp", "-16"},
+		},
+			"02ffc063",
+			"loong64",
+			false,
+			nil,
+			"WORD $0x02ffc063; // addi.d $sp $sp -16",
+		},
+		{MachineInstruction{
+			// $fp is the g register in Go
+			Command:   "move",
+			Arguments: []string{"$a0", "$fp"},
+		},
+			"001502c4",
+			"loong64",
+			true,
+			nil,
+			"WORD $0x001502c4; // move $a0 $fp",
+		},
+		{MachineInstruction{
+			Command: "ret",
+		},
+			"4c000020",
+			"loong64",
+			true,
+			nil,
+			"WORD $0x4c000020; // ret",
+		},
+
+		// RISCV64 tests
+		{MachineInstruction{
+			Command:   "mul",
+			Arguments: []string{"a0", "a0", "a1"},
+		},
+			"02b50533",
+			"riscv64",
+			true,
+			nil,
+			"MUL X11, X10, X10 // mul a0 a0 a1",
+		},
+		{MachineInstruction{
+			Command:   "mul",
+			Arguments: []string{"a0", "a0", "a1"},
+		},
+			"02b50533",
+			"riscv64",
+			false,
+			nil,
+			"WORD $0x02b50533; // mul a0 a0 a1",
+		},
+		{MachineInstruction{
+			// the Go assembler would compress this one
+			Command:   "add",
+			Arguments: []string{"a0", "a0", "a1"},
+		},
+			"00b50533",
+			"riscv64",
+			true,
+			nil,
+			"WORD $0x00b50533; // add a0 a0 a1",
+		},
+		{MachineInstruction{
+			// gas uses the dynamic rounding mode, which the Go assembler doesn't
+			Command:   "fadd.d",
+			Arguments: []string{"fa0", "fa0", "fa1"},
+		},
+			"02b57553",
+			"riscv64",
+			true,
+			nil,
+			"WORD $0x02b57553; // fadd.d fa0 fa0 fa1",
+		},
 	}
 
 	// Parse all of the hex strings into the actual byte arrays
@@ -122,3 +577,149 @@ func adjustWhitespace(s string) string {
 		return r
 	}, innerReplace))
 }
+
+func TestArchForByteOrder(t *testing.T) {
+	tt := []struct {
+		arch  string
+		order binary.ByteOrder
+		want  string
+	}{
+		{"mips", binary.LittleEndian, "mipsle"},
+		{"mipsle", binary.LittleEndian, "mipsle"},
+		{"mips64le", binary.BigEndian, "mips64"},
+		{"ppc64le", binary.BigEndian, "ppc64"},
+		{"ppc64", nil, "ppc64"},
+		{"arm", binary.BigEndian, "arm"},
+	}
+	for _, test := range tt {
+		if got := ArchForByteOrder(test.arch, test.order); got != test.want {
+			t.Errorf("Unable to find architecture for %s in byte order %v, got: %s want: %s.", test.arch, test.order, got, test.want)
+		}
+	}
+}
+
+func TestWriteInstructionsData(t *testing.T) {
+	tt := []struct {
+		arch   string
+		instrs []MachineInstruction
+		want   string
+	}{
+		{
+			// the literal pool holds the encoding of the nop used for padding before ARMv6K, which is neither
+			// translated nor taken for padding
+			"arm",
+			[]MachineInstruction{
+				{Address: 0x0, Command: "mov", Arguments: []string{"r1", "r0"}, Bytes: []byte{0xe1, 0xa0, 0x10, 0x00}},
+				{Address: 0x4, Command: ".word", Arguments: []string{"0xe1a00000"}, Bytes: []byte{0xe1, 0xa0, 0x00, 0x00}, Data: true},
+			},
+			"MOVW R0, R1 // mov r1 r0 WORD $0xe1a00000; // data .word 0xe1a00000",
+		},
+		{
+			"arm64",
+			[]MachineInstruction{
+				{Address: 0x0, Command: "nop", Bytes: []byte{0xd5, 0x03, 0x20, 0x1f}},
+				{Address: 0x4, Command: ".word", Arguments: []string{"0x8b010000"}, Bytes: []byte{0x8b, 0x01, 0x00, 0x00}, Data: true},
+			},
+			"NOOP // nop WORD $0x8b010000; // data .word 0x8b010000",
+		},
+	}
+
+	for _, tc := range tt {
+		instrs, _ := AlignPadding(tc.arch, tc.instrs, LatestGoVersion, true)
+		var buf bytes.Buffer
+		if err := WriteInstructions(tc.arch, &buf, instrs, true); err != nil {
+			t.Errorf("Unable to write instructions with data for %s : %v", tc.arch, err)
+			continue
+		}
+		if got := adjustWhitespace(buf.String()); got != tc.want {
+			t.Errorf("Unable to write instructions with data for %s, got:\n%s\nwant:\n%s", tc.arch, got, tc.want)
+		}
+	}
+}
+
+func TestWriteInstructionsLabels(t *testing.T) {
+	tt := []struct {
+		arch   string
+		instrs []MachineInstruction
+		want   string
+	}{
+		{
+			"amd64",
+			[]MachineInstruction{
+				{Address: 0x0, Command: "test", Arguments: []string{"rdi", "rdi"}, Bytes: []byte{0x48, 0x85, 0xff}},
+				{Address: 0x3, Command: "je", Arguments: []string{"d"}, Bytes: []byte{0x74, 0x08}},
+				{Address: 0x5, Command: "inc", Arguments: []string{"rdi"}, Bytes: []byte{0x48, 0xff, 0xc7}},
+				{Address: 0x8, Command: "jmp", Arguments: []string{"0"}, Bytes: []byte{0xeb, 0xf6}},
+				{Address: 0xa, Command: "mov", Arguments: []string{"rax", "rdi"}, Bytes: []byte{0x48, 0x89, 0xf8}},
+			},
+			"L_0: TESTQ DI, DI // test rdi rdi JE L_d // je d INCQ DI // inc rdi JMP L_0 // jmp 0 MOVQ DI, AX // mov rax rdi L_d:",
+		},
+		{
+			"arm",
+			[]MachineInstruction{
+				{Address: 0x0, Command: "cmp", Arguments: []string{"r0", "#0"}, Bytes: []byte{0xe3, 0x50, 0x00, 0x00}},
+				{Address: 0x4, Command: "bne", Arguments: []string{"c"}, Bytes: []byte{0x1a, 0x00, 0x00, 0x00}},
+				{Address: 0x8, Command: "mov", Arguments: []string{"r0", "#1"}, Bytes: []byte{0xe3, 0xa0, 0x00, 0x01}},
+			},
+			"CMP $0, R0 // cmp r0 #0 B.NE L_c // bne c MOVW $1, R0 // mov r0 #1 L_c:",
+		},
+		{
+			"arm64",
+			[]MachineInstruction{
+				{Address: 0x0, Command: "cbz", Arguments: []string{"x0", "c"}, Bytes: []byte{0xb4, 0x00, 0x00, 0x60}},
+				{Address: 0x4, Command: "b.eq", Arguments: []string{"0"}, Bytes: []byte{0x54, 0xff, 0xff, 0xe0}},
+				{Address: 0x8, Command: "b", Arguments: []string{"4"}, Bytes: []byte{0x17, 0xff, 0xff, 0xff}},
+			},
+			"L_0: CBZ R0, L_c // cbz x0 c L_4: BEQ L_0 // b.eq 0 JMP L_4 // b 4 L_c:",
+		},
+		{
+			// a RIP-relative instruction can't be moved, so the branch is left alone too
+			"amd64",
+			[]MachineInstruction{
+				{Address: 0x0, Command: "je", Arguments: []string{"9"}, Bytes: []byte{0x74, 0x07}},
+				{Address: 0x2, Command: "lea", Arguments: []string{"rax", "[rip+0x0]"}, Bytes: []byte{0x48, 0x8d, 0x05, 0x00, 0x00, 0x00, 0x00}},
+			},
+			"WORD $0x0774; // je 9 LONG $0x00058d48; WORD $0x0000; BYTE $0x00; // lea rax [rip+0x0]",
+		},
+		{
+			// so is a PC-relative load
+			"arm",
+			[]MachineInstruction{
+				{Address: 0x0, Command: "b", Arguments: []string{"8"}, Bytes: []byte{0xea, 0x00, 0x00, 0x00}},
+				{Address: 0x4, Command: "ldr", Arguments: []string{"r0", "[pc", "#0]"}, Bytes: []byte{0xe5, 0x9f, 0x00, 0x00}},
+			},
+			"WORD $0xea000000; // b 8 WORD $0xe59f0000; // ldr r0 [pc #0]",
+		},
+	}
+	for _, test := range tt {
+		var buf bytes.Buffer
+		err := WriteInstructions(test.arch, &buf, test.instrs, true)
+		if got := adjustWhitespace(buf.String()); err != nil || got != test.want {
+			t.Errorf("Unable to write %s instructions with labels, got: (err=%v,\noutput=%s\n) want: (err=nil,\noutput=%s\n).", test.arch, err, got, test.want)
+		}
+	}
+}
+
+func TestWriteSummary(t *testing.T) {
+	instrs := []MachineInstruction{
+		{Command: "mov", Arguments: []string{"r2", "lr"}, Bytes: []byte{0xe1, 0xa0, 0x20, 0x0e}},
+		{Command: "vadd.f64", Arguments: []string{"d0", "d1", "d2"}, Bytes: []byte{0xee, 0x31, 0x0b, 0x02}},
+		{Command: "vadd.f32", Arguments: []string{"s0", "s1", "s2"}, Bytes: []byte{0xee, 0x30, 0x0a, 0x81}},
+		{Command: "vld1.64", Arguments: []string{"{d0}", "[r0 :64]!"}, Bytes: []byte{0xf4, 0x20, 0x07, 0xdd}},
+		{Command: "vadd.i32", Arguments: []string{"q0", "q1", "q2"}, Bytes: []byte{0xf2, 0x22, 0x08, 0x44}},
+	}
+	tt := []struct {
+		tryTranslate bool
+		want         string
+	}{
+		{true, "// summary: 1 core translated, 1 VFP translated, 1 VFP raw, 2 NEON raw"},
+		{false, "// summary: 1 core raw, 2 VFP raw, 2 NEON raw"},
+	}
+	for _, test := range tt {
+		var buf bytes.Buffer
+		WriteSummary("arm", &buf, instrs, test.tryTranslate)
+		if got := adjustWhitespace(buf.String()); got != test.want {
+			t.Errorf("Unable to write summary (tryTranslate=%t), got: %s want: %s.", test.tryTranslate, got, test.want)
+		}
+	}
+}
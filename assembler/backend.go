@@ -0,0 +1,136 @@
+package assembler
+
+import (
+	"encoding/binary"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Directive is a data directive of the Go assembler, used to write out instructions as their raw bytes
+type Directive struct {
+	// The name of the directive, i.e. "WORD"
+	Name string
+	// The number of bytes the directive puts into memory
+	Size int
+}
+
+// ArchBackend is what asm2go knows about one of the architectures Go supports, so that each architecture can be
+// implemented in a file of it's own, which registers the backend with RegisterBackend
+type ArchBackend interface {
+	// Arch returns the GOARCH the backend is for
+	Arch() string
+	// MinGoVersion returns the minor version of the first Go 1.x release which supports the architecture
+	MinGoVersion() int
+	// GNUTargets returns the substrings of the names of GNU cross assemblers (i.e. the target triplet used as the
+	// prefix) which assemble for the architecture, see BackendForGNUAssembler
+	GNUTargets() []string
+	// ByteOrder returns the byte order Go uses for the architecture, which the data directives are written in
+	ByteOrder() binary.ByteOrder
+	// ObjdumpShowsValues returns whether objdump shows the instructions as values, rather than as bytes in the
+	// order they are in memory
+	ObjdumpShowsValues() bool
+	// Directives returns the data directives the Go assembler has for the architecture, from largest to smallest
+	Directives() []Directive
+	// Translate decodes the instruction and writes it out in Go syntax, returning an unrecognizedInstr error if it
+	// can't be translated
+	Translate(instr MachineInstruction, w io.Writer) error
+	// IsPadding returns whether the instruction is one of the NOP's the assembler uses for alignment padding
+	IsPadding(instr MachineInstruction) bool
+	// PCAlign returns the alignments the PCALIGN directive of the Go assembler takes for the architecture, or
+	// false if it doesn't have PCALIGN
+	PCAlign() (PCAlignment, bool)
+	// TranslationNeedsVerification returns whether the translations can only be used after checking them with the
+	// Go assembler, see goasm.Verifier
+	TranslationNeedsVerification() bool
+}
+
+// PCAlignment is the range of alignments the PCALIGN directive of the Go assembler takes for an architecture
+type PCAlignment struct {
+	// The minor version of the first Go 1.x release known to accept PCALIGN
+	GoVersion int
+	// The smallest and largest alignments PCALIGN takes
+	Min, Max int
+}
+
+// branchAnalyzer is implemented by backends which can decode the branches of the architecture, which allows them to
+// be written out with labels, see WriteInstructions
+type branchAnalyzer interface {
+	// branch returns how the instruction depends on it's address, and for a labelBranch instruction, the address
+	// of the target and the instruction in Go syntax with the target named using symname
+	branch(instr MachineInstruction, symname func(uint64) (string, uint64)) (pcRelative, uint64, string)
+}
+
+// functionWriter is implemented by backends which have to write out the instructions of some functions together, as
+// they can't be written out one at a time, i.e. 2 byte instructions which are packed into WORD's, see
+// WriteInstructions
+type functionWriter interface {
+	// writesFunction returns whether the instructions of a function have to be written out with writeFunction,
+	// which keeps every instruction where it is, so the branches aren't written with labels
+	writesFunction(instrs []MachineInstruction) bool
+	writeFunction(w io.Writer, instrs []MachineInstruction, tryTranslate bool) error
+}
+
+// delaySlotter is implemented by backends of architectures with branch delay slots, which the Go assembler fills
+// itself for the branches it knows about, so the branches with a delay slot and the instructions in it are never
+// translated, and branches aren't written with labels, see WriteInstructions
+type delaySlotter interface {
+	// hasDelaySlot returns whether the instruction is a branch with a delay slot
+	hasDelaySlot(instr MachineInstruction) bool
+}
+
+// pcThunkCaller is implemented by backends of architectures where position independent code calls thunks to read
+// the PC, which are rewritten to call Go implementations of the thunks, see WritePCThunk
+type pcThunkCaller interface {
+	// pcThunkRegister returns the Go name of the register loaded by the PC thunk the instruction calls, if it's a
+	// call to one of the thunks
+	pcThunkRegister(instr MachineInstruction) (string, bool)
+	// checkPIC returns an error if the instruction is position independent code which can't be written in Go
+	checkPIC(instr MachineInstruction) error
+}
+
+// instructionClassifier is implemented by backends which split up the instructions further in the summary, see
+// WriteSummary
+type instructionClassifier interface {
+	// summaryClass returns the class of the instruction, given whether it's "translated" or "raw"
+	summaryClass(instr MachineInstruction, class string) string
+}
+
+var backends = make(map[string]ArchBackend)
+
+// RegisterBackend adds the backend for it's architecture, replacing any other backend for it
+func RegisterBackend(backend ArchBackend) {
+	backends[backend.Arch()] = backend
+}
+
+// Backend returns the backend for arch
+func Backend(arch string) (ArchBackend, bool) {
+	backend, ok := backends[arch]
+	return backend, ok
+}
+
+// Architectures returns the architectures with a backend, sorted by name
+func Architectures() []string {
+	archs := make([]string, 0, len(backends))
+	for arch := range backends {
+		archs = append(archs, arch)
+	}
+	sort.Strings(archs)
+	return archs
+}
+
+// BackendForGNUAssembler returns the backend for the architecture the GNU assembler with the specified name assembles
+// for, going by the longest of the GNU targets found in the name, as i.e. "powerpc64" is also in "powerpc64le"
+func BackendForGNUAssembler(name string) (ArchBackend, bool) {
+	var found ArchBackend
+	longest := 0
+	for _, backend := range backends {
+		for _, target := range backend.GNUTargets() {
+			if len(target) > longest && strings.Contains(name, target) {
+				found = backend
+				longest = len(target)
+			}
+		}
+	}
+	return found, found != nil
+}
@@ -0,0 +1,59 @@
+package assembler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBackends(t *testing.T) {
+	want := "386 amd64 arm arm64 loong64 mips mips64 mips64le mipsle ppc64 ppc64le riscv64 s390x"
+	if got := strings.Join(Architectures(), " "); got != want {
+		t.Errorf("Unable to find backends, got: %s want: %s.", got, want)
+	}
+
+	for _, arch := range Architectures() {
+		backend, _ := Backend(arch)
+		if backend.Arch() != arch {
+			t.Errorf("Backend registered for %s is for %s.", arch, backend.Arch())
+		}
+		// the directives are used from largest to smallest, so they have to be sorted that way
+		directives := backend.Directives()
+		for i := range directives {
+			if directives[i].Size <= 0 || (i > 0 && directives[i].Size >= directives[i-1].Size) {
+				t.Errorf("Directives of %s aren't sorted from largest to smallest: %v.", arch, directives)
+				break
+			}
+		}
+	}
+
+	if _, ok := Backend("wasm"); ok {
+		t.Errorf("Found a backend for wasm.")
+	}
+}
+
+func TestBackendForGNUAssembler(t *testing.T) {
+	tt := []struct {
+		name string
+		arch string
+	}{
+		{"armeb-linux-gnueabi-as", "arm"},
+		{"aarch64-linux-gnu-as", "arm64"},
+		{"i686-linux-gnu-as", "386"},
+		{"mipsel-linux-gnu-as", "mipsle"},
+		{"mips64el-linux-gnuabi64-as", "mips64le"},
+		{"mipsisa64r2el-linux-gnuabi64-as", "mips64le"},
+		{"mipsisa32r2-linux-gnu-as", "mips"},
+		{"powerpc64-linux-gnu-as", "ppc64"},
+		{"powerpc64le-linux-gnu-as", "ppc64le"},
+		{"as", ""},
+	}
+	for _, test := range tt {
+		arch := ""
+		if backend, ok := BackendForGNUAssembler(test.name); ok {
+			arch = backend.Arch()
+		}
+		if arch != test.arch {
+			t.Errorf("Unable to find backend for GNU assembler %s, got: %q want: %q.", test.name, arch, test.arch)
+		}
+	}
+}
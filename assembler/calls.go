@@ -0,0 +1,141 @@
+package assembler
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Function is a function of the object file along with the name of the Go symbol it's written out as, i.e. "·f" or
+// "helper<>" for a function without a Go declaration
+type Function struct {
+	Symbol
+	GoName string
+}
+
+// PrivateName returns the name of the file-private Go symbol for the symbol name, i.e. "helper<>", replacing any
+// characters Go doesn't allow in names (like the "." of ".LC0") with "_"
+func PrivateName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, name) + "<>"
+}
+
+// directCall is a call or jump to an address given in the instruction, which may be outside of the function it's in
+type directCall struct {
+	// call is whether it's a call rather than a jump
+	call bool
+	// conditional is whether it's a conditional jump, which Go assembly only has for labels
+	conditional bool
+	// target is the address it goes to in the object file, before any relocation for it is applied
+	target uint64
+	// resized is whether the Go assembler encodes it with a different number of bytes, i.e. a short jump on x86,
+	// as jumps to other symbols always get a 32-bit displacement
+	resized bool
+}
+
+// callAnalyzer is implemented by backends which can decode direct calls and jumps, see ResolveCalls
+type callAnalyzer interface {
+	// call returns the call or jump the instruction makes, or false if it isn't a direct call or jump
+	call(instr MachineInstruction) (directCall, bool)
+}
+
+// ResolveCalls sets the SymbolReference and Callee of every instruction of the function caller which calls or jumps
+// to another function of the object file, i.e. "CALL ·helper(SB)", as the Go linker lays out every function on it's
+// own, so the displacement in the bytes of the instruction no longer points at it
+// The function is found through the relocation of the instruction, or through the address the instruction goes to
+// for calls the assembler already resolved (to local functions in the same section)
+// It returns an error for calls and jumps out of the function which don't go to the start of one of the functions
+func ResolveCalls(arch string, instrs []MachineInstruction, caller Symbol, functions []Function) error {
+	backend, _ := Backend(arch)
+	analyzer, ok := backend.(callAnalyzer)
+	if !ok || len(instrs) == 0 {
+		return nil
+	}
+	last := instrs[len(instrs)-1]
+	start, end := instrs[0].Address, last.Address+uint64(len(last.Bytes))
+
+	var resized []MachineInstruction
+	for i, instr := range instrs {
+		if instr.isResolved(arch) || instr.Data || len(instr.Relocations) > 1 {
+			continue
+		}
+		call, ok := analyzer.call(instr)
+		if !ok {
+			continue
+		}
+
+		section, offset := caller.Section, call.target
+		if len(instr.Relocations) == 0 {
+			_, isFunction := findFunction(functions, caller.Section, call.target)
+			if call.target >= start && call.target < end || call.target == end && !isFunction {
+				// a branch inside of the function (or to it's end, where the RET is added), which is written with
+				// a label
+				continue
+			}
+		} else {
+			// the target the instruction has before relocation is the offset from the address the relocation is
+			// applied at, which the addend is relative to
+			reloc := instr.Relocations[0]
+			name, addend := reloc.target()
+			section, offset = name, uint64(addend+int64(call.target-reloc.Address))
+		}
+
+		f, ok := findFunction(functions, section, offset)
+		switch {
+		case !ok && len(instr.Relocations) == 0:
+			return fmt.Errorf("instruction \"%s\" at %#x goes to %#x in %s, which isn't the start of any function",
+				strings.TrimSpace(instr.InstructionString), instr.Address, call.target, caller.Section)
+		case !ok:
+			// i.e. an undefined symbol, see CheckRelocations
+			continue
+		case call.conditional:
+			return fmt.Errorf("instruction \"%s\" at %#x jumps to %s, but Go assembly only has unconditional jumps to other functions",
+				strings.TrimSpace(instr.InstructionString), instr.Address, f.Name)
+		}
+
+		op := "JMP"
+		if call.call {
+			op = "CALL"
+		}
+		instrs[i].SymbolReference = fmt.Sprintf("%s %s(SB)", op, f.GoName)
+		instrs[i].Callee = f.Name
+		if call.resized {
+			resized = append(resized, instrs[i])
+		}
+	}
+
+	// the instructions after a call which changes size move, which is only fine if the branches over it are written
+	// with labels
+	if _, ok := branchTargets(arch, instrs); !ok && len(resized) != 0 {
+		return fmt.Errorf("instruction \"%s\" at %#x to %s is encoded with a different size in Go assembly, and the branches of the function can't be written with labels to make up for it",
+			strings.TrimSpace(resized[0].InstructionString), resized[0].Address, resized[0].Callee)
+	}
+	return nil
+}
+
+// findFunction returns the function starting offset bytes into the symbol or section name
+func findFunction(functions []Function, name string, offset uint64) (Function, bool) {
+	for _, f := range functions {
+		if f.Name == name && offset == 0 || f.Section == name && f.ValueAddressField == offset {
+			return f, true
+		}
+	}
+	return Function{}, false
+}
+
+// TextFlags returns the flags for the TEXT directive of a function, which are NOSPLIT|NOFRAME if it calls or jumps to
+// other functions, so that the Go assembler doesn't add a prologue moving the stack pointer (as the native code
+// keeps track of the stack and the return address itself), or a stack check the runtime can't unwind the native
+// frames from
+func TextFlags(instrs []MachineInstruction) string {
+	for _, instr := range instrs {
+		if instr.Callee != "" {
+			return "NOSPLIT|NOFRAME"
+		}
+	}
+	return "0"
+}
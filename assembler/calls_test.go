@@ -0,0 +1,168 @@
+package assembler
+
+import (
+	"strings"
+	"testing"
+)
+
+// functions returns the functions of an object file with a global f calling a global g and a local h in the same
+// section, which the assembler resolves calls to itself
+func functions() []Function {
+	return []Function{
+		{Symbol{Name: "f", Section: ".text", ValueAddressField: 0x0, Global: true, Function: true}, "·f"},
+		{Symbol{Name: "g", Section: ".text", ValueAddressField: 0x1e, Global: true, Function: true}, "·g"},
+		{Symbol{Name: "h", Section: ".text", ValueAddressField: 0x24, Local: true, Function: true}, "·h"},
+	}
+}
+
+func TestResolveCalls(t *testing.T) {
+	tables := []struct {
+		name       string
+		arch       string
+		instrs     []MachineInstruction
+		references []string
+		err        string
+	}{
+		{
+			name: "amd64 calls",
+			arch: "amd64",
+			instrs: []MachineInstruction{
+				// call g with R_X86_64_PLT32 g-0x4
+				{Address: 0x5, Bytes: []byte{0xe8, 0, 0, 0, 0},
+					Relocations: []Relocation{{0x6, "R_X86_64_PLT32", "g-0x4"}}},
+				// call 24 <h>, which the assembler resolved
+				{Address: 0xa, Bytes: []byte{0xe8, 0x15, 0, 0, 0}},
+				// je 5 <f+0x5>, a branch inside of the function
+				{Address: 0xf, Bytes: []byte{0x74, 0xf4}},
+				{Address: 0x11, Bytes: []byte{0xc3}},
+			},
+			references: []string{"CALL ·g(SB)", "CALL ·h(SB)", "", ""},
+		},
+		{
+			name: "amd64 call of the function right after the caller",
+			arch: "amd64",
+			instrs: []MachineInstruction{
+				// call 1e <g>, where g starts right at the end of the caller
+				{Address: 0x14, Bytes: []byte{0xe8, 0x05, 0, 0, 0}},
+				{Address: 0x19, Bytes: []byte{0xc3}},
+				{Address: 0x1a, Bytes: []byte{0x66, 0x90}},
+				// jmp 1e <g>, the last instruction of the caller
+				{Address: 0x1c, Bytes: []byte{0xeb, 0x00}},
+			},
+			references: []string{"CALL ·g(SB)", "", "", "JMP ·g(SB)"},
+		},
+		{
+			name: "amd64 jump to the end of the function",
+			arch: "amd64",
+			instrs: []MachineInstruction{
+				// jmp 32, the end of the function, where no other function starts
+				{Address: 0x30, Bytes: []byte{0xeb, 0x00}},
+			},
+			references: []string{""},
+		},
+		{
+			name: "amd64 short jump",
+			arch: "amd64",
+			instrs: []MachineInstruction{
+				// jmp 24 <h>
+				{Address: 0x0, Bytes: []byte{0xeb, 0x22}},
+			},
+			references: []string{"JMP ·h(SB)"},
+		},
+		{
+			name: "amd64 short jump without labels",
+			arch: "amd64",
+			instrs: []MachineInstruction{
+				// lea 0x0(%rip),%rax
+				{Address: 0x0, Bytes: []byte{0x48, 0x8d, 0x05, 0, 0, 0, 0}},
+				{Address: 0x7, Bytes: []byte{0xeb, 0x1b}, InstructionString: "jmp 24 <h>"},
+			},
+			err: `instruction "jmp 24 <h>" at 0x7 to h is encoded with a different size in Go assembly`,
+		},
+		{
+			name: "amd64 conditional jump",
+			arch: "amd64",
+			instrs: []MachineInstruction{
+				{Address: 0x0, Bytes: []byte{0x74, 0x22}, InstructionString: "je 24 <h>"},
+			},
+			err: `instruction "je 24 <h>" at 0x0 jumps to h, but Go assembly only has unconditional jumps to other functions`,
+		},
+		{
+			name: "amd64 call into a function",
+			arch: "amd64",
+			instrs: []MachineInstruction{
+				{Address: 0x0, Bytes: []byte{0xe8, 0x20, 0, 0, 0}, InstructionString: "call 25 <h+0x1>"},
+			},
+			err: `instruction "call 25 <h+0x1>" at 0x0 goes to 0x25 in .text, which isn't the start of any function`,
+		},
+		{
+			name: "amd64 external call",
+			arch: "amd64",
+			instrs: []MachineInstruction{
+				{Address: 0x0, Bytes: []byte{0xe8, 0, 0, 0, 0},
+					Relocations: []Relocation{{0x1, "R_X86_64_PLT32", "memcpy-0x4"}}},
+			},
+			references: []string{""},
+		},
+		{
+			name: "arm64 calls",
+			arch: "arm64",
+			instrs: []MachineInstruction{
+				// bl 0 with R_AARCH64_CALL26 g
+				{Address: 0x0, Bytes: []byte{0x94, 0, 0, 0},
+					Relocations: []Relocation{{0x0, "R_AARCH64_CALL26", "g"}}},
+				// b 4 with R_AARCH64_JUMP26 g
+				{Address: 0x4, Bytes: []byte{0x14, 0, 0, 0},
+					Relocations: []Relocation{{0x4, "R_AARCH64_JUMP26", "g"}}},
+			},
+			references: []string{"CALL ·g(SB)", "JMP ·g(SB)"},
+		},
+		{
+			name: "arm calls",
+			arch: "arm",
+			instrs: []MachineInstruction{
+				// bl 24 <h>, which the assembler resolved
+				{Address: 0x4, Bytes: []byte{0xeb, 0x00, 0x00, 0x06}},
+				// b 8 with R_ARM_JUMP24 g, the addend being in the instruction
+				{Address: 0x8, Bytes: []byte{0xea, 0xff, 0xff, 0xfe},
+					Relocations: []Relocation{{0x8, "R_ARM_JUMP24", "g"}}},
+			},
+			references: []string{"CALL ·h(SB)", "JMP ·g(SB)"},
+		},
+	}
+
+	for _, table := range tables {
+		err := ResolveCalls(table.arch, table.instrs, functions()[0].Symbol, functions())
+		switch {
+		case table.err != "":
+			if err == nil || !strings.Contains(err.Error(), table.err) {
+				t.Errorf("Unable to reject calls in %s, got: (err=%v) want: (err=%s).", table.name, err, table.err)
+			}
+			continue
+		case err != nil:
+			t.Errorf("Unable to resolve calls in %s : %v", table.name, err)
+			continue
+		}
+		for i, instr := range table.instrs {
+			if instr.SymbolReference != table.references[i] {
+				t.Errorf("Unable to resolve call of instruction %d in %s, got: %q want: %q.", i, table.name, instr.SymbolReference, table.references[i])
+			}
+		}
+	}
+}
+
+func TestTextFlags(t *testing.T) {
+	tables := []struct {
+		instrs []MachineInstruction
+		flags  string
+	}{
+		{[]MachineInstruction{{Address: 0x0, Bytes: []byte{0xc3}}}, "0"},
+		{[]MachineInstruction{{Address: 0x0, Bytes: []byte{0xe8, 0x1f, 0, 0, 0}, SymbolReference: "CALL ·h(SB)", Callee: "h"}}, "NOSPLIT|NOFRAME"},
+	}
+
+	for _, table := range tables {
+		if flags := TextFlags(table.instrs); flags != table.flags {
+			t.Errorf("Unable to get the TEXT flags for %v, got: %s want: %s.", table.instrs, flags, table.flags)
+		}
+	}
+}
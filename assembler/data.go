@@ -0,0 +1,194 @@
+package assembler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// dataSections are the sections data symbols are found in, any section whose name starts with one of these followed
+// by a "." (i.e. ".rodata.cst16") is one of them too
+var dataSections = []string{".data", ".rodata", ".bss", ".sdata", ".srodata", ".sbss", "*COM*"}
+
+// bssSections are the data sections without contents, which are all zeroes when the program starts
+var bssSections = []string{".bss", ".sbss", "*COM*"}
+
+// readOnlySections are the data sections which are never written to
+var readOnlySections = []string{".rodata", ".srodata"}
+
+// inSections returns whether the section is one of sections, or a section with one of them as it's prefix
+func inSections(section string, sections []string) bool {
+	for _, name := range sections {
+		if section == name || strings.HasPrefix(section, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// IsData returns whether the symbol is in one of the data sections (.data, .rodata, .bss and their variants), or is
+// a common symbol, as these are written out as DATA and GLOBL directives rather than as functions
+func (s Symbol) IsData() bool {
+	return inSections(s.Section, dataSections)
+}
+
+// DataSymbol is a symbol in one of the data sections of an object file, along with it's contents
+type DataSymbol struct {
+	Symbol
+	// The contents of the symbol, which are all zeroes for symbols in .bss
+	Bytes []byte
+}
+
+// GoName returns the name of the file-private Go symbol for the data, i.e. "K<>", see PrivateName
+func (d DataSymbol) GoName() string {
+	return PrivateName(d.Name)
+}
+
+// flags returns the flags for the GLOBL directive of the data, none of which contain Go pointers
+func (d DataSymbol) flags() string {
+	if inSections(d.Section, readOnlySections) {
+		return "RODATA|NOPTR"
+	}
+	return "NOPTR"
+}
+
+// WriteData writes out the data symbol with a DATA directive for each piece of it's contents and a GLOBL directive
+// declaring it, i.e. "DATA K<>+0(SB)/8, $0x0000000000000001"
+// The values are written in the byte order Go uses for arch, so that the bytes end up in memory in the same order
+// as in the object file, the same as for instructions
+func WriteData(arch string, w io.Writer, d DataSymbol) {
+	order := ByteOrder(arch)
+	if !inSections(d.Section, bssSections) {
+		for offset := 0; offset < len(d.Bytes); {
+			// use the largest size that fits into what's left, and that the offset is aligned to
+			size := 8
+			for size > len(d.Bytes)-offset || offset%size != 0 {
+				size /= 2
+			}
+			value := directiveValue(order, d.Bytes[offset:offset+size])
+			fmt.Fprintf(w, "DATA %s+%d(SB)/%d, $0x%0*x\n", d.GoName(), offset, size, size*2, value)
+			offset += size
+		}
+	}
+	fmt.Fprintf(w, "GLOBL %s(SB), %s, $%d\n", d.GoName(), d.flags(), len(d.Bytes))
+}
+
+// directiveValue returns the value a directive has to have to put the bytes into memory, the reverse of
+// directiveBytes
+func directiveValue(order binary.ByteOrder, b []byte) uint64 {
+	switch len(b) {
+	case 8:
+		return order.Uint64(b)
+	case 4:
+		return uint64(order.Uint32(b))
+	case 2:
+		return uint64(order.Uint16(b))
+	}
+	return uint64(b[0])
+}
+
+// dataReferences looks up the Go symbols for references to the data symbols of an object file, which are either
+// to the symbol itself, or to the section it's in (as the assembler refers to local symbols through their section)
+type dataReferences struct {
+	byName    map[string]DataSymbol
+	bySection map[string][]DataSymbol
+}
+
+func newDataReferences(data []DataSymbol) dataReferences {
+	refs := dataReferences{
+		byName:    make(map[string]DataSymbol),
+		bySection: make(map[string][]DataSymbol),
+	}
+	for _, d := range data {
+		refs.byName[d.Name] = d
+		refs.bySection[d.Section] = append(refs.bySection[d.Section], d)
+	}
+	return refs
+}
+
+// isData returns whether name is one of the data symbols, or a section with data symbols in it
+func (refs dataReferences) isData(name string) bool {
+	_, symbol := refs.byName[name]
+	_, section := refs.bySection[name]
+	return symbol || section
+}
+
+// reference returns the reference to offset bytes into the data symbol or section name in Go syntax, i.e.
+// "K<>+8(SB)", or false if that isn't inside of any data symbol
+func (refs dataReferences) reference(name string, offset int64) (string, bool) {
+	if d, ok := refs.byName[name]; ok {
+		return goReference(d.GoName(), offset), true
+	}
+	// the end of a symbol is counted as part of it too, as it's often referred to as well, unless another symbol
+	// starts there
+	end := ""
+	for _, d := range refs.bySection[name] {
+		start := int64(d.ValueAddressField)
+		switch {
+		case offset >= start && offset < start+int64(len(d.Bytes)):
+			return goReference(d.GoName(), offset-start), true
+		case offset == start+int64(len(d.Bytes)):
+			end = goReference(d.GoName(), offset-start)
+		}
+	}
+	return end, end != ""
+}
+
+// goReference returns the reference to offset bytes into the Go symbol name, i.e. "K<>+8(SB)"
+func goReference(name string, offset int64) string {
+	if offset == 0 {
+		return name + "(SB)"
+	}
+	return fmt.Sprintf("%s%+d(SB)", name, offset)
+}
+
+// referenceResolver is implemented by backends which can rewrite instructions referring to data symbols through
+// their relocations, see ResolveDataReferences
+type referenceResolver interface {
+	// resolveReferences sets the SymbolReference of the instructions referring to one of the data symbols
+	resolveReferences(instrs []MachineInstruction, refs dataReferences) error
+}
+
+// ResolveDataReferences sets the SymbolReference of every instruction of a function which refers to one of the data
+// symbols through it's relocations, so that it's written out referring to the Go symbol for the data rather than
+// with the placeholder the assembler left for the linker
+// It returns an error for any reference to the data which can't be rewritten, as it wouldn't point anywhere
+func ResolveDataReferences(arch string, instrs []MachineInstruction, data []DataSymbol) error {
+	refs := newDataReferences(data)
+	backend, _ := Backend(arch)
+	if resolver, ok := backend.(referenceResolver); ok {
+		if err := resolver.resolveReferences(instrs, refs); err != nil {
+			return err
+		}
+	}
+
+	for _, instr := range instrs {
+		if instr.SymbolReference != "" || instr.InReference || instr.JumpTable != nil {
+			continue
+		}
+		for _, reloc := range instr.Relocations {
+			if name, _ := reloc.target(); refs.isData(name) {
+				return instr.referenceError(reloc, "it can't be rewritten into a Go symbol reference on "+arch)
+			}
+		}
+	}
+	return nil
+}
+
+// hasRelocation returns whether the instruction has a relocation of the type for the symbol, as reported by the
+// assembler
+func (instr MachineInstruction) hasRelocation(relocType, symbol string) bool {
+	for _, reloc := range instr.Relocations {
+		if reloc.Type == relocType && reloc.Symbol == symbol {
+			return true
+		}
+	}
+	return false
+}
+
+// referenceError returns an error for the relocation of the instruction which can't be rewritten because of reason
+func (instr MachineInstruction) referenceError(reloc Relocation, reason string) error {
+	return fmt.Errorf("instruction \"%s\" at %#x refers to %s through %s, but %s",
+		strings.TrimSpace(instr.InstructionString), instr.Address, reloc.Symbol, reloc.Type, reason)
+}
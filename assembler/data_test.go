@@ -0,0 +1,185 @@
+package assembler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// dataSymbols returns data symbols as they are found in an object file with a local constant table in .rodata (which
+// references go through the section), a global in .data and a buffer in .bss
+func dataSymbols() []DataSymbol {
+	return []DataSymbol{
+		{Symbol{Name: "K", Section: ".rodata", ValueAddressField: 0x0}, []byte{1, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0}},
+		{Symbol{Name: "T", Section: ".rodata", ValueAddressField: 0x10, Object: true}, []byte{5, 0, 0, 0}},
+		{Symbol{Name: "G", Section: ".data", Global: true, Object: true}, []byte{7, 0}},
+		{Symbol{Name: ".Lbuf", Section: ".bss"}, make([]byte, 16)},
+	}
+}
+
+func TestIsData(t *testing.T) {
+	tables := []struct {
+		section string
+		data    bool
+	}{
+		{".data", true},
+		{".rodata", true},
+		{".rodata.cst16", true},
+		{".bss", true},
+		{"*COM*", true},
+		{".text", false},
+		{".datax", false},
+		{"*UND*", false},
+	}
+
+	for _, table := range tables {
+		if data := (Symbol{Section: table.section}).IsData(); data != table.data {
+			t.Errorf("Unable to tell whether a symbol in %s is data, got: %t want: %t.", table.section, data, table.data)
+		}
+	}
+}
+
+func TestWriteData(t *testing.T) {
+	tables := []struct {
+		arch   string
+		data   DataSymbol
+		output string
+	}{
+		{"amd64", dataSymbols()[0],
+			"DATA K<>+0(SB)/8, $0x0000000000000001\n" +
+				"DATA K<>+8(SB)/4, $0x00000002\n" +
+				"GLOBL K<>(SB), RODATA|NOPTR, $12\n"},
+		{"ppc64", dataSymbols()[2],
+			"DATA G<>+0(SB)/2, $0x0700\n" +
+				"GLOBL G<>(SB), NOPTR, $2\n"},
+		{"arm64", dataSymbols()[3],
+			"GLOBL _Lbuf<>(SB), NOPTR, $16\n"},
+	}
+
+	for _, table := range tables {
+		var buf bytes.Buffer
+		WriteData(table.arch, &buf, table.data)
+		if buf.String() != table.output {
+			t.Errorf("Unable to write data symbol %s for %s, got:\n%s\nwant:\n%s", table.data.Name, table.arch, buf.String(), table.output)
+		}
+	}
+}
+
+func TestResolveDataReferences(t *testing.T) {
+	tables := []struct {
+		name       string
+		arch       string
+		instrs     []MachineInstruction
+		references []string
+		err        string
+	}{
+		{
+			name: "amd64 RIP-relative",
+			arch: "amd64",
+			instrs: []MachineInstruction{
+				// lea 0x0(%rip),%rax with R_X86_64_PC32 .rodata-0x4
+				{Address: 0x0, Bytes: []byte{0x48, 0x8d, 0x05, 0, 0, 0, 0},
+					Relocations: []Relocation{{0x3, "R_X86_64_PC32", ".rodata-0x4"}}},
+				// movl $0x1,0x0(%rip) with R_X86_64_PC32 G-0x8
+				{Address: 0x7, Bytes: []byte{0xc7, 0x05, 0, 0, 0, 0, 0x01, 0, 0, 0},
+					Relocations: []Relocation{{0x9, "R_X86_64_PC32", "G-0x8"}}},
+				// mov 0x0(%rip),%ecx with R_X86_64_PC32 .rodata+0xc
+				{Address: 0x11, Bytes: []byte{0x8b, 0x0d, 0, 0, 0, 0},
+					Relocations: []Relocation{{0x13, "R_X86_64_PC32", ".rodata+0xc"}}},
+			},
+			references: []string{"LEAQ K<>(SB), AX", "MOVL $0x1, G<>(SB)", "MOVL T<>(SB), CX"},
+		},
+		{
+			name: "386 absolute",
+			arch: "386",
+			instrs: []MachineInstruction{
+				// mov 0x0(,%ecx,4),%eax with R_386_32 .rodata
+				{Address: 0x0, Bytes: []byte{0x8b, 0x04, 0x8d, 0, 0, 0, 0},
+					Relocations: []Relocation{{0x3, "R_386_32", ".rodata"}}},
+				// mov $0x8,%edx with R_386_32 .rodata, the addend being in the instruction
+				{Address: 0x7, Bytes: []byte{0xba, 0x08, 0, 0, 0},
+					Relocations: []Relocation{{0x8, "R_386_32", ".rodata"}}},
+			},
+			references: []string{"MOVL K<>(SB)(CX*4), AX", "MOVL $K<>+8(SB), DX"},
+		},
+		{
+			name: "386 moffs",
+			arch: "386",
+			instrs: []MachineInstruction{
+				// mov 0x0,%eax with R_386_32 G
+				{Address: 0x0, Bytes: []byte{0xa1, 0, 0, 0, 0}, InstructionString: "mov    0x0,%eax",
+					Relocations: []Relocation{{0x1, "R_386_32", "G"}}},
+			},
+			err: `instruction "mov    0x0,%eax" at 0x0 refers to G through R_386_32, but the moffs form`,
+		},
+		{
+			name: "arm64 ADRP and ADD",
+			arch: "arm64",
+			instrs: []MachineInstruction{
+				// adrp x1, 0 with R_AARCH64_ADR_PREL_PG_HI21 .rodata+0x10
+				{Address: 0x0, Bytes: []byte{0x90, 0x00, 0x00, 0x01},
+					Relocations: []Relocation{{0x0, "R_AARCH64_ADR_PREL_PG_HI21", ".rodata+0x10"}}},
+				// add x1, x1, #0x0 with R_AARCH64_ADD_ABS_LO12_NC .rodata+0x10
+				{Address: 0x4, Bytes: []byte{0x91, 0x00, 0x00, 0x21},
+					Relocations: []Relocation{{0x4, "R_AARCH64_ADD_ABS_LO12_NC", ".rodata+0x10"}}},
+			},
+			references: []string{"MOVD $T<>(SB), R1", ""},
+		},
+		{
+			name: "arm64 ADRP without ADD",
+			arch: "arm64",
+			instrs: []MachineInstruction{
+				{Address: 0x0, Bytes: []byte{0x90, 0x00, 0x00, 0x01}, InstructionString: "adrp x1, 0",
+					Relocations: []Relocation{{0x0, "R_AARCH64_ADR_PREL_PG_HI21", "G"}}},
+			},
+			err: `instruction "adrp x1, 0" at 0x0 refers to G through R_AARCH64_ADR_PREL_PG_HI21, but the ADRP isn't followed by an ADD`,
+		},
+		{
+			name: "unsupported architecture",
+			arch: "mips",
+			instrs: []MachineInstruction{
+				{Address: 0x0, Bytes: []byte{0x3c, 0x02, 0x00, 0x00}, InstructionString: "lui v0,0x0",
+					Relocations: []Relocation{{0x0, "R_MIPS_HI16", ".rodata"}}},
+			},
+			err: "it can't be rewritten into a Go symbol reference on mips",
+		},
+	}
+
+	for _, table := range tables {
+		err := ResolveDataReferences(table.arch, table.instrs, dataSymbols())
+		switch {
+		case table.err != "":
+			if err == nil || !strings.Contains(err.Error(), table.err) {
+				t.Errorf("Unable to reject references in %s, got: (err=%v) want: (err=%s).", table.name, err, table.err)
+			}
+			continue
+		case err != nil:
+			t.Errorf("Unable to resolve references in %s : %v", table.name, err)
+			continue
+		}
+		for i, instr := range table.instrs {
+			if instr.SymbolReference != table.references[i] {
+				t.Errorf("Unable to resolve reference of instruction %d in %s, got: %q want: %q.", i, table.name, instr.SymbolReference, table.references[i])
+			}
+		}
+	}
+}
+
+func TestWriteInstructionsDataReference(t *testing.T) {
+	instrs := []MachineInstruction{
+		{Address: 0x0, Bytes: []byte{0x90, 0x00, 0x00, 0x01}, Command: "adrp", Arguments: []string{"x1", "0"},
+			SymbolReference: "MOVD $T<>(SB), R1"},
+		{Address: 0x4, Bytes: []byte{0x91, 0x00, 0x00, 0x21}, Command: "add", Arguments: []string{"x1", "x1", "#0x0"},
+			InReference: true},
+	}
+	want := "MOVD $T<>(SB), R1 // adrp x1 0 // add x1 x1 #0x0"
+
+	var buf bytes.Buffer
+	// the references are written out even without translating, as the bytes don't point anywhere
+	if err := WriteInstructions("arm64", &buf, instrs, false); err != nil {
+		t.Fatalf("Unable to write instructions : %v", err)
+	}
+	if got := adjustWhitespace(buf.String()); got != want {
+		t.Errorf("Unable to write data reference, got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,277 @@
+package assembler
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ExternDirective is the prefix of the comments in the Go file which map an undefined symbol onto a Go function, i.e.
+// "//asm2go:extern memcpy=runtime·memmove args=3"
+const ExternDirective = "//asm2go:extern "
+
+// Extern maps an undefined symbol the native code calls onto the Go function which is called instead
+type Extern struct {
+	// Name is the undefined symbol, i.e. "memcpy"
+	Name string
+	// Target is the Go function, i.e. "runtime·memmove", or "·abort" for one in the same package
+	Target string
+	// Args and Results are the number of word sized arguments and results of the Go function, which are passed the
+	// same way as the integer arguments and results of the native calling convention
+	Args, Results int
+}
+
+// ParseExtern parses the mapping of an extern directive, i.e. "memcpy=runtime·memmove args=3", where args and results
+// are the number of word sized arguments and results the Go function has, which are 0 if left out
+func ParseExtern(mapping string) (Extern, error) {
+	fields := strings.Fields(mapping)
+	if len(fields) == 0 {
+		return Extern{}, fmt.Errorf("empty extern mapping")
+	}
+	var e Extern
+	if i := strings.Index(fields[0], "="); i > 0 && i < len(fields[0])-1 {
+		e.Name, e.Target = fields[0][:i], fields[0][i+1:]
+	} else {
+		return Extern{}, fmt.Errorf("extern mapping %q doesn't start with symbol=function", mapping)
+	}
+	for _, field := range fields[1:] {
+		key, value := field, ""
+		if i := strings.Index(field, "="); i != -1 {
+			key, value = field[:i], field[i+1:]
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return Extern{}, fmt.Errorf("extern mapping %q has an invalid count %q", mapping, field)
+		}
+		switch key {
+		case "args":
+			e.Args = n
+		case "results":
+			e.Results = n
+		default:
+			return Extern{}, fmt.Errorf("extern mapping %q has an unknown option %q", mapping, key)
+		}
+	}
+	return e, nil
+}
+
+// GoName returns the name of the file-private Go function the calls to the extern are rewritten to call, which calls
+// the Go function for it, i.e. "extern_memcpy<>"
+func (e Extern) GoName() string {
+	return PrivateName("extern_" + e.Name)
+}
+
+// nativeABI describes how the native calling convention of an architecture passes word sized arguments and results,
+// and which registers it expects to be preserved by calls, which Go functions don't preserve
+type nativeABI struct {
+	// word is the size of the registers in bytes, and mov is the Go instruction moving one
+	word int
+	mov  string
+	// sp is the Go name of the hardware stack pointer
+	sp string
+	// argBase is the offset from the stack pointer that Go expects the arguments of a call at, which is after the
+	// slot for the return address on architectures with a link register
+	argBase int
+	// args are the registers holding the arguments, or nil if they are on the stack above the return address
+	args []string
+	// result is the register holding the result
+	result string
+	// saved are the callee saved registers, which the Go assembler doesn't save itself
+	saved []string
+	// savedFloat are the callee saved floating point registers, which are moved with movFloat
+	savedFloat []string
+	movFloat   string
+	// g are the names objdump shows the register holding the Go g register by, which the native code is free to use
+	// as far as it's calling convention goes, or nil if g isn't kept in a register
+	g []string
+}
+
+// nativeCaller is implemented by backends which know the native calling convention of their architecture, so that
+// calls to undefined symbols can be mapped onto Go functions, see WriteExtern
+type nativeCaller interface {
+	nativeABI() nativeABI
+}
+
+// CheckExtern returns an error if the calls to the extern can't be mapped onto it's Go function on arch
+func CheckExtern(arch string, e Extern) error {
+	backend, _ := Backend(arch)
+	caller, ok := backend.(nativeCaller)
+	if !ok {
+		return fmt.Errorf("extern %s can't be mapped onto %s, as calling Go functions from native code isn't supported on %s", e.Name, e.Target, arch)
+	}
+	abi := caller.nativeABI()
+	switch {
+	case abi.args != nil && e.Args > len(abi.args):
+		return fmt.Errorf("extern %s can't be mapped onto %s with %d arguments, as only %d are passed in registers on %s", e.Name, e.Target, e.Args, len(abi.args), arch)
+	case e.Results > 1:
+		return fmt.Errorf("extern %s can't be mapped onto %s with %d results, as only one is returned on %s", e.Name, e.Target, e.Results, arch)
+	}
+	return nil
+}
+
+// runtimeExternTargets are the runtime functions the externs can be mapped onto, which are written in assembly and
+// NOSPLIT, and don't call anything that isn't
+var runtimeExternTargets = stringSet("runtime·memmove runtime·memclrNoHeapPointers")
+
+// CheckExternTarget returns an error if the Go function the extern is mapped onto isn't known to be safe to call from
+// the native code, which only the runtime functions in runtimeExternTargets and the NOSPLIT assembly functions of the
+// package in nosplit (i.e. "·cstrlen") are
+// The Go function runs on the stack of the native code, so anything that grows the stack, gets preempted or scans the
+// stack for the GC, as any function written in Go can, runs into the native frames and fails with "unexpected return
+// pc"
+func CheckExternTarget(e Extern, nosplit map[string]bool) error {
+	if runtimeExternTargets[e.Target] || nosplit[e.Target] {
+		return nil
+	}
+	return fmt.Errorf("extern %s can't be mapped onto %s, as only the NOSPLIT assembly functions of the package, runtime·memmove and runtime·memclrNoHeapPointers can be called from native code", e.Name, e.Target)
+}
+
+// CheckGRegister returns an error naming the first of the instructions which overwrites the register holding the Go g
+// register on arch, as the Go functions the externs are mapped onto are called with whatever the native code left in
+// it
+// g is only kept in that register, so there is nowhere the functions calling the Go functions could restore it from
+func CheckGRegister(arch string, instrs []MachineInstruction) error {
+	backend, _ := Backend(arch)
+	caller, ok := backend.(nativeCaller)
+	if !ok {
+		return nil
+	}
+	g := caller.nativeABI().g
+	if len(g) == 0 {
+		return nil
+	}
+	for _, instr := range instrs {
+		if !instr.Data && instr.writesRegister(g) {
+			return fmt.Errorf("instruction \"%s\" at %#x overwrites %s, which has to hold the Go g register when the native code calls a Go function, compile the native code with -ffixed-%s",
+				strings.TrimSpace(instr.InstructionString), instr.Address, g[0], g[0])
+		}
+	}
+	return nil
+}
+
+// writesRegister returns whether the instruction overwrites the register going by any of it's names in the objdump
+// output, as the destination (first argument) of the instruction, the second destination of the instructions with 2,
+// one of the registers loaded by a load multiple, or the base register of an address with writeback
+func (instr MachineInstruction) writesRegister(names []string) bool {
+	isName := func(arg string) bool {
+		for _, name := range names {
+			if arg == name {
+				return true
+			}
+		}
+		return false
+	}
+	hasPrefix := func(s string, prefixes ...string) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(s, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+
+	command, args := strings.ToLower(instr.Command), instr.Arguments
+	if len(args) == 0 {
+		return false
+	}
+	for i, arg := range args {
+		// the base register of ldm/stm with writeback, i.e. "ldmia sl!, {r0, r1}"
+		if i == 0 && isName(strings.TrimSuffix(arg, "!")) && strings.HasSuffix(arg, "!") {
+			return true
+		}
+		// pre-indexed "[sl, #4]!" and post-indexed "[sl], #4" addresses write the address back to the base register
+		if strings.HasPrefix(arg, "[") && isName(strings.TrimSuffix(strings.TrimPrefix(arg, "["), "]")) {
+			closed := strings.HasSuffix(arg, "]")
+			for _, rest := range args[i:] {
+				if strings.HasSuffix(rest, "]!") {
+					return true
+				}
+			}
+			if closed && i < len(args)-1 {
+				return true
+			}
+		}
+	}
+	if hasPrefix(command, "ldm", "pop") {
+		for _, arg := range args {
+			if isName(strings.Trim(arg, "{}^ ")) {
+				return true
+			}
+		}
+	}
+
+	// stores (except for the status register of the exclusive ones), compares, tests and indirect branches only read
+	// their first argument
+	exclusiveStore := strings.Contains(command, "xr") || strings.Contains(command, "xp") || strings.Contains(command, "rex")
+	reads := hasPrefix(command, "st") && !exclusiveStore ||
+		hasPrefix(command, "cmp", "cmn", "tst", "teq", "ccmp", "ccmn", "cbz", "cbnz", "tbz", "tbnz", "bx", "blx", "br", "blr", "ret", "prfm", "msr", "push")
+	if !reads && isName(args[0]) {
+		return true
+	}
+	// the instructions which write a pair of registers
+	pair := hasPrefix(command, "ldp", "ldnp", "ldxp", "ldaxp", "ldrd", "ldrexd", "ldaexd", "umull", "smull", "umlal", "smlal", "umaal")
+	return pair && len(args) > 1 && isName(args[1])
+}
+
+// WriteExtern writes out the file-private Go function the calls to the extern are rewritten to call (see
+// Extern.GoName), which moves the arguments from where the native calling convention passes them to where Go expects
+// them, calls the Go function, and moves the result back, saving the registers the native code expects to be
+// preserved around the call
+func WriteExtern(arch string, w io.Writer, e Extern) error {
+	if err := CheckExtern(arch, e); err != nil {
+		return err
+	}
+	backend, _ := Backend(arch)
+	abi := backend.(nativeCaller).nativeABI()
+
+	// the arguments and results come first in the frame, followed by the saved registers
+	offset := abi.argBase + abi.word*(e.Args+e.Results)
+	saved := make([]int, len(abi.saved))
+	for i := range abi.saved {
+		saved[i] = offset
+		offset += abi.word
+	}
+	// floating point registers are always 8 bytes
+	if len(abi.savedFloat) != 0 {
+		offset = (offset + 7) &^ 7
+	}
+	savedFloat := make([]int, len(abi.savedFloat))
+	for i := range abi.savedFloat {
+		savedFloat[i] = offset
+		offset += 8
+	}
+	frame := offset - abi.argBase
+
+	fmt.Fprintf(w, "// %s calls %s for the calls to %s in the native code\n", e.GoName(), e.Target, e.Name)
+	fmt.Fprintf(w, "TEXT %s(SB), NOSPLIT, $%d-0\n", e.GoName(), frame)
+	for i, reg := range abi.saved {
+		fmt.Fprintf(w, "    %s %s, %d(%s)\n", abi.mov, reg, saved[i], abi.sp)
+	}
+	for i, reg := range abi.savedFloat {
+		fmt.Fprintf(w, "    %s %s, %d(%s)\n", abi.movFloat, reg, savedFloat[i], abi.sp)
+	}
+	for i := 0; i < e.Args; i++ {
+		argOffset := abi.argBase + abi.word*i
+		if abi.args != nil {
+			fmt.Fprintf(w, "    %s %s, %d(%s)\n", abi.mov, abi.args[i], argOffset, abi.sp)
+			continue
+		}
+		// the native arguments are above the frame and the return address, the result register is free to copy them
+		// with as it's overwritten anyway
+		fmt.Fprintf(w, "    %s %d(%s), %s\n", abi.mov, frame+abi.word+abi.word*i, abi.sp, abi.result)
+		fmt.Fprintf(w, "    %s %s, %d(%s)\n", abi.mov, abi.result, argOffset, abi.sp)
+	}
+	fmt.Fprintf(w, "    CALL %s(SB)\n", e.Target)
+	if e.Results != 0 {
+		fmt.Fprintf(w, "    %s %d(%s), %s\n", abi.mov, abi.argBase+abi.word*e.Args, abi.sp, abi.result)
+	}
+	for i, reg := range abi.saved {
+		fmt.Fprintf(w, "    %s %d(%s), %s\n", abi.mov, saved[i], abi.sp, reg)
+	}
+	for i, reg := range abi.savedFloat {
+		fmt.Fprintf(w, "    %s %d(%s), %s\n", abi.movFloat, savedFloat[i], abi.sp, reg)
+	}
+	fmt.Fprintln(w, "    RET")
+	return nil
+}
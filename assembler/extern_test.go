@@ -0,0 +1,150 @@
+package assembler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseExtern(t *testing.T) {
+	tables := []struct {
+		mapping string
+		extern  Extern
+		err     string
+	}{
+		{"memcpy=runtime·memmove args=3", Extern{"memcpy", "runtime·memmove", 3, 0}, ""},
+		{"strlen=·strlen args=1 results=1", Extern{"strlen", "·strlen", 1, 1}, ""},
+		{"abort=·abort", Extern{"abort", "·abort", 0, 0}, ""},
+		{"abort", Extern{}, "doesn't start with symbol=function"},
+		{"memcpy=runtime·memmove args=x", Extern{}, "invalid count"},
+		{"memcpy=runtime·memmove floats=1", Extern{}, "unknown option"},
+	}
+
+	for _, table := range tables {
+		e, err := ParseExtern(table.mapping)
+		switch {
+		case table.err != "":
+			if err == nil || !strings.Contains(err.Error(), table.err) {
+				t.Errorf("Unable to reject extern mapping %q, got: (err=%v) want: (err=%s).", table.mapping, err, table.err)
+			}
+		case err != nil:
+			t.Errorf("Unable to parse extern mapping %q : %v", table.mapping, err)
+		case e != table.extern:
+			t.Errorf("Unable to parse extern mapping %q, got: %+v want: %+v.", table.mapping, e, table.extern)
+		}
+	}
+}
+
+func TestWriteExtern(t *testing.T) {
+	tables := []struct {
+		arch   string
+		extern Extern
+		output string
+		err    string
+	}{
+		{
+			arch:   "amd64",
+			extern: Extern{"strlen", "·strlen", 1, 1},
+			output: "// extern_strlen<> calls ·strlen for the calls to strlen in the native code " +
+				"TEXT extern_strlen<>(SB), NOSPLIT, $56-0 " +
+				"MOVQ BX, 16(SP) MOVQ R12, 24(SP) MOVQ R13, 32(SP) MOVQ R14, 40(SP) MOVQ R15, 48(SP) " +
+				"MOVQ DI, 0(SP) CALL ·strlen(SB) MOVQ 8(SP), AX " +
+				"MOVQ 16(SP), BX MOVQ 24(SP), R12 MOVQ 32(SP), R13 MOVQ 40(SP), R14 MOVQ 48(SP), R15 RET",
+		},
+		{
+			// the arguments are copied from the native stack, above the frame and the return address
+			arch:   "386",
+			extern: Extern{"abort", "·abort", 1, 0},
+			output: "// extern_abort<> calls ·abort for the calls to abort in the native code " +
+				"TEXT extern_abort<>(SB), NOSPLIT, $20-0 " +
+				"MOVL BX, 4(SP) MOVL SI, 8(SP) MOVL DI, 12(SP) MOVL BP, 16(SP) " +
+				"MOVL 24(SP), AX MOVL AX, 0(SP) CALL ·abort(SB) " +
+				"MOVL 4(SP), BX MOVL 8(SP), SI MOVL 12(SP), DI MOVL 16(SP), BP RET",
+		},
+		{
+			arch:   "arm",
+			extern: Extern{"f", "·f", 5, 0},
+			err:    "only 4 are passed in registers on arm",
+		},
+		{
+			arch:   "mips",
+			extern: Extern{"memcpy", "runtime·memmove", 3, 0},
+			err:    "calling Go functions from native code isn't supported on mips",
+		},
+	}
+
+	for _, table := range tables {
+		var buf bytes.Buffer
+		err := WriteExtern(table.arch, &buf, table.extern)
+		switch {
+		case table.err != "":
+			if err == nil || !strings.Contains(err.Error(), table.err) {
+				t.Errorf("Unable to reject extern %s on %s, got: (err=%v) want: (err=%s).", table.extern.Name, table.arch, err, table.err)
+			}
+		case err != nil:
+			t.Errorf("Unable to write extern %s on %s : %v", table.extern.Name, table.arch, err)
+		case adjustWhitespace(buf.String()) != table.output:
+			t.Errorf("Unable to write extern %s on %s, got:\n%s\nwant:\n%s", table.extern.Name, table.arch, adjustWhitespace(buf.String()), table.output)
+		}
+	}
+}
+
+func TestCheckGRegister(t *testing.T) {
+	tables := []struct {
+		arch    string
+		command string
+		args    []string
+		data    bool
+		err     bool
+	}{
+		{"arm64", "mov", []string{"x28", "x0"}, false, true},
+		{"arm64", "add", []string{"w28", "w1", "#0x1"}, false, true},
+		{"arm64", "ldp", []string{"x27", "x28", "[sp]", "#16"}, false, true},
+		{"arm64", "ldr", []string{"x0", "[x28]", "#8"}, false, true},
+		{"arm64", "ldr", []string{"x0", "[x28", "#8]!"}, false, true},
+		{"arm64", "ldr", []string{"x0", "[x28", "#8]"}, false, false},
+		{"arm64", "stp", []string{"x27", "x28", "[sp", "#-16]!"}, false, false},
+		{"arm64", "cmp", []string{"x28", "#0x0"}, false, false},
+		{"arm64", "cbz", []string{"x28", "40"}, false, false},
+		{"arm64", "stxr", []string{"w28", "x0", "[x1]"}, false, true},
+		{"arm", "mov", []string{"sl", "r0"}, false, true},
+		{"arm", "pop", []string{"{r4", "sl", "pc}"}, false, true},
+		{"arm", "ldmia", []string{"sl!", "{r0", "r1}"}, false, true},
+		{"arm", "push", []string{"{r4", "sl", "lr}"}, false, false},
+		{"arm", "str", []string{"sl", "[sp", "#4]"}, false, false},
+		{"arm", "umull", []string{"r0", "sl", "r1", "r2"}, false, true},
+		// a literal pool isn't made of instructions
+		{"arm", ".word", []string{"sl"}, true, false},
+		// amd64 keeps g in thread local storage
+		{"amd64", "mov", []string{"%rax", "%r14"}, false, false},
+	}
+
+	for _, table := range tables {
+		instrs := []MachineInstruction{{Command: table.command, Arguments: table.args, InstructionString: table.command, Data: table.data}}
+		err := CheckGRegister(table.arch, instrs)
+		if (err != nil) != table.err {
+			t.Errorf("Unable to check the g register in %s %v on %s, got: (err=%v) want: (err=%t).", table.command, table.args, table.arch, err, table.err)
+		}
+	}
+}
+
+func TestCheckExternTarget(t *testing.T) {
+	nosplit := map[string]bool{"·cstrlen": true}
+	tables := []struct {
+		target string
+		err    bool
+	}{
+		{"runtime·memmove", false},
+		{"·cstrlen", false},
+		// a Go function can grow the stack or be preempted while on the native stack
+		{"·strlen", true},
+		{"runtime·mallocgc", true},
+	}
+
+	for _, table := range tables {
+		err := CheckExternTarget(Extern{Name: "f", Target: table.target}, nosplit)
+		if (err != nil) != table.err {
+			t.Errorf("Unable to check extern target %s, got: (err=%v) want: (err=%t).", table.target, err, table.err)
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package gnu
 
 import (
+	"debug/elf"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -126,115 +128,381 @@ var instructionRegex = regexp.MustCompile(`(?m)^(?:\s*)([0-9a-f]+):(?:\s*)([0-9a
 // This regex matches an opcode of letters, numbers and the ".", and all possible arguments as 2 subgroups
 var opcodeArgsRegex = regexp.MustCompile(`(?m)(^[a-zA-z0-9.]+)(?:\s*)(.*)$`)
 
-// This regex matches the end of a set of instructions associated with a symbol
-// a more readable version of this regex would be simply a check for the next line that is "\t..."
-// or the empty string after calling strings.TrimSpace
-var symbolEndRegex = regexp.MustCompile(`(?m)(^((\t\.\.\.)|[ \t]*)$)|(^$)`)
+// This regex matches a relocation that `objdump -r -w` prints on the same line as the instruction it applies to,
+// with the address, the type of relocation and the symbol as 3 subgroups
+var relocationRegex = regexp.MustCompile(`\t([0-9a-f]+): (R_[A-Z0-9_]+)\t(\S+)`)
+
+// This regex matches the line objdump starts the disassembly of a section with, with the name of the section as a
+// subgroup
+var sectionStartRegex = regexp.MustCompile(`^Disassembly of section (.+):$`)
 
 // ProcessMachineCodeToInstructions takes in an object file and a map of symbol names -> Symbol that are to be processed
 // and returns a map of symbol name -> machine instructions corresponding to that symbol
+// The instructions of a symbol are the ones from it's address up to it's size, or for a symbol without a .size
+// directive, up to the next symbol in it's section
 func (g GnuAssembler) ProcessMachineCodeToInstructions(objectFile string, syms map[string]assembler.Symbol) (map[string][]assembler.MachineInstruction, error) {
-	// First, we use objdump on the object file to get a listing of the disassembled source
-	cmd := exec.Command(g.objdump(), "-S", "-C", "-w", objectFile)
+	// First, we use objdump on the object file to get a listing of the disassembled source, including any
+	// relocations applying to the instructions
+	// objdump is run with -z, so that zeroes (i.e. NOP's on mips used as alignment padding) are shown as instructions
+	// rather than as "\t...", which would otherwise leave a gap in the instructions of the symbol
+	cmd := exec.Command(g.objdump(), "-S", "-C", "-w", "-r", "-z", objectFile)
 	cmb, err := cmd.CombinedOutput()
 	if err != nil {
 		return nil, fmt.Errorf("error processing object file %s (%v) : \n%s", objectFile, err, string(cmb[:]))
 	}
 	lines := strings.Split(string(cmb[:]), "\n")
 
-	// With the source file, we need to find the first line in the output that starts with "FFFFFFF <SYMBOL_NAME>:"
-	// (FFFFFFF being some hex address) as that is the start of the disassembly for the specified symbols
-	// then find the end of the instructions for that symbol identified by either the first blank line after the start
-	// oy by "\t..." which is displayed for padding 0's that may be added to the end of the symbol's instructions
-	symInstrStrings := make(map[string][]string)
-	for sym := range syms {
-		var start int
-		var end int
-		// We have to generate this regex each time, as we include the name of the symbol in the regex
-		symbolStartRegex := regexp.MustCompile(fmt.Sprintf(`(?m)^[0-9a-f]+ <%s>:`, sym))
-
-		for index, line := range lines {
-			loc := symbolStartRegex.FindStringIndex(line)
-			if len(loc) == 2 {
-				// found the start, now look for the end
-				start = index
-				for index2, line := range lines[index:] {
-					loc := symbolEndRegex.FindStringIndex(line)
-					if len(loc) == 2 {
-						// the ending isn't just index2, it's index2 + the length of the start
-						end = index2 + start
-						break
-					}
-				}
-				break
-			}
+	// The byte order of the instructions comes from the object file itself, as the same assembler can assemble for
+	// either byte order, i.e. with -EB or -EL
+	return g.symbolInstructions(lines, objectByteOrder(objectFile), syms)
+}
+
+// symbolInstructions returns a map of symbol name -> machine instructions for the symbols from the lines objdump shows
+// for the disassembly of an object file in byteOrder, see ProcessMachineCodeToInstructions
+func (g GnuAssembler) symbolInstructions(lines []string, byteOrder binary.ByteOrder, syms map[string]assembler.Symbol) (map[string][]assembler.MachineInstruction, error) {
+	// The instructions of every section are parsed first, as objdump splits the disassembly of a section up at every
+	// symbol in it (including labels in the middle of a function), so it doesn't tell where a symbol ends
+	sectionInstrs := make(map[string][]assembler.MachineInstruction)
+	section := ""
+	for _, line := range lines {
+		if matches := sectionStartRegex.FindStringSubmatch(line); matches != nil {
+			section = matches[1]
+			continue
+		}
+		instrs, err := parseInstructions(line, byteOrder)
+		if err != nil {
+			return nil, err
 		}
-		// the range starts at start+1 to drop the "FFFFFFF <SYMBOL_NAME>:""
-		symInstrStrings[sym] = lines[start+1 : end]
+		sectionInstrs[section] = append(sectionInstrs[section], instrs...)
 	}
 
-	// Now that we have all the instruction lines, we need to parse each line into a MachineInstruction
+	// Now each symbol gets the instructions from it's address up to it's end
 	symMachInstrs := make(map[string][]assembler.MachineInstruction)
-	for sym, instrStrings := range symInstrStrings {
-		// Loop over each instruction, parsing it into a MachineInstruction
-		for _, instrString := range instrStrings {
-			for _, instMatches := range instructionRegex.FindAllStringSubmatch(instrString, -1) {
-				// In the second group delete all whitespace to join all hex bytes together into a single string
-				// Then we decode it into an actual byte slice
-				decodedBytes, err := hex.DecodeString(strings.Map(deleteSpace, instMatches[2]))
-				if err != nil {
-					return nil, err
-				}
+	for name, sym := range syms {
+		start, end := g.symbolAddress(sym), g.symbolEnd(sym, syms)
+		for _, instr := range sectionInstrs[sym.Section] {
+			if instr.Address >= start && instr.Address < end {
+				symMachInstrs[name] = append(symMachInstrs[name], instr)
+			}
+		}
+	}
 
-				// The RawInstruction occurs in the 3rd element of match and may have a
-				// comment after it, usually automatically generated for symbols that have been resolved to a hex address
-				// so we split it by the ";" which is the comment character, then we can split the instruction itself
-				// into opcodes / arguments
-				var commentString string
-				rawInstructions := strings.SplitN(instMatches[3], ";", 2)
-				if len(rawInstructions) == 1 {
-					commentString = ""
-				} else {
-					commentString = rawInstructions[1]
-				}
+	return symMachInstrs, nil
+}
 
-				// Now find the instruction and the opcodes using the regex which reports the opcode
-				// as the first subgroup and all arguments (if any) as the second group which will always exist
-				// but sometimes may be the empty string
-				opcodeMatches := opcodeArgsRegex.FindAllStringSubmatch(rawInstructions[0], -1)
-				if len(opcodeMatches) == 0 {
-					return nil, fmt.Errorf("error: invalid instruction format: %s", instrString)
-				}
+// symbolAddress returns the address of the first instruction of the symbol, which is it's value, except for Thumb
+// functions on arm, which have the lowest bit of their value set
+func (g GnuAssembler) symbolAddress(sym assembler.Symbol) uint64 {
+	if g.Arch == "arm" && sym.Function {
+		return sym.ValueAddressField &^ 1
+	}
+	return sym.ValueAddressField
+}
 
-				// Split the arguments by a comma and trim off all whitespace
-				instrArgs := strings.Split(opcodeMatches[0][2], ",")
-				formattedArgs := make([]string, len(instrArgs))
-				for index, instrArg := range instrArgs {
-					formattedArgs[index] = strings.TrimSpace(instrArg)
-				}
+// symbolEnd returns the address the instructions of the symbol end at, which is it's address plus it's size, or for
+// a symbol without a .size directive, the address of the next of the symbols in it's section (or the end of the
+// section if there is none)
+func (g GnuAssembler) symbolEnd(sym assembler.Symbol, syms map[string]assembler.Symbol) uint64 {
+	start := g.symbolAddress(sym)
+	if sym.AlignmentSizeField != 0 {
+		return start + sym.AlignmentSizeField
+	}
+	end := uint64(math.MaxUint64)
+	for _, other := range syms {
+		if address := g.symbolAddress(other); other.Section == sym.Section && address > start && address < end {
+			end = address
+		}
+	}
+	return end
+}
+
+// parseInstructions parses the instructions on a line of objdump output, which is either a single instruction or
+// none at all, i.e. for the line naming the symbol the following instructions belong to
+func parseInstructions(line string, byteOrder binary.ByteOrder) ([]assembler.MachineInstruction, error) {
+	var instrs []assembler.MachineInstruction
+	for _, instMatches := range instructionRegex.FindAllStringSubmatch(line, -1) {
+		// In the second group delete all whitespace to join all hex bytes together into a single string
+		// Then we decode it into an actual byte slice
+		decodedBytes, err := hex.DecodeString(strings.Map(deleteSpace, instMatches[2]))
+		if err != nil {
+			return nil, err
+		}
+
+		// Any relocations are printed after the instruction, so parse them and then drop them from the
+		// instruction text
+		var relocs []assembler.Relocation
+		for _, relocMatches := range relocationRegex.FindAllStringSubmatch(instMatches[3], -1) {
+			relocAddress, err := strconv.ParseUint(relocMatches[1], 16, 64)
+			if err != nil {
+				return nil, err
+			}
+			relocs = append(relocs, assembler.Relocation{
+				Address: relocAddress,
+				Type:    relocMatches[2],
+				Symbol:  relocMatches[3],
+			})
+		}
+		rawInstruction := strings.TrimSpace(relocationRegex.ReplaceAllString(instMatches[3], ""))
+
+		// The RawInstruction occurs in the 3rd element of match and may have a
+		// comment after it, usually automatically generated for symbols that have been resolved to a hex address
+		// so we split it by the ";" which is the comment character, then we can split the instruction itself
+		// into opcodes / arguments
+		var commentString string
+		rawInstructions := strings.SplitN(rawInstruction, ";", 2)
+		if len(rawInstructions) == 1 {
+			commentString = ""
+		} else {
+			commentString = rawInstructions[1]
+		}
+
+		// Now find the instruction and the opcodes using the regex which reports the opcode
+		// as the first subgroup and all arguments (if any) as the second group which will always exist
+		// but sometimes may be the empty string
+		opcodeMatches := opcodeArgsRegex.FindAllStringSubmatch(rawInstructions[0], -1)
+		if len(opcodeMatches) == 0 {
+			return nil, fmt.Errorf("error: invalid instruction format: %s", line)
+		}
 
-				// Parse the address from the instMatches
-				address, err := strconv.ParseUint(instMatches[1], 16, 64)
-				if err != nil {
-					return nil, err
+		// Split the arguments by a comma and trim off all whitespace
+		instrArgs := strings.Split(opcodeMatches[0][2], ",")
+		formattedArgs := make([]string, len(instrArgs))
+		for index, instrArg := range instrArgs {
+			formattedArgs[index] = strings.TrimSpace(instrArg)
+		}
+
+		// Parse the address from the instMatches
+		address, err := strconv.ParseUint(instMatches[1], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		// Finally build up the instruction
+		instrs = append(instrs, assembler.MachineInstruction{
+			Address:           address,
+			Bytes:             decodedBytes,
+			BytesEndianness:   byteOrder,
+			RawInstruction:    rawInstruction,
+			InstructionString: rawInstructions[0],
+			Comment:           strings.TrimSpace(commentString),
+			Command:           opcodeMatches[0][1],
+			Arguments:         formattedArgs,
+			Relocations:       relocs,
+		})
+	}
+	return instrs, nil
+}
+
+// ProcessDataSymbols takes in an object file and a map of symbol names -> Symbol in the data sections that are to be
+// processed and returns a map of symbol name -> contents of that symbol
+// The contents are read from the sections of the ELF object file directly, as objdump doesn't show them by symbol
+func (g GnuAssembler) ProcessDataSymbols(objectFile string, syms map[string]assembler.Symbol) (map[string][]byte, error) {
+	f, err := elf.Open(objectFile)
+	if err != nil {
+		return nil, fmt.Errorf("error processing object file %s : %v", objectFile, err)
+	}
+	defer f.Close()
+
+	contents := make(map[string][]byte)
+	for name, sym := range syms {
+		if sym.Section == "*COM*" {
+			// objdump shows the size of common symbols in place of the address, and the alignment in place of the size
+			contents[name] = make([]byte, sym.ValueAddressField)
+			continue
+		}
+		section := f.Section(sym.Section)
+		if section == nil {
+			return nil, fmt.Errorf("error: section %s of data symbol %s not found in %s", sym.Section, name, objectFile)
+		}
+
+		start := sym.ValueAddressField
+		end := start + dataSymbolSize(sym, syms, section.Size)
+		if end > section.Size {
+			return nil, fmt.Errorf("error: data symbol %s ends past the end of section %s", name, sym.Section)
+		}
+		if err := checkDataRelocations(f, section, name, start, end); err != nil {
+			return nil, err
+		}
+		if section.Type == elf.SHT_NOBITS {
+			contents[name] = make([]byte, end-start)
+			continue
+		}
+		data, err := section.Data()
+		if err != nil {
+			return nil, fmt.Errorf("error reading section %s of %s : %v", sym.Section, objectFile, err)
+		}
+		contents[name] = data[start:end]
+	}
+
+	return contents, nil
+}
+
+// dataSymbolSize returns the size of the data symbol, which is either the size from the symbol table, or for symbols
+// without one (i.e. a label without a .size directive), everything up to the next symbol or the end of the section
+func dataSymbolSize(sym assembler.Symbol, syms map[string]assembler.Symbol, sectionSize uint64) uint64 {
+	if sym.AlignmentSizeField != 0 {
+		return sym.AlignmentSizeField
+	}
+	end := sectionSize
+	for _, other := range syms {
+		if other.Section == sym.Section && other.ValueAddressField > sym.ValueAddressField && other.ValueAddressField < end {
+			end = other.ValueAddressField
+		}
+	}
+	return end - sym.ValueAddressField
+}
+
+// checkDataRelocations returns an error if any of the relocations for the section applies to the bytes from start to
+// end of the data symbol, as the bytes only hold a placeholder for the address the linker fills in
+func checkDataRelocations(f *elf.File, section *elf.Section, name string, start, end uint64) error {
+	for _, relSection := range f.Sections {
+		if relSection.Type != elf.SHT_RELA && relSection.Type != elf.SHT_REL {
+			continue
+		}
+		if int(relSection.Info) >= len(f.Sections) || f.Sections[relSection.Info] != section {
+			continue
+		}
+		data, err := relSection.Data()
+		if err != nil {
+			return err
+		}
+		// every relocation entry starts with the offset it applies to
+		entrySize := int(relSection.Entsize)
+		if entrySize == 0 {
+			continue
+		}
+		for i := 0; i+entrySize <= len(data); i += entrySize {
+			var offset uint64
+			if f.Class == elf.ELFCLASS64 {
+				offset = f.ByteOrder.Uint64(data[i:])
+			} else {
+				offset = uint64(f.ByteOrder.Uint32(data[i:]))
+			}
+			if offset >= start && offset < end {
+				return fmt.Errorf("error: data symbol %s has a relocation at %#x in %s, but data referring to other symbols isn't supported",
+					name, offset, section.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// ProcessDataRelocations takes in an object file and returns the relocations applying to each of the sections of it
+// holding data (i.e. the jump tables in .rodata), with the Address being the offset into the section, and the Symbol
+// including the addend the way objdump shows it, i.e. ".text+0x48"
+func (g GnuAssembler) ProcessDataRelocations(objectFile string) (map[string][]assembler.Relocation, error) {
+	f, err := elf.Open(objectFile)
+	if err != nil {
+		return nil, fmt.Errorf("error processing object file %s : %v", objectFile, err)
+	}
+	defer f.Close()
+	symbols, err := f.Symbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, fmt.Errorf("error reading the symbols of %s : %v", objectFile, err)
+	}
+
+	relocs := make(map[string][]assembler.Relocation)
+	for _, relSection := range f.Sections {
+		if relSection.Type != elf.SHT_RELA && relSection.Type != elf.SHT_REL || int(relSection.Info) >= len(f.Sections) {
+			continue
+		}
+		section := f.Sections[relSection.Info]
+		if section.Flags&elf.SHF_ALLOC == 0 || section.Flags&elf.SHF_EXECINSTR != 0 {
+			continue
+		}
+		data, err := relSection.Data()
+		if err != nil {
+			return nil, fmt.Errorf("error reading section %s of %s : %v", relSection.Name, objectFile, err)
+		}
+		var contents []byte
+		if relSection.Type == elf.SHT_REL && section.Type != elf.SHT_NOBITS {
+			if contents, err = section.Data(); err != nil {
+				return nil, fmt.Errorf("error reading section %s of %s : %v", section.Name, objectFile, err)
+			}
+		}
+
+		entrySize := int(relSection.Entsize)
+		for i := 0; entrySize != 0 && i+entrySize <= len(data); i += entrySize {
+			var offset, symIndex uint64
+			var relocType uint32
+			var addend int64
+			if f.Class == elf.ELFCLASS64 {
+				offset = f.ByteOrder.Uint64(data[i:])
+				info := f.ByteOrder.Uint64(data[i+8:])
+				symIndex, relocType = info>>32, uint32(info)
+				if relSection.Type == elf.SHT_RELA {
+					addend = int64(f.ByteOrder.Uint64(data[i+16:]))
 				}
+			} else {
+				offset = uint64(f.ByteOrder.Uint32(data[i:]))
+				info := f.ByteOrder.Uint32(data[i+4:])
+				symIndex, relocType = uint64(info>>8), info&0xff
+				if relSection.Type == elf.SHT_RELA {
+					addend = int64(int32(f.ByteOrder.Uint32(data[i+8:])))
+				}
+			}
+			if relSection.Type == elf.SHT_REL && offset+4 <= uint64(len(contents)) {
+				// REL relocations keep the addend in the bytes they apply to
+				addend = int64(int32(f.ByteOrder.Uint32(contents[offset:])))
+			}
 
-				// Finally build up the instruction and add it into the map
-				symMachInstrs[sym] = append(symMachInstrs[sym], assembler.MachineInstruction{
-					Address:           address,
-					Bytes:             decodedBytes,
-					BytesEndianness:   binary.LittleEndian,
-					RawInstruction:    instMatches[3],
-					InstructionString: rawInstructions[0],
-					Comment:           strings.TrimSpace(commentString),
-					Command:           opcodeMatches[0][1],
-					Arguments:         formattedArgs,
-				})
+			// the symbol table read by debug/elf leaves out the null symbol at index 0
+			name := ""
+			if symIndex != 0 && symIndex <= uint64(len(symbols)) {
+				sym := symbols[symIndex-1]
+				name = sym.Name
+				if elf.ST_TYPE(sym.Info) == elf.STT_SECTION && int(sym.Section) < len(f.Sections) {
+					name = f.Sections[sym.Section].Name
+				}
 			}
+			symbol := name
+			if addend != 0 {
+				symbol = fmt.Sprintf("%s%+#x", name, addend)
+			}
+			relocs[section.Name] = append(relocs[section.Name], assembler.Relocation{
+				Address: offset,
+				Type:    relocationTypeName(f.Machine, relocType),
+				Symbol:  symbol,
+			})
 		}
 	}
+	return relocs, nil
+}
 
-	return symMachInstrs, nil
+// relocationTypeName returns the name of the type of relocation for the machine, i.e. "R_X86_64_64"
+func relocationTypeName(machine elf.Machine, relocType uint32) string {
+	switch machine {
+	case elf.EM_X86_64:
+		return elf.R_X86_64(relocType).String()
+	case elf.EM_386:
+		return elf.R_386(relocType).String()
+	case elf.EM_AARCH64:
+		return elf.R_AARCH64(relocType).String()
+	case elf.EM_ARM:
+		return elf.R_ARM(relocType).String()
+	case elf.EM_MIPS:
+		return elf.R_MIPS(relocType).String()
+	case elf.EM_PPC64:
+		return elf.R_PPC64(relocType).String()
+	case elf.EM_RISCV:
+		return elf.R_RISCV(relocType).String()
+	case elf.EM_S390:
+		return elf.R_390(relocType).String()
+	case elf.EM_LOONGARCH:
+		return elf.R_LARCH(relocType).String()
+	}
+	return strconv.FormatUint(uint64(relocType), 10)
+}
+
+// objectByteOrder returns the byte order of the object file from the EI_DATA field of it's ELF header, or nil if
+// the object file isn't an ELF file
+func objectByteOrder(objectFile string) binary.ByteOrder {
+	f, err := elf.Open(objectFile)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	return f.ByteOrder
 }
 
 func processObjdumpTable(tableRows []string) ([]assembler.Symbol, error) {
@@ -283,7 +551,12 @@ func processObjdumpTable(tableRows []string) ([]assembler.Symbol, error) {
 		if err != nil {
 			return nil, err
 		}
+		// objdump prints the visibility of a symbol before its name if it isn't the default, i.e.
+		// ".hidden __x86.get_pc_thunk.bx", which isn't part of the name
 		sym.Name = cols[2]
+		for _, visibility := range []string{".hidden ", ".protected ", ".internal "} {
+			sym.Name = strings.TrimPrefix(sym.Name, visibility)
+		}
 
 		symbols = append(symbols, sym)
 	}
@@ -0,0 +1,224 @@
+package gnu
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/anonymouse64/asm2go/assembler"
+)
+
+// amd64Disassembly is the output of "objdump -S -C -w -r -z" for an object with functions in 2 sections, where
+// padded has zeros as alignment padding in the middle, looped has a local label splitting it up, and nosize has no
+// .size directive
+const amd64Disassembly = `
+t.o:     file format elf64-x86-64
+
+
+Disassembly of section .text:
+
+0000000000000000 <padded>:
+   0:	89 f8                	mov    %edi,%eax
+   2:	00 00                	add    %al,(%rax)
+   4:	00 00                	add    %al,(%rax)
+   6:	00 00                	add    %al,(%rax)
+   8:	48 ff c0             	inc    %rax
+   b:	c3                   	ret
+
+000000000000000c <looped>:
+   c:	31 c0                	xor    %eax,%eax
+
+000000000000000e <loop>:
+   e:	48 01 f8             	add    %rdi,%rax
+  11:	48 ff ce             	dec    %rsi
+  14:	75 f8                	jne    e <loop>
+  16:	c3                   	ret
+
+0000000000000017 <nosize>:
+  17:	48 89 f0             	mov    %rsi,%rax
+  1a:	c3                   	ret
+
+000000000000001b <after>:
+  1b:	c3                   	ret
+
+Disassembly of section .text.other:
+
+0000000000000000 <other>:
+   0:	e8 00 00 00 00       	call   5 <other+0x5>	1: R_X86_64_PLT32	memcpy-0x4
+   5:	c3                   	ret
+`
+
+// amd64Symbols is the output of "objdump -t" for the object of amd64Disassembly
+const amd64Symbols = `
+t.o:     file format elf64-x86-64
+
+SYMBOL TABLE:
+000000000000000e l       .text	0000000000000000 loop
+0000000000000000 g     F .text	000000000000000c padded
+000000000000000c g     F .text	000000000000000b looped
+0000000000000017 g     F .text	0000000000000000 nosize
+000000000000001b g     F .text	0000000000000001 after
+0000000000000000 g     F .text.other	0000000000000006 other
+0000000000000000         *UND*	0000000000000000 memcpy
+`
+
+// thumbDisassembly is the output of "objdump -S -C -w -r -z" for an arm object with Thumb functions
+const thumbDisassembly = `
+t.o:     file format elf32-littlearm
+
+
+Disassembly of section .text:
+
+00000000 <add1>:
+   0:	b580      	push	{r7, lr}
+   2:	f8d0 3004 	ldr.w	r3, [r0, #4]
+   6:	1c58      	adds	r0, r3, #1
+   8:	bd80      	pop	{r7, pc}
+
+0000000a <ret>:
+   a:	4770      	bx	lr
+`
+
+// thumbSymbols is the output of "objdump -t" for the object of thumbDisassembly, where the value of the Thumb
+// functions has the lowest bit set
+const thumbSymbols = `
+t.o:     file format elf32-littlearm
+
+SYMBOL TABLE:
+00000000 l       .text	00000000 $t
+00000001 g     F .text	0000000a add1
+0000000b g     F .text	00000002 ret
+`
+
+// functionSymbols returns the functions in the output of "objdump -t"
+func functionSymbols(t *testing.T, table string) map[string]assembler.Symbol {
+	rows := strings.Split(table[strings.Index(table, "SYMBOL TABLE:"):], "\n")[1:]
+	syms, err := processObjdumpTable(rows)
+	if err != nil {
+		t.Fatalf("Unable to process objdump table : %v", err)
+	}
+	functions := make(map[string]assembler.Symbol)
+	for _, sym := range syms {
+		if sym.Function {
+			functions[sym.Name] = sym
+		}
+	}
+	return functions
+}
+
+func TestSymbolInstructions(t *testing.T) {
+	tables := []struct {
+		name        string
+		arch        string
+		disassembly string
+		symbols     string
+		symbol      string
+		addresses   []uint64
+	}{
+		// objdump only shows the zeros with -z, which can't be left out, as they are part of the function
+		{"function with zero padding", "amd64", amd64Disassembly, amd64Symbols, "padded", []uint64{0x0, 0x2, 0x4, 0x6, 0x8, 0xb}},
+		{"function with a local label", "amd64", amd64Disassembly, amd64Symbols, "looped", []uint64{0xc, 0xe, 0x11, 0x14, 0x16}},
+		// without a size, the function goes up to the next symbol
+		{"function without a size", "amd64", amd64Disassembly, amd64Symbols, "nosize", []uint64{0x17, 0x1a}},
+		{"function after a function without a size", "amd64", amd64Disassembly, amd64Symbols, "after", []uint64{0x1b}},
+		// the addresses start over in every section
+		{"function in another section", "amd64", amd64Disassembly, amd64Symbols, "other", []uint64{0x0, 0x5}},
+		{"Thumb function", "arm", thumbDisassembly, thumbSymbols, "add1", []uint64{0x0, 0x2, 0x6, 0x8}},
+		{"Thumb function at an odd address", "arm", thumbDisassembly, thumbSymbols, "ret", []uint64{0xa}},
+	}
+
+	for _, table := range tables {
+		g := GnuAssembler{Arch: table.arch}
+		syms := functionSymbols(t, table.symbols)
+		symInstrs, err := g.symbolInstructions(strings.Split(table.disassembly, "\n"), binary.LittleEndian, syms)
+		if err != nil {
+			t.Errorf("Unable to parse the instructions for %s : %v", table.name, err)
+			continue
+		}
+		var addresses []uint64
+		for _, instr := range symInstrs[table.symbol] {
+			addresses = append(addresses, instr.Address)
+		}
+		if len(addresses) != len(table.addresses) {
+			t.Errorf("Unable to parse the instructions for %s, got: %x want: %x.", table.name, addresses, table.addresses)
+			continue
+		}
+		for i := range addresses {
+			if addresses[i] != table.addresses[i] {
+				t.Errorf("Unable to parse the instructions for %s, got: %x want: %x.", table.name, addresses, table.addresses)
+				break
+			}
+		}
+	}
+}
+
+func TestParseInstructions(t *testing.T) {
+	tables := []struct {
+		line   string
+		instr  *assembler.MachineInstruction
+		relocs []assembler.Relocation
+	}{
+		{
+			line:  "   2:\t00 00                \tadd    %al,(%rax)",
+			instr: &assembler.MachineInstruction{Address: 0x2, Command: "add", Arguments: []string{"%al", "(%rax)"}, Bytes: []byte{0x00, 0x00}},
+		},
+		{
+			line:   "   0:\te8 00 00 00 00       \tcall   5 <other+0x5>\t1: R_X86_64_PLT32\tmemcpy-0x4",
+			instr:  &assembler.MachineInstruction{Address: 0x0, Command: "call", Arguments: []string{"5 <other+0x5>"}, Bytes: []byte{0xe8, 0, 0, 0, 0}},
+			relocs: []assembler.Relocation{{Address: 0x1, Type: "R_X86_64_PLT32", Symbol: "memcpy-0x4"}},
+		},
+		{
+			line:  "   2:\tf8d0 3004 \tldr.w\tr3, [r0, #4]",
+			instr: &assembler.MachineInstruction{Address: 0x2, Command: "ldr.w", Arguments: []string{"r3", "[r0", "#4]"}, Bytes: []byte{0xf8, 0xd0, 0x30, 0x04}},
+		},
+		// the lines naming the symbols and the sections have no instructions
+		{line: "000000000000000e <loop>:"},
+		{line: "Disassembly of section .text:"},
+	}
+
+	for _, table := range tables {
+		instrs, err := parseInstructions(table.line, binary.LittleEndian)
+		switch {
+		case err != nil:
+			t.Errorf("Unable to parse %q : %v", table.line, err)
+		case table.instr == nil:
+			if len(instrs) != 0 {
+				t.Errorf("Unable to parse %q, got: %v want no instructions.", table.line, instrs)
+			}
+		case len(instrs) != 1:
+			t.Errorf("Unable to parse %q, got: %v want: %v.", table.line, instrs, *table.instr)
+		default:
+			got, want := instrs[0], *table.instr
+			if got.Address != want.Address || got.Command != want.Command || strings.Join(got.Arguments, ",") != strings.Join(want.Arguments, ",") ||
+				string(got.Bytes) != string(want.Bytes) || len(got.Relocations) != len(table.relocs) {
+				t.Errorf("Unable to parse %q, got: %+v want: %+v.", table.line, got, want)
+				continue
+			}
+			for i := range table.relocs {
+				if got.Relocations[i] != table.relocs[i] {
+					t.Errorf("Unable to parse the relocations of %q, got: %v want: %v.", table.line, got.Relocations, table.relocs)
+				}
+			}
+		}
+	}
+}
+
+func TestSectionStart(t *testing.T) {
+	tables := []struct {
+		line    string
+		section string
+	}{
+		{"Disassembly of section .text:", ".text"},
+		{"Disassembly of section .text.other:", ".text.other"},
+		{"0000000000000000 <other>:", ""},
+	}
+	for _, table := range tables {
+		section := ""
+		if matches := sectionStartRegex.FindStringSubmatch(table.line); matches != nil {
+			section = matches[1]
+		}
+		if section != table.section {
+			t.Errorf("Unable to find the section of %q, got: %q want: %q.", table.line, section, table.section)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+// Package goasm checks plan9 assembly generated by asm2go by assembling it with the Go toolchain
+package goasm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/anonymouse64/asm2go/assembler"
+)
+
+var (
+	// asmErrorLine matches the line number of an error from go tool asm, i.e. "verify.s:12: unrecognized instruction"
+	// or "asm: illegal combination: 00000 (verify.s:12)	MRS	$24194, R0 ..."
+	asmErrorLine = regexp.MustCompile(`\.s:(\d+)(?::\d+)?(?:: |\))`)
+	// asmErrorFunc matches the function of an error from go tool asm about a whole function, i.e.
+	// "asm: main.verify0: unbalanced PUSH/POP"
+	asmErrorFunc = regexp.MustCompile(`\.verify(\d+): `)
+	// objdumpLine matches an instruction from go tool objdump with the source line and the hex of the instruction,
+	// i.e. "  verify.s:5		0x0			e3500000		CMP $0, R0"
+	objdumpLine = regexp.MustCompile(`^\s+\S+\.s:(\d+)\s+0x[0-9a-f]+\s+([0-9a-f]+(?: [0-9a-f]{8})*)\t`)
+)
+
+// Verifier assembles plan9 assembly with the go tool of a Go toolchain
+type Verifier struct {
+	// GoExecutable is the go command of the toolchain
+	GoExecutable string
+	// GoRoot is the GOROOT of the toolchain, which has the include directory with textflag.h
+	GoRoot string
+}
+
+// NewVerifier returns a Verifier for the Go toolchain found on the $PATH
+func NewVerifier() (*Verifier, error) {
+	goExec, err := exec.LookPath("go")
+	if err != nil {
+		return nil, err
+	}
+	out, err := exec.Command(goExec, "env", "GOROOT").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("error finding GOROOT (%v) : \n%s", err, string(out))
+	}
+	return &Verifier{
+		GoExecutable: goExec,
+		GoRoot:       strings.TrimSpace(string(out)),
+	}, nil
+}
+
+// VerifyTranslations assembles the translation of each of the instructions with the Go assembler and sets KeepBytes
+// on every instruction where the Go assembler doesn't accept the translation, or encodes it into different bytes
+// than the original instruction
+func (v *Verifier) VerifyTranslations(arch string, instrs []assembler.MachineInstruction) error {
+	// Each translation is put into a TEXT of it's own, so the bytes for it can be found by it's line number
+	// The RET keeps any padding at the end of the function from being counted as part of the translation
+	candidates := make(map[int]int)
+	var buf bytes.Buffer
+	buf.WriteString("#include \"textflag.h\"\n")
+	line := 1
+	for i := range instrs {
+		translation, ok := instrs[i].Translation(arch)
+		if !ok || instrs[i].KeepBytes {
+			continue
+		}
+		fmt.Fprintf(&buf, "TEXT ·verify%d(SB), NOSPLIT|NOFRAME, $0-0\n    %s\n    RET\n", i, translation)
+		candidates[line+2] = i
+		line += 3
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// Any translation the Go assembler doesn't accept is taken out, until the rest of them assemble
+	src := buf.Bytes()
+	var dump []byte
+	for {
+		var err error
+		var asmOutput []byte
+		dump, asmOutput, err = v.assembleAndDump(arch, src)
+		if err == nil {
+			break
+		}
+		var errLines []int
+		for _, outLine := range strings.Split(string(asmOutput), "\n") {
+			if match := asmErrorLine.FindStringSubmatch(outLine); match != nil {
+				errLine, _ := strconv.Atoi(match[1])
+				errLines = append(errLines, errLine)
+			} else if match := asmErrorFunc.FindStringSubmatch(outLine); match != nil {
+				i, _ := strconv.Atoi(match[1])
+				for candidateLine, candidate := range candidates {
+					if candidate == i {
+						errLines = append(errLines, candidateLine)
+					}
+				}
+			}
+		}
+		removed := false
+		for _, errLine := range errLines {
+			if i, ok := candidates[errLine]; ok {
+				instrs[i].KeepBytes = true
+				delete(candidates, errLine)
+				removed = true
+			}
+		}
+		if !removed {
+			return err
+		}
+		src = commentOutLines(src, errLines)
+	}
+
+	got := make(map[int][]byte)
+	scanner := bufio.NewScanner(bytes.NewReader(dump))
+	for scanner.Scan() {
+		match := objdumpLine.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		srcLine, _ := strconv.Atoi(match[1])
+		instrBytes, err := objdumpBytes(arch, match[2])
+		if err != nil {
+			return err
+		}
+		got[srcLine] = append(got[srcLine], instrBytes...)
+	}
+
+	for srcLine, i := range candidates {
+		if !bytes.Equal(got[srcLine], instrs[i].MemoryBytes(arch)) {
+			instrs[i].KeepBytes = true
+		}
+	}
+
+	return nil
+}
+
+// AssembleFile assembles the plan9 assembly file for arch, returning an error with the output of the Go assembler
+// if it fails
+func (v *Verifier) AssembleFile(arch, file string) error {
+	dir, err := ioutil.TempDir("", "asm2go-verify")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	out, err := v.goTool(arch, "asm", "-I", filepath.Join(v.GoRoot, "pkg", "include"), "-p", "main",
+		"-o", filepath.Join(dir, "verify.o"), file)
+	if err != nil {
+		return fmt.Errorf("error assembling %s for %s (%v) : \n%s", file, arch, err, string(out))
+	}
+	return nil
+}
+
+// assembleAndDump assembles the source with the Go assembler and returns the objdump output for it
+// If the source doesn't assemble, the output of the Go assembler is returned along with the error
+func (v *Verifier) assembleAndDump(arch string, src []byte) ([]byte, []byte, error) {
+	dir, err := ioutil.TempDir("", "asm2go-verify")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	srcFile := filepath.Join(dir, "verify.s")
+	objFile := filepath.Join(dir, "verify.o")
+	if err := ioutil.WriteFile(srcFile, src, 0644); err != nil {
+		return nil, nil, err
+	}
+
+	out, err := v.goTool(arch, "asm", "-I", filepath.Join(v.GoRoot, "pkg", "include"), "-p", "main", "-o", objFile, srcFile)
+	if err != nil {
+		return nil, out, fmt.Errorf("error assembling translations for %s (%v) : \n%s", arch, err, string(out))
+	}
+
+	out, err = v.goTool(arch, "objdump", objFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error dumping translations for %s (%v) : \n%s", arch, err, string(out))
+	}
+	return out, nil, nil
+}
+
+// goTool runs the go tool cmd with the arguments for arch
+func (v *Verifier) goTool(arch, cmd string, args ...string) ([]byte, error) {
+	goCmd := exec.Command(v.GoExecutable, append([]string{"tool", cmd}, args...)...)
+	goCmd.Env = append(os.Environ(), "GOARCH="+arch, "GOOS=linux")
+	return goCmd.CombinedOutput()
+}
+
+// commentOutLines returns the source with the lines (counting from 1) commented out
+func commentOutLines(src []byte, lines []int) []byte {
+	comment := make(map[int]bool)
+	for _, line := range lines {
+		comment[line] = true
+	}
+	var out bytes.Buffer
+	for i, line := range strings.SplitAfter(string(src), "\n") {
+		if comment[i+1] {
+			out.WriteString("//")
+		}
+		out.WriteString(line)
+	}
+	return out.Bytes()
+}
+
+// objdumpBytes returns the bytes of an instruction in memory order from the hex shown by go tool objdump, which
+// shows the instructions of everything but x86 as 32-bit values where it can
+func objdumpBytes(arch, hexString string) ([]byte, error) {
+	words := strings.Fields(hexString)
+	if arch == "386" || arch == "amd64" || len(words[0])%8 != 0 {
+		return hex.DecodeString(hexString)
+	}
+
+	order := assembler.ByteOrder(arch)
+	var instrBytes []byte
+	for _, word := range words {
+		value, err := strconv.ParseUint(word, 16, 32)
+		if err != nil {
+			return nil, err
+		}
+		wordBytes := make([]byte, 4)
+		order.PutUint32(wordBytes, uint32(value))
+		instrBytes = append(instrBytes, wordBytes...)
+	}
+	return instrBytes, nil
+}
@@ -0,0 +1,68 @@
+package goasm
+
+import (
+	"testing"
+
+	"github.com/anonymouse64/asm2go/assembler"
+)
+
+func TestVerifyTranslations(t *testing.T) {
+	v, err := NewVerifier()
+	if err != nil {
+		t.Skipf("go toolchain not available on the system, skipping : %v.", err)
+	}
+
+	tt := []struct {
+		arch      string
+		instr     assembler.MachineInstruction
+		keepBytes bool
+	}{
+		// mov %edi,-0x4(%rbp)
+		{"amd64", assembler.MachineInstruction{Bytes: []byte{0x89, 0x7d, 0xfc}}, false},
+		// movzbl (%rdi),%eax, movslq %edi,%rax, cmove %rsi,%rax and movdqu %xmm1,(%rsi), which the Go assembler knows
+		// under other names than x86asm.GoSyntax has for them
+		{"amd64", assembler.MachineInstruction{Bytes: []byte{0x0f, 0xb6, 0x07}}, false},
+		{"amd64", assembler.MachineInstruction{Bytes: []byte{0x48, 0x63, 0xc7}}, false},
+		{"amd64", assembler.MachineInstruction{Bytes: []byte{0x48, 0x0f, 0x44, 0xc6}}, false},
+		{"amd64", assembler.MachineInstruction{Bytes: []byte{0xf3, 0x0f, 0x7f, 0x0e}}, false},
+		// add %al,%bl
+		{"amd64", assembler.MachineInstruction{Bytes: []byte{0x00, 0xc3}}, false},
+		// movzbl %al,%eax
+		{"386", assembler.MachineInstruction{Bytes: []byte{0x0f, 0xb6, 0xc0}}, false},
+		// mulld r3, r4, r5, lbzux r3, r4, r5 and std r31, -8(r1)
+		{"ppc64", assembler.MachineInstruction{Bytes: []byte{0x7c, 0x64, 0x29, 0xd2}}, false},
+		{"ppc64", assembler.MachineInstruction{Bytes: []byte{0x7c, 0x64, 0x28, 0xee}}, false},
+		{"ppc64", assembler.MachineInstruction{Bytes: []byte{0xfb, 0xe1, 0xff, 0xf8}}, false},
+		// ld.d $t5, $a1, -1816, bstrpick.d $s3, $s8, 0xb, 0x3 and ll.d $sp, $a4, -672, which is never translated as
+		// the Go assembler scales it's offset by 4
+		{"loong64", assembler.MachineInstruction{Bytes: []byte{0x28, 0xe3, 0xa0, 0xb1}}, false},
+		{"loong64", assembler.MachineInstruction{Bytes: []byte{0x00, 0xcb, 0x0f, 0xfa}}, false},
+		{"loong64", assembler.MachineInstruction{Bytes: []byte{0x22, 0x81, 0x75, 0x03}}, false},
+		// sltu ra, s1, s9
+		{"riscv64", assembler.MachineInstruction{Bytes: []byte{0x01, 0x94, 0xb0, 0xb3}}, false},
+		// add r0, r0, r1
+		{"arm", assembler.MachineInstruction{Bytes: []byte{0xe0, 0x80, 0x00, 0x01}}, false},
+		// add x0, x0, x1
+		{"arm64", assembler.MachineInstruction{Bytes: []byte{0x8b, 0x01, 0x00, 0x00}}, false},
+		// ldp x29, x30, [sp], #16
+		{"arm64", assembler.MachineInstruction{Bytes: []byte{0xa8, 0xc1, 0x7b, 0xfd}}, false},
+		// st4 {v19.2d-v22.2d}, [x0], #64, ld4 {v0.4s-v3.4s}, [x0], x1 and st2 {v0.16b, v1.16b}, [x0], #32, which update
+		// x0 after the access
+		{"arm64", assembler.MachineInstruction{Bytes: []byte{0x4c, 0x9f, 0x0c, 0x13}}, false},
+		{"arm64", assembler.MachineInstruction{Bytes: []byte{0x4c, 0xc1, 0x08, 0x00}}, false},
+		{"arm64", assembler.MachineInstruction{Bytes: []byte{0x4c, 0x9f, 0x80, 0x00}}, false},
+		// mov x0, #0x10000 - the Go assembler encodes MOVD $65536, R0 with a different instruction
+		{"arm64", assembler.MachineInstruction{Bytes: []byte{0xd2, 0xa0, 0x00, 0x20}}, true},
+		// mrs x0, tpidr_el0 - the Go assembler doesn't accept MRS $24194, R0
+		{"arm64", assembler.MachineInstruction{Bytes: []byte{0xd5, 0x3b, 0xd0, 0x40}}, true},
+	}
+	for _, test := range tt {
+		instrs := []assembler.MachineInstruction{test.instr}
+		err := v.VerifyTranslations(test.arch, instrs)
+		if err != nil || instrs[0].KeepBytes != test.keepBytes {
+			translation, _ := test.instr.Translation(test.arch)
+			t.Errorf("Unable to verify %s translation %q of %x, got: (err=%v, keepBytes=%t) want: (err=nil, keepBytes=%t).",
+				test.arch, translation, test.instr.Bytes, err, instrs[0].KeepBytes, test.keepBytes)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package assembler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LatestGoVersion is the minor version of the newest Go release the translations have been checked against, i.e.
+// 27 for Go 1.27 - any mnemonic added to the Go assembler in an unknown release is assumed to need this release
+const LatestGoVersion = 27
+
+// goVersionedBackend is implemented by backends where which instructions the Go assembler accepts depends on the
+// Go release, see RestrictToGoVersion
+type goVersionedBackend interface {
+	// goVersion returns the minor version of the first Go 1.x release known to accept the translation of the
+	// instruction
+	goVersion(instr MachineInstruction, goSyntax string) int
+}
+
+// goVersions returns the Go release for each of the whitespace separated mnemonics, keyed by the minor version of
+// the release
+func goVersions(releases map[int]string) map[string]int {
+	versions := make(map[string]int)
+	for minor, mnemonics := range releases {
+		for mnemonic := range stringSet(mnemonics) {
+			versions[mnemonic] = minor
+		}
+	}
+	return versions
+}
+
+// ParseGoVersion returns the minor version of a Go 1.x release, which can be given as i.e. "1.21", "go1.21" or
+// "1.21.3"
+func ParseGoVersion(version string) (int, error) {
+	fields := strings.Split(strings.TrimPrefix(version, "go"), ".")
+	if len(fields) < 2 || len(fields) > 3 || fields[0] != "1" {
+		return 0, fmt.Errorf("invalid Go version %q, expected i.e. 1.21", version)
+	}
+	minor, err := strconv.Atoi(fields[1])
+	if err != nil || minor < 0 {
+		return 0, fmt.Errorf("invalid Go version %q, expected i.e. 1.21", version)
+	}
+	return minor, nil
+}
+
+// CheckGoVersion returns an error if the Go 1.x release with the minor version doesn't support arch at all
+func CheckGoVersion(arch string, minor int) error {
+	backend, ok := Backend(arch)
+	if !ok {
+		return fmt.Errorf(unsupportedArch, arch)
+	}
+	if minor < backend.MinGoVersion() {
+		return fmt.Errorf("Go 1.%d doesn't support %s, which needs at least Go 1.%d", minor, arch, backend.MinGoVersion())
+	}
+	return nil
+}
+
+// RestrictToGoVersion sets KeepBytes on every instruction whose translation isn't accepted by the Go 1.x release
+// with the minor version, so that it is written out as it's bytes instead
+func RestrictToGoVersion(arch string, instrs []MachineInstruction, minor int) {
+	backend, _ := Backend(arch)
+	versioned, ok := backend.(goVersionedBackend)
+	if !ok {
+		return
+	}
+	for i := range instrs {
+		translation, ok := instrs[i].Translation(arch)
+		if ok && versioned.goVersion(instrs[i], translation) > minor {
+			instrs[i].KeepBytes = true
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package assembler
+
+import (
+	"testing"
+)
+
+func TestParseGoVersion(t *testing.T) {
+	tt := []struct {
+		version string
+		minor   int
+		valid   bool
+	}{
+		{"1.21", 21, true},
+		{"go1.21", 21, true},
+		{"1.21.3", 21, true},
+		{"1", 0, false},
+		{"2.1", 0, false},
+		{"1.x", 0, false},
+	}
+	for _, test := range tt {
+		minor, err := ParseGoVersion(test.version)
+		if (err == nil) != test.valid || minor != test.minor {
+			t.Errorf("Unable to parse Go version %q, got: (minor=%d, err=%v) want: (minor=%d, valid=%t).", test.version, minor, err, test.minor, test.valid)
+		}
+	}
+}
+
+func TestCheckGoVersion(t *testing.T) {
+	if err := CheckGoVersion("loong64", 18); err == nil {
+		t.Errorf("Expected an error for loong64 with Go 1.18.")
+	}
+	if err := CheckGoVersion("loong64", 19); err != nil {
+		t.Errorf("Unexpected error for loong64 with Go 1.19: %v.", err)
+	}
+}
+
+func TestRestrictToGoVersion(t *testing.T) {
+	tt := []struct {
+		arch      string
+		instr     MachineInstruction
+		minor     int
+		keepBytes bool
+	}{
+		// eor v0.16b, v19.16b, v25.16b
+		{"arm64", MachineInstruction{Bytes: []byte{0x6e, 0x39, 0x1e, 0x60}}, 11, false},
+		{"arm64", MachineInstruction{Bytes: []byte{0x6e, 0x39, 0x1e, 0x60}}, 10, true},
+		// fcmeq v3.4s, v2.4s, #0.0 - the release that added it isn't known
+		{"arm64", MachineInstruction{Bytes: []byte{0x4e, 0xa0, 0xd8, 0x43}}, LatestGoVersion - 1, true},
+		{"arm64", MachineInstruction{Bytes: []byte{0x4e, 0xa0, 0xd8, 0x43}}, LatestGoVersion, false},
+		// ldr x0, [sp, #8]
+		{"arm64", MachineInstruction{Bytes: []byte{0xf9, 0x40, 0x07, 0xe0}}, 5, false},
+		// clz a0, a0
+		{"riscv64", MachineInstruction{Bytes: []byte{0x60, 0x05, 0x15, 0x13}}, 22, true},
+		{"riscv64", MachineInstruction{Bytes: []byte{0x60, 0x05, 0x15, 0x13}}, 23, false},
+		// mul a0, a0, a1
+		{"riscv64", MachineInstruction{Bytes: []byte{0x02, 0xb5, 0x05, 0x33}}, 14, false},
+		// mov %rsp, %rbp
+		{"amd64", MachineInstruction{Bytes: []byte{0x48, 0x89, 0xe5}}, 0, false},
+		// pshufb %xmm1, %xmm0
+		{"amd64", MachineInstruction{Bytes: []byte{0x66, 0x0f, 0x38, 0x00, 0xc1}}, 9, true},
+		{"amd64", MachineInstruction{Bytes: []byte{0x66, 0x0f, 0x38, 0x00, 0xc1}}, 10, false},
+		// ld.d $t5, $a1, -1816
+		{"loong64", MachineInstruction{Bytes: []byte{0x28, 0xe3, 0xa0, 0xb1}}, 19, false},
+		// ldx.d $a0, $t8, $t6 and amswap.w $a5, $a2, $s1 - the releases that added them aren't known
+		{"loong64", MachineInstruction{Bytes: []byte{0x38, 0x0c, 0x4a, 0x84}}, LatestGoVersion - 1, true},
+		{"loong64", MachineInstruction{Bytes: []byte{0x38, 0x0c, 0x4a, 0x84}}, LatestGoVersion, false},
+		{"loong64", MachineInstruction{Bytes: []byte{0x38, 0x60, 0x1b, 0x09}}, LatestGoVersion - 1, true},
+	}
+	for _, test := range tt {
+		instrs := []MachineInstruction{test.instr}
+		RestrictToGoVersion(test.arch, instrs, test.minor)
+		if instrs[0].KeepBytes != test.keepBytes {
+			t.Errorf("Unable to restrict %s instruction %x to Go 1.%d, got: (keepBytes=%t) want: (keepBytes=%t).", test.arch, test.instr.Bytes, test.minor, instrs[0].KeepBytes, test.keepBytes)
+		}
+	}
+}
+
+func TestARM64VectorGoVersions(t *testing.T) {
+	for op := range arm64VectorGoVersions {
+		if !arm64VectorOps[op] {
+			t.Errorf("Go release given for %s, which isn't one of the arm64 vector instructions.", op)
+		}
+	}
+}
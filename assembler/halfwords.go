@@ -0,0 +1,55 @@
+package assembler
+
+import (
+	"fmt"
+	"io"
+)
+
+// halfwordWriter packs instructions made up of 16-bit parcels into WORD's, for architectures with 2 byte
+// instructions where the Go assembler doesn't have a directive smaller than 4 bytes, i.e. compressed RISC-V
+// instructions or Thumb instructions
+// WORD's are written in little endian, so the first parcel in memory is the low half of each WORD
+type halfwordWriter struct {
+	w io.Writer
+	// parcels which haven't been written out yet
+	parcels []uint16
+	// the instructions starting in the parcels that haven't been written out yet
+	started []MachineInstruction
+}
+
+// aligned returns whether everything has been written out, i.e. the next instruction starts on a WORD
+func (h *halfwordWriter) aligned() bool {
+	return len(h.parcels) == 0
+}
+
+// write adds the parcels of the instruction, writing out any WORD's that are complete
+func (h *halfwordWriter) write(instr MachineInstruction, parcels []uint16) {
+	h.parcels = append(h.parcels, parcels...)
+	h.started = append(h.started, instr)
+	for len(h.parcels) >= 2 {
+		h.writeWord(h.parcels[0], h.parcels[1])
+		h.parcels = h.parcels[2:]
+		h.started = nil
+	}
+}
+
+// pad writes out any remaining parcel as a WORD, using the padding instruction (named name) for the other half
+func (h *halfwordWriter) pad(padding uint16, name string) {
+	if h.aligned() {
+		return
+	}
+	h.writeWord(h.parcels[0], padding)
+	fmt.Fprintf(h.w, "    // padded with %s\n", name)
+	h.parcels = nil
+	h.started = nil
+}
+
+// writeWord writes out 2 parcels as a single WORD, with lo coming first in memory, along with the
+// instructions that start in the WORD as comments
+func (h *halfwordWriter) writeWord(lo, hi uint16) {
+	fmt.Fprintf(h.w, "    WORD $0x%04x%04x; \t", hi, lo)
+	for _, instr := range h.started {
+		instr.writeComment(h.w)
+	}
+	fmt.Fprintln(h.w)
+}
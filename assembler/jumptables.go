@@ -0,0 +1,121 @@
+package assembler
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// JumpTable is a jump through a table of addresses in the function, i.e. for a switch statement, which can't be
+// written out as it is, as the Go assembler lays out the function again and Go assembly has no way to put the address
+// of a label into data
+// It's written out as a ladder comparing the index with every entry of the table and jumping to the label for the
+// address of the entry that matches, which changes the flags, unlike the jump it's in place of
+type JumpTable struct {
+	// Table is where the table is in the object file, i.e. ".rodata+0x10"
+	Table string
+	// Index is the Go name of the register holding the index into the table
+	Index string
+	// Targets are the addresses in the function the entries of the table point at, in order
+	Targets []uint64
+	// compare, jumpEqual and jump are the Go instructions comparing the index with a constant, jumping if it's equal,
+	// and jumping unconditionally
+	compare, jumpEqual, jump string
+}
+
+// jumpTableAnalyzer is implemented by backends which can find the jumps through tables in their instructions, see
+// ResolveJumpTables
+type jumpTableAnalyzer interface {
+	// jumpTables sets the JumpTable of the instructions of a function in section starting a jump through one of
+	// the tables in the data sections, which are found through the relocations of the data sections, and marks the
+	// rest of the instructions of the jump InReference
+	jumpTables(instrs []MachineInstruction, section string, relocs map[string][]Relocation) error
+}
+
+// ResolveJumpTables sets the JumpTable of every instruction of the function caller which starts a jump through a
+// table of addresses in the function, as the entries of the table would be filled in by the linker with the
+// addresses the instructions had in the object file
+// relocs are the relocations of the data sections of the object file, see Assembler.ProcessDataRelocations
+// It returns an error naming the table for the jumps through a table which can't be written out with labels
+func ResolveJumpTables(arch string, instrs []MachineInstruction, caller Symbol, relocs map[string][]Relocation) error {
+	backend, _ := Backend(arch)
+	analyzer, ok := backend.(jumpTableAnalyzer)
+	if !ok || len(instrs) == 0 || len(relocs) == 0 {
+		return nil
+	}
+	if err := analyzer.jumpTables(instrs, caller.Section, relocs); err != nil {
+		return err
+	}
+
+	for _, instr := range instrs {
+		if instr.JumpTable == nil {
+			continue
+		}
+		if _, ok := branchTargets(arch, instrs); !ok {
+			return fmt.Errorf("instruction \"%s\" at %#x jumps through the table at %s, but the branches of the function can't be written with labels for it's entries",
+				strings.TrimSpace(instr.InstructionString), instr.Address, instr.JumpTable.Table)
+		}
+		break
+	}
+	return nil
+}
+
+// tableTargets returns the addresses the entries of the table offset bytes into a data section point at, going by
+// relocs, the relocations of the data section
+// Each entry is size bytes, and is either the address of the target in section, or for a relative table, the
+// offset of the target from the start of the table
+// The table ends at the first entry which doesn't point into the function from start to end, as the size of the
+// table isn't known
+func tableTargets(relocs []Relocation, offset uint64, size int, relative bool, section string, start, end uint64) []uint64 {
+	byAddress := make(map[uint64]Relocation)
+	for _, reloc := range relocs {
+		byAddress[reloc.Address] = reloc
+	}
+
+	var targets []uint64
+	for entry := offset; ; entry += uint64(size) {
+		reloc, ok := byAddress[entry]
+		if !ok || (relocationKind(reloc.Type) == "a PC-relative reference") != relative {
+			break
+		}
+		name, addend := reloc.target()
+		if relative {
+			// the entry holds the target relative to the entry itself, plus how far the entry is into the table
+			addend -= int64(entry - offset)
+		}
+		target := uint64(addend)
+		if name != section || target < start || target >= end {
+			break
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// writeJumpTable writes out the jump through a table as a ladder comparing the index with each entry of the table
+// and jumping to the label for it's target, with the last entry (and any other going to the same target) taken by
+// the final unconditional jump, as the native code doesn't jump through the table with an index past the end
+func (instr MachineInstruction) writeJumpTable(w io.Writer, labels map[uint64]string) {
+	table := instr.JumpTable
+	last := table.Targets[len(table.Targets)-1]
+
+	// the native instruction is only added as a comment to the first line
+	commented := false
+	endLine := func() {
+		if !commented {
+			instr.writeComment(w)
+			commented = true
+		}
+		fmt.Fprintln(w)
+	}
+	for i, target := range table.Targets[:len(table.Targets)-1] {
+		if target == last {
+			continue
+		}
+		fmt.Fprintf(w, "    %s %s, $%d \t", table.compare, table.Index, i)
+		endLine()
+		fmt.Fprintf(w, "    %s %s\n", table.jumpEqual, labels[target])
+	}
+	fmt.Fprintf(w, "    %s %s \t", table.jump, labels[last])
+	endLine()
+}
@@ -0,0 +1,144 @@
+package assembler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestResolveJumpTables(t *testing.T) {
+	caller := Symbol{Name: "f", Section: ".text", Global: true, Function: true}
+	tables := []struct {
+		name   string
+		arch   string
+		instrs []MachineInstruction
+		relocs map[string][]Relocation
+		want   string
+		err    string
+	}{
+		{
+			name: "amd64 table of addresses",
+			arch: "amd64",
+			instrs: []MachineInstruction{
+				{Address: 0x0, Command: "cmp", Arguments: []string{"$0x2", "%rdi"}, Bytes: []byte{0x48, 0x83, 0xff, 0x02}},
+				{Address: 0x4, Command: "ja", Arguments: []string{"16"}, Bytes: []byte{0x77, 0x10}},
+				{Address: 0x6, Command: "jmp", Arguments: []string{"*0x0(,%rdi,8)"}, Bytes: []byte{0xff, 0x24, 0xfd, 0, 0, 0, 0},
+					Relocations: []Relocation{{0x9, "R_X86_64_32S", ".rodata"}}},
+				{Address: 0xd, Command: "mov", Arguments: []string{"%rsi", "%rax"}, Bytes: []byte{0x48, 0x89, 0xf0}},
+				{Address: 0x10, Command: "ret", Bytes: []byte{0xc3}},
+				{Address: 0x11, Command: "lea", Arguments: []string{"0x1(%rsi)", "%rax"}, Bytes: []byte{0x48, 0x8d, 0x46, 0x01}},
+				{Address: 0x15, Command: "ret", Bytes: []byte{0xc3}},
+				{Address: 0x16, Command: "xor", Arguments: []string{"%eax", "%eax"}, Bytes: []byte{0x31, 0xc0}},
+				{Address: 0x18, Command: "ret", Bytes: []byte{0xc3}},
+			},
+			relocs: map[string][]Relocation{
+				".rodata": {
+					{0x0, "R_X86_64_64", ".text+0xd"},
+					{0x8, "R_X86_64_64", ".text+0x11"},
+					{0x10, "R_X86_64_64", ".text+0x16"},
+					// the table of another function
+					{0x18, "R_X86_64_64", ".text+0x40"},
+				},
+			},
+			want: "CMPQ DI, $0x2 // cmp $0x2 %rdi JA L_16 // ja 16 " +
+				"CMPQ DI, $0 // jmp *0x0(,%rdi,8) JEQ L_d CMPQ DI, $1 JEQ L_11 JMP L_16 " +
+				"L_d: MOVQ SI, AX // mov %rsi %rax RET // ret L_11: LEAQ 0x1(SI), AX // lea 0x1(%rsi) %rax RET // ret " +
+				"L_16: XORL AX, AX // xor %eax %eax RET // ret",
+		},
+		{
+			name: "amd64 table of relative offsets",
+			arch: "amd64",
+			instrs: []MachineInstruction{
+				{Address: 0x0, Command: "lea", Arguments: []string{"0x0(%rip)", "%rdx"}, Bytes: []byte{0x48, 0x8d, 0x15, 0, 0, 0, 0},
+					Relocations: []Relocation{{0x3, "R_X86_64_PC32", ".rodata+0x4"}}},
+				{Address: 0x7, Command: "movslq", Arguments: []string{"(%rdx,%rdi,4)", "%rax"}, Bytes: []byte{0x48, 0x63, 0x04, 0xba}},
+				{Address: 0xb, Command: "add", Arguments: []string{"%rdx", "%rax"}, Bytes: []byte{0x48, 0x01, 0xd0}},
+				{Address: 0xe, Command: "jmp", Arguments: []string{"*%rax"}, Bytes: []byte{0xff, 0xe0}},
+				{Address: 0x10, Command: "mov", Arguments: []string{"%rsi", "%rax"}, Bytes: []byte{0x48, 0x89, 0xf0}},
+				{Address: 0x13, Command: "ret", Bytes: []byte{0xc3}},
+				{Address: 0x14, Command: "xor", Arguments: []string{"%eax", "%eax"}, Bytes: []byte{0x31, 0xc0}},
+				{Address: 0x16, Command: "ret", Bytes: []byte{0xc3}},
+			},
+			relocs: map[string][]Relocation{
+				".rodata": {
+					{0x8, "R_X86_64_PC32", ".text+0x10"},
+					{0xc, "R_X86_64_PC32", ".text+0x18"},
+					{0x10, "R_X86_64_PC32", ".text+0x18"},
+				},
+			},
+			// the first entry goes to the same place as the last one
+			want: "CMPQ DI, $1 // lea 0x0(%rip) %rdx JEQ L_14 JMP L_10 " +
+				"// movslq (%rdx,%rdi,4) %rax // add %rdx %rax // jmp *%rax " +
+				"L_10: MOVQ SI, AX // mov %rsi %rax RET // ret L_14: XORL AX, AX // xor %eax %eax RET // ret",
+		},
+		{
+			name: "386 table of addresses",
+			arch: "386",
+			instrs: []MachineInstruction{
+				// the table is 0x10 bytes into .rodata, which is kept in the bytes of the instruction
+				{Address: 0x0, Command: "jmp", Arguments: []string{"*0x10(,%eax,4)"}, Bytes: []byte{0xff, 0x24, 0x85, 0x10, 0, 0, 0},
+					Relocations: []Relocation{{0x3, "R_386_32", ".rodata"}}},
+				{Address: 0x7, Command: "inc", Arguments: []string{"%eax"}, Bytes: []byte{0x40}},
+				{Address: 0x8, Command: "ret", Bytes: []byte{0xc3}},
+				{Address: 0x9, Command: "xor", Arguments: []string{"%eax", "%eax"}, Bytes: []byte{0x31, 0xc0}},
+				{Address: 0xb, Command: "ret", Bytes: []byte{0xc3}},
+			},
+			relocs: map[string][]Relocation{
+				".rodata": {
+					{0x10, "R_386_32", ".text+0x7"},
+					{0x14, "R_386_32", ".text+0x9"},
+				},
+			},
+			want: "CMPL AX, $0 // jmp *0x10(,%eax,4) JEQ L_7 JMP L_9 " +
+				"L_7: INCL AX // inc %eax RET // ret L_9: XORL AX, AX // xor %eax %eax RET // ret",
+		},
+		{
+			name: "amd64 table pointing out of the function",
+			arch: "amd64",
+			instrs: []MachineInstruction{
+				{Address: 0x0, InstructionString: "jmp *0x0(,%rdi,8)", Bytes: []byte{0xff, 0x24, 0xfd, 0, 0, 0, 0},
+					Relocations: []Relocation{{0x3, "R_X86_64_32S", ".rodata"}}},
+			},
+			relocs: map[string][]Relocation{".rodata": {{0x0, "R_X86_64_64", ".text+0x40"}}},
+			err:    `instruction "jmp *0x0(,%rdi,8)" at 0x0 jumps through the table at .rodata+0x0, but it's entries don't point into the function`,
+		},
+		{
+			name: "amd64 table without labels",
+			arch: "amd64",
+			instrs: []MachineInstruction{
+				{Address: 0x0, InstructionString: "jmp *0x0(,%rdi,8)", Bytes: []byte{0xff, 0x24, 0xfd, 0, 0, 0, 0},
+					Relocations: []Relocation{{0x3, "R_X86_64_32S", ".rodata"}}},
+				// lea 0x0(%rip),%rax, which depends on where it is
+				{Address: 0x7, Bytes: []byte{0x48, 0x8d, 0x05, 0, 0, 0, 0}},
+			},
+			relocs: map[string][]Relocation{".rodata": {{0x0, "R_X86_64_64", ".text+0x7"}}},
+			err:    `instruction "jmp *0x0(,%rdi,8)" at 0x0 jumps through the table at .rodata+0x0, but the branches of the function can't be written with labels`,
+		},
+	}
+
+	for _, table := range tables {
+		err := ResolveJumpTables(table.arch, table.instrs, caller, table.relocs)
+		switch {
+		case table.err != "":
+			if err == nil || !strings.Contains(err.Error(), table.err) {
+				t.Errorf("Unable to reject jump table in %s, got: (err=%v) want: (err=%s).", table.name, err, table.err)
+			}
+			continue
+		case err != nil:
+			t.Errorf("Unable to resolve jump table in %s : %v", table.name, err)
+			continue
+		}
+		if err := CheckRelocations(table.arch, table.instrs, nil); err != nil {
+			t.Errorf("Unable to resolve the relocations of the jump table in %s : %v", table.name, err)
+		}
+
+		var buf bytes.Buffer
+		if err := WriteInstructions(table.arch, &buf, table.instrs, true); err != nil {
+			t.Errorf("Unable to write jump table in %s : %v", table.name, err)
+			continue
+		}
+		if got := adjustWhitespace(buf.String()); got != table.want {
+			t.Errorf("Unable to write jump table in %s, got:\n%s\nwant:\n%s", table.name, got, table.want)
+		}
+	}
+}
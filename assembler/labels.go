@@ -0,0 +1,139 @@
+package assembler
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// pcRelative describes how an instruction depends on it's own address
+type pcRelative int
+
+const (
+	// notPCRelative instructions work the same wherever they are placed
+	notPCRelative pcRelative = iota
+	// labelBranch instructions are direct branches, which can be written with a label for their target
+	labelBranch
+	// positionDependent instructions depend on their address in a way that can't be written with a label, i.e.
+	// PC-relative loads or calls, so none of the instructions around them can be moved
+	positionDependent
+)
+
+// labelName returns the name of the Go label for the address inside of a function
+func labelName(address uint64) string {
+	return fmt.Sprintf("L_%x", address)
+}
+
+// branch returns how the instruction depends on it's address, and for a labelBranch instruction, the address of the
+// target and the instruction in Go syntax with the target named using symname
+func (instr MachineInstruction) branch(arch string, symname func(uint64) (string, uint64)) (pcRelative, uint64, string) {
+	backend, _ := Backend(arch)
+	if analyzer, ok := backend.(branchAnalyzer); ok {
+		return analyzer.branch(instr, symname)
+	}
+	return positionDependent, 0, ""
+}
+
+// branchLabels returns the labels for the targets of the branches in the instructions of a function, keyed by address
+// It returns false if the branches can't be written with labels, i.e. the architecture isn't supported or one of the
+// instructions depends on it's address in another way, in which case every instruction needs to stay exactly where
+// it is, so the branches are left as they are
+func branchLabels(arch string, instrs []MachineInstruction) (map[uint64]string, bool) {
+	labels, ok := branchTargets(arch, instrs)
+	return labels, ok && len(labels) != 0
+}
+
+// branchTargets returns the labels for the targets of the branches in the instructions of a function like
+// branchLabels, but also returns true if there are no branches at all, as long as none of the instructions depend on
+// their address in another way
+func branchTargets(arch string, instrs []MachineInstruction) (map[uint64]string, bool) {
+	if len(instrs) == 0 {
+		return nil, false
+	}
+
+	// Branches can only be rewritten if they go to the start of an instruction in this function, or to the end of
+	// the function, where the RET is added
+	last := instrs[len(instrs)-1]
+	targets := map[uint64]bool{
+		last.Address + uint64(len(last.Bytes)): true,
+	}
+	for _, instr := range instrs {
+		targets[instr.Address] = true
+	}
+
+	labels := make(map[uint64]string)
+	for _, instr := range instrs {
+		if instr.byteOrder(arch) != ByteOrder(arch) {
+			// none of the instructions are translated, see WriteOutput
+			return nil, false
+		}
+		if instr.JumpTable != nil {
+			// every entry of a jump through a table is a branch of it's own, see writeJumpTable
+			for _, target := range instr.JumpTable.Targets {
+				if !targets[target] {
+					return nil, false
+				}
+				labels[target] = labelName(target)
+			}
+			continue
+		}
+		if !instr.movesWithLabels(arch) {
+			continue
+		}
+		kind, target, _ := instr.branch(arch, noSymbols)
+		switch {
+		case kind == positionDependent,
+			kind == labelBranch && !targets[target]:
+			return nil, false
+		case kind == labelBranch:
+			labels[target] = labelName(target)
+		}
+	}
+
+	return labels, true
+}
+
+// labelsAllowed returns whether the branches of the function can be written with labels on arch at all, which they
+// can't on architectures with branch delay slots, or for functions the backend writes out as a whole, see
+// WriteInstructions
+func labelsAllowed(arch string, instrs []MachineInstruction) bool {
+	backend, _ := Backend(arch)
+	if _, ok := backend.(delaySlotter); ok {
+		return false
+	}
+	writer, ok := backend.(functionWriter)
+	return !ok || !writer.writesFunction(instrs)
+}
+
+// movesWithLabels returns whether the instruction needs to be checked when branches are written with labels
+// Instructions with relocations don't, as they are rewritten to refer to the symbols the linker fills in for them
+// (see CheckRelocations), and neither do calls to other functions (see ResolveCalls) or to the PC thunks, which are
+// rewritten to call the Go implementations of the thunks (see WritePCThunk), or data inside of the code, which isn't
+// an instruction
+func (instr MachineInstruction) movesWithLabels(arch string) bool {
+	if len(instr.Relocations) != 0 || instr.SymbolReference != "" || instr.Data {
+		return false
+	}
+	return !instr.isPCThunkCall(arch)
+}
+
+// noSymbols is a symbol lookup function for the disassemblers which doesn't know any symbols
+func noSymbols(uint64) (string, uint64) {
+	return "", 0
+}
+
+// writeBranch writes out the branch instruction using the label for it's target
+func (instr MachineInstruction) writeBranch(arch string, w io.Writer, labels map[uint64]string) {
+	_, target, goSyntax := instr.branch(arch, func(address uint64) (string, uint64) {
+		if label, ok := labels[address]; ok {
+			return label, address
+		}
+		return "", 0
+	})
+
+	// The disassemblers name the target as a symbol, i.e. "JMP L_1c(SB)", but labels are used without (SB)
+	label := labels[target]
+	fmt.Fprintf(w, "    %s \t", strings.Replace(goSyntax, label+"(SB)", label, 1))
+	instr.writeComment(w)
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,187 @@
+package assembler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/arch/loong64/loong64asm"
+)
+
+func init() {
+	RegisterBackend(loong64Backend{})
+}
+
+// loong64Backend is the ArchBackend for loong64
+type loong64Backend struct{}
+
+func (loong64Backend) Arch() string {
+	return "loong64"
+}
+
+func (loong64Backend) MinGoVersion() int {
+	return 19
+}
+
+func (loong64Backend) GNUTargets() []string {
+	return []string{"loongarch64"}
+}
+
+func (loong64Backend) ByteOrder() binary.ByteOrder {
+	return binary.LittleEndian
+}
+
+func (loong64Backend) ObjdumpShowsValues() bool {
+	return true
+}
+
+// Directives returns only WORD = 4 bytes, as loong64 instructions are always 4 bytes and WORD is the only directive
+func (loong64Backend) Directives() []Directive {
+	return []Directive{{"WORD", 4}}
+}
+
+func (loong64Backend) Translate(instr MachineInstruction, w io.Writer) error {
+	return instr.writeLoong64Supported(w)
+}
+
+// IsPadding returns whether the instruction is the loong64 nop (andi $zero, $zero, 0)
+func (loong64Backend) IsPadding(instr MachineInstruction) bool {
+	return len(instr.Bytes) == 4 && binary.BigEndian.Uint32(instr.Bytes) == 0x03400000
+}
+
+func (loong64Backend) PCAlign() (PCAlignment, bool) {
+	return PCAlignment{GoVersion: 22, Min: 8, Max: 2048}, true
+}
+
+func (loong64Backend) TranslationNeedsVerification() bool {
+	return false
+}
+
+// goVersion returns the Go release known to accept an instruction, which is only known for the instructions the
+// loong64 port came with - any indexed load or store, i.e. "MOVV (R5)(R6), R4", came later
+func (b loong64Backend) goVersion(instr MachineInstruction, goSyntax string) int {
+	op := strings.SplitN(goSyntax, " ", 2)[0]
+	if minor, ok := loong64GoVersions[op]; ok && !strings.Contains(goSyntax, ")(") {
+		return minor
+	}
+	return LatestGoVersion
+}
+
+// loong64GoVersions are the Go releases known to accept a mnemonic, the floating point compares aren't in it as the
+// loong64 port only had them without the condition flag register, i.e. "CMPGTF F16, F0, FCC7"
+var loong64GoVersions = goVersions(map[int]string{
+	19: `
+ABSD ABSF ADD ADDD ADDF ADDU ADDV ADDVU AND CLO CLZ DIV DIVD DIVF DIVU DIVV DIVVU MASKEQZ MASKNEZ
+MOVB MOVBU MOVD MOVDF MOVDV MOVDW MOVF MOVFD MOVFV MOVFW MOVH MOVHU MOVV MOVVD MOVVF MOVW MOVWD MOVWF MOVWU
+MUL MULD MULF MULHU MULHV MULHVU MULU MULV MULVU NEGD NEGF NOR OR REM REMU REMV REMVU ROTR ROTRV
+SGT SGTU SLL SLLV SQRTD SQRTF SRA SRAV SRL SRLV SUB SUBD SUBF SUBU SUBV SUBVU TRUNCDV TRUNCDW TRUNCFV TRUNCFW XOR
+`,
+})
+
+// writeLoong64Supported translates a loong64 instruction into plan9 syntax using loong64asm
+func (instr MachineInstruction) writeLoong64Supported(w io.Writer) error {
+	// the loong64 decoder expects the bytes in little endian, whatever the byte order of the object
+	instrBytes := instr.littleEndianBytes("loong64")
+	goInstr, err := loong64asm.Decode(instrBytes)
+	if err != nil || goInstr.Op == 0 || len(instr.Bytes) != 4 {
+		// Then we couldn't decode this instruction and we should
+		// use the WORD method
+		return fmt.Errorf(unrecognizedInstr, instr.Command)
+	}
+
+	goSyntax := loong64asm.GoSyntax(goInstr, instr.Address, nil)
+	if !loong64GoSyntaxAccepted(goInstr, goSyntax) {
+		return fmt.Errorf(unrecognizedInstr, instr.Command)
+	}
+
+	fmt.Fprintf(w, "%s \t", goSyntax)
+	return nil
+}
+
+// loong64GoSyntaxAccepted returns whether the Go assembler encodes the output of loong64asm.GoSyntax into the
+// same instruction again
+func loong64GoSyntaxAccepted(inst loong64asm.Inst, goSyntax string) bool {
+	switch inst.Op {
+	case loong64asm.B, loong64asm.BL, loong64asm.JIRL,
+		loong64asm.BEQ, loong64asm.BNE, loong64asm.BLT, loong64asm.BGE, loong64asm.BLTU, loong64asm.BGEU,
+		loong64asm.BEQZ, loong64asm.BNEZ, loong64asm.BCEQZ, loong64asm.BCNEZ,
+		loong64asm.PCADDI, loong64asm.PCADDU12I, loong64asm.PCADDU18I, loong64asm.PCALAU12I:
+		// PC-relative instructions are laid out again by the Go assembler
+		return false
+	case loong64asm.LU12I_W, loong64asm.LU32I_D, loong64asm.LU52I_D:
+		// the Go assembler only builds large constants through MOVW and MOVV
+		return false
+	case loong64asm.ADDI_W, loong64asm.ADDI_D:
+		// with the zero register or a zero immediate these are shown as moves, which the Go assembler encodes
+		// with other instructions
+		if imm, ok := inst.Args[2].(loong64asm.Simm16); inst.Args[1] == loong64asm.R0 || !ok || imm.Imm == 0 {
+			return false
+		}
+	case loong64asm.LL_W, loong64asm.LL_D, loong64asm.SC_W, loong64asm.SC_D:
+		// loong64asm shows the offset of these unscaled, while the Go assembler scales it by 4
+		return false
+	case loong64asm.AMADD_B, loong64asm.AMADD_H, loong64asm.AMADD_DB_B, loong64asm.AMADD_DB_H:
+		// the Go assembler doesn't have these
+		return false
+	case loong64asm.BSTRINS_W, loong64asm.BSTRINS_D, loong64asm.BSTRPICK_W, loong64asm.BSTRPICK_D:
+		// the Go assembler doesn't accept a msb below the lsb
+		msb, _ := inst.Args[2].(loong64asm.Uimm)
+		lsb, _ := inst.Args[3].(loong64asm.Uimm)
+		if msb.Imm < lsb.Imm {
+			return false
+		}
+	case loong64asm.MASKEQZ, loong64asm.MASKNEZ:
+		// the Go assembler only accepts the 3 operand form of these
+		if strings.Count(goSyntax, ",") != 2 {
+			return false
+		}
+	}
+
+	fields := strings.SplitN(goSyntax, " ", 2)
+	if fields[0] == "Unknown" || fields[0] == "?" {
+		// the disassembler doesn't have a Go name for this instruction
+		return false
+	}
+
+	// Some instructions are shown without all of their operands, i.e. the hint of DBAR, or "MOVW R4" for
+	// "sll.w $a0, $a0, 0", which the Go assembler either doesn't accept or encodes differently
+	var operands []string
+	if len(fields) == 2 {
+		operands = strings.Split(fields[1], ", ")
+	}
+	args := 0
+	for _, arg := range inst.Args {
+		if arg != nil {
+			args++
+		}
+	}
+	if len(operands) < 2 && len(operands) < args {
+		return false
+	}
+
+	if strings.HasPrefix(inst.Op.String(), "AM") && (inst.Args[0] == inst.Args[1] || inst.Args[0] == inst.Args[2]) {
+		// the Go assembler doesn't accept an atomic memory access whose destination is one of it's sources
+		return false
+	}
+
+	for _, operand := range operands {
+		if strings.Contains(operand, "R22") {
+			// R22 is the g register for the Go assembler, and it doesn't accept the name R22
+			return false
+		}
+		if m := loong64Displacement.FindStringSubmatch(operand); m != nil {
+			// the Go assembler loads displacements within 2 of the limits into R30 first
+			if d, err := strconv.Atoi(m[1]); err != nil || d < -2045 || d > 2045 {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// loong64Displacement matches the displacement of a memory operand, i.e. "-8" in "-8(R3)"
+var loong64Displacement = regexp.MustCompile(`^(-?[0-9]+)\(R[0-9]+\)`)
@@ -0,0 +1,37 @@
+package assembler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLoong64Translation(t *testing.T) {
+	tt := []struct {
+		name        string
+		bytes       []byte
+		translation string
+	}{
+		{"ld.d $t5, $a1, -1816", []byte{0x28, 0xe3, 0xa0, 0xb1}, "MOVV -1816(R5), R17"},
+		{"bstrpick.d $s3, $s8, 0xb, 0x3", []byte{0x00, 0xcb, 0x0f, 0xfa}, "BSTRPICKV $11, R31, $3, R26"},
+		// the Go assembler scales the offset of ll and sc by 4, while loong64asm doesn't
+		{"ll.d $t1, $a3, 9404", []byte{0x22, 0x24, 0xbc, 0xed}, ""},
+		{"ll.d $sp, $a4, -672", []byte{0x22, 0x81, 0x75, 0x03}, ""},
+		{"sc.d $t0, $t6, 1240", []byte{0x23, 0x53, 0x61, 0x54}, ""},
+		// the Go assembler doesn't have amadd.b, and doesn't accept a msb below the lsb or an atomic memory
+		// access writing one of it's sources
+		{"amadd.b $a6, $s1, $s2", []byte{0x38, 0x5d, 0x63, 0x2a}, ""},
+		{"bstrpick.d $a4, $a5, 0x2a, 0x35", []byte{0x00, 0xea, 0xd5, 0x28}, ""},
+		{"amand.w $zero, $a3, $zero", []byte{0x38, 0x62, 0x1c, 0x00}, ""},
+		// the Go assembler splits up a displacement this close to the limit, using R30
+		{"ld.b $a1, $t1, 2047", []byte{0x28, 0x1f, 0xfd, 0xa5}, ""},
+	}
+	for _, test := range tt {
+		var buf bytes.Buffer
+		err := MachineInstruction{Bytes: test.bytes}.writeLoong64Supported(&buf)
+		translation := strings.TrimSpace(buf.String())
+		if translation != test.translation || (err == nil) != (test.translation != "") {
+			t.Errorf("Unable to translate loong64 instruction %s, got: (%q, err=%v) want: %q.", test.name, translation, err, test.translation)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package assembler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+func init() {
+	for _, arch := range []string{"mips", "mipsle", "mips64", "mips64le"} {
+		RegisterBackend(mipsBackend{arch: arch})
+	}
+}
+
+// mipsBackend is the ArchBackend for the 32 and 64-bit MIPS architectures, in either byte order
+type mipsBackend struct {
+	arch string
+}
+
+func (b mipsBackend) Arch() string {
+	return b.arch
+}
+
+// MinGoVersion returns 6 for mips64 and mips64le, and 8 for the 32-bit mips and mipsle
+func (b mipsBackend) MinGoVersion() int {
+	if strings.HasPrefix(b.arch, "mips64") {
+		return 6
+	}
+	return 8
+}
+
+func (b mipsBackend) GNUTargets() []string {
+	switch b.arch {
+	case "mipsle":
+		return []string{"mipsel", "mipsisa32r2el"}
+	case "mips64":
+		return []string{"mips64", "mipsisa64r2"}
+	case "mips64le":
+		return []string{"mips64el", "mipsisa64r2el"}
+	}
+	return []string{"mips"}
+}
+
+func (b mipsBackend) ByteOrder() binary.ByteOrder {
+	if strings.HasSuffix(b.arch, "le") {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// ObjdumpShowsValues returns true, as objdump shows MIPS instructions as a single 32-bit value for both byte orders
+func (b mipsBackend) ObjdumpShowsValues() bool {
+	return true
+}
+
+// Directives returns only WORD = 4 bytes, as MIPS instructions are always 4 bytes and the Go assembler has no smaller
+// directive for MIPS - anything which doesn't fill whole WORD's is packed into WORD's by WriteInstructions
+func (b mipsBackend) Directives() []Directive {
+	return []Directive{{"WORD", 4}}
+}
+
+// writesFunction returns whether any of the instructions don't fill whole WORD's, see writeWordPackedInstructions
+func (b mipsBackend) writesFunction(instrs []MachineInstruction) bool {
+	return !wordsFill(instrs)
+}
+
+// writeFunction never translates, which keeps the branches and their delay slots as they are
+func (b mipsBackend) writeFunction(w io.Writer, instrs []MachineInstruction, tryTranslate bool) error {
+	return writeWordPackedInstructions(b.arch, w, instrs, false)
+}
+
+// Translate never translates, as there is no MIPS disassembler in golang.org/x/arch
+func (b mipsBackend) Translate(instr MachineInstruction, w io.Writer) error {
+	return fmt.Errorf(unrecognizedInstr, instr.Command)
+}
+
+// IsPadding returns whether the instruction is the MIPS nop (sll zero, zero, 0)
+func (b mipsBackend) IsPadding(instr MachineInstruction) bool {
+	return len(instr.Bytes) == 4 && binary.BigEndian.Uint32(instr.Bytes) == 0
+}
+
+// PCAlign returns false, as the Go assembler doesn't have PCALIGN for MIPS
+func (b mipsBackend) PCAlign() (PCAlignment, bool) {
+	return PCAlignment{}, false
+}
+
+func (b mipsBackend) TranslationNeedsVerification() bool {
+	return false
+}
+
+func (b mipsBackend) hasDelaySlot(instr MachineInstruction) bool {
+	return instr.mipsHasDelaySlot()
+}
+
+// mipsHasDelaySlot returns whether the instruction is a MIPS branch or jump, which always executes the instruction
+// following it (the delay slot) before the branch takes effect
+// objdump shows MIPS instructions as a single 32-bit value for both byte orders, so the opcode fields are
+// decoded from the bytes as is
+func (instr MachineInstruction) mipsHasDelaySlot() bool {
+	if len(instr.Bytes) != 4 {
+		return false
+	}
+	word := binary.BigEndian.Uint32(instr.Bytes)
+	opcode := word >> 26
+	rs := (word >> 21) & 0x1f
+	rt := (word >> 16) & 0x1f
+	switch opcode {
+	case 0x00:
+		// SPECIAL: jr, jalr
+		funct := word & 0x3f
+		return funct == 0x08 || funct == 0x09
+	case 0x01:
+		// REGIMM: bltz, bgez, bltzl, bgezl, bltzal, bgezal, bltzall, bgezall
+		switch rt {
+		case 0x00, 0x01, 0x02, 0x03, 0x10, 0x11, 0x12, 0x13:
+			return true
+		}
+	case 0x02, 0x03, 0x1d:
+		// j, jal, jalx
+		return true
+	case 0x04, 0x05, 0x06, 0x07:
+		// beq, bne, blez, bgtz
+		return true
+	case 0x14, 0x15, 0x16, 0x17:
+		// beql, bnel, blezl, bgtzl
+		return true
+	case 0x11, 0x12:
+		// bc1f, bc1t, bc2f, bc2t and their likely variants
+		return rs == 0x08
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package assembler
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteInstructionsMIPSDelaySlot(t *testing.T) {
+	instrs := []MachineInstruction{
+		{Command: "beqz", Arguments: []string{"a0", "10"}, Bytes: []byte{0x10, 0x80, 0x00, 0x03}},
+		{Command: "addiu", Arguments: []string{"v0", "v0", "1"}, Bytes: []byte{0x24, 0x42, 0x00, 0x01}},
+		{Command: "addu", Arguments: []string{"v0", "v0", "a0"}, Bytes: []byte{0x00, 0x44, 0x10, 0x21}},
+	}
+	var buf bytes.Buffer
+	err := WriteInstructions("mips64", &buf, instrs, true)
+	want := "WORD $0x10800003; // beqz a0 10 // branch delay slot WORD $0x24420001; // addiu v0 v0 1 WORD $0x00441021; // addu v0 v0 a0"
+	if got := adjustWhitespace(buf.String()); err != nil || got != want {
+		t.Errorf("Unable to write MIPS instructions, got: (err=%v,\noutput=%s\n) want: (err=nil,\noutput=%s\n).", err, got, want)
+	}
+}
+
+func TestWriteInstructionsMIPSPacked(t *testing.T) {
+	// objdump shows the bytes at the end of the section which don't fill an instruction on their own
+	instrs := []MachineInstruction{
+		{Command: "jr", Arguments: []string{"ra"}, Bytes: []byte{0x03, 0xe0, 0x00, 0x08}},
+		{Command: "nop", Bytes: []byte{0x00, 0x00, 0x00, 0x00}},
+		{Command: ".byte", Arguments: []string{"0x01"}, Bytes: []byte{0x01}},
+	}
+	var buf bytes.Buffer
+	err := WriteInstructions("mipsle", &buf, instrs, true)
+	want := "WORD $0x03e00008; // jr ra WORD $0x00000000; // nop WORD $0x00000001; // .byte 0x01 // padded with zeros"
+	if got := adjustWhitespace(buf.String()); err != nil || got != want {
+		t.Errorf("Unable to write packed MIPS instructions, got: (err=%v,\noutput=%s\n) want: (err=nil,\noutput=%s\n).", err, got, want)
+	}
+}
+
+func TestMIPSHasDelaySlot(t *testing.T) {
+	tables := []struct {
+		name  string
+		bytes []byte
+		want  bool
+	}{
+		{"beqz a0", []byte{0x10, 0x80, 0x00, 0x03}, true},
+		{"jr ra", []byte{0x03, 0xe0, 0x00, 0x08}, true},
+		{"jal", []byte{0x0c, 0x00, 0x00, 0x00}, true},
+		{"bgez a0", []byte{0x04, 0x81, 0x00, 0x02}, true},
+		{"addiu v0, v0, 1", []byte{0x24, 0x42, 0x00, 0x01}, false},
+		{"nop", []byte{0x00, 0x00, 0x00, 0x00}, false},
+	}
+	for _, arch := range []string{"mips", "mips64le"} {
+		backend, _ := Backend(arch)
+		slotter, ok := backend.(delaySlotter)
+		if !ok {
+			t.Errorf("Backend for %s doesn't know about delay slots.", arch)
+			continue
+		}
+		for _, table := range tables {
+			if got := slotter.hasDelaySlot(MachineInstruction{Bytes: table.bytes}); got != table.want {
+				t.Errorf("Unable to tell if %s has a delay slot on %s, got: %t want: %t.", table.name, arch, got, table.want)
+			}
+		}
+	}
+}
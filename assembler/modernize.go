@@ -0,0 +1,117 @@
+package assembler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// directiveLine matches a line of Go assembly made up of data directives and an optional comment, i.e.
+	// "    WORD $0x6e391e60; // eor v0.16b v19.16b v25.16b"
+	directiveLine = regexp.MustCompile(`^([ \t]*)((?:(?:QUAD|DWORD|LONG|WORD|BYTE)[ \t]+\$(?:0x[0-9a-fA-F]+|\d+)[ \t]*;?[ \t]*)+)(//.*?)?(\r?)$`)
+	// directive matches one of the data directives of a directiveLine
+	directive = regexp.MustCompile(`(QUAD|DWORD|LONG|WORD|BYTE)[ \t]+\$(0x[0-9a-fA-F]+|\d+)`)
+)
+
+// DirectiveLine is a line of Go assembly which writes out an instruction as data directives
+type DirectiveLine struct {
+	// The index of the line in the file, counting from 0
+	Index int
+	// The instruction made up of the bytes of the directives, as they would be shown by objdump
+	Instruction MachineInstruction
+	// The indentation before the directives
+	indent string
+	// The comment after the directives, if there is one, along with any carriage return ending the line
+	comment string
+}
+
+// ParseDirectiveLines returns the lines of Go assembly for arch which are made up only of data directives (and a
+// comment), i.e. ones written out by asm2go for instructions it didn't translate
+// On arm, the lines with Thumb code written out by WriteInstructions are skipped, as they aren't ARM instructions
+func ParseDirectiveLines(arch string, lines []string) ([]DirectiveLine, error) {
+	backend, ok := Backend(arch)
+	if !ok {
+		return nil, fmt.Errorf(unsupportedArch, arch)
+	}
+	sizes := make(map[string]int)
+	for _, d := range backend.Directives() {
+		sizes[d.Name] = d.Size
+	}
+
+	var directiveLines []DirectiveLine
+	thumb := false
+	for index, line := range lines {
+		switch strings.TrimSpace(line) {
+		case "// switch to Thumb state":
+			thumb = arch == "arm"
+		case "// switch back to ARM state":
+			thumb = false
+		}
+		match := directiveLine.FindStringSubmatch(line)
+		if match == nil || thumb {
+			continue
+		}
+
+		var memBytes []byte
+		for _, d := range directive.FindAllStringSubmatch(match[2], -1) {
+			size, ok := sizes[d[1]]
+			if !ok {
+				return nil, fmt.Errorf("line %d: %s isn't a directive for %s", index+1, d[1], arch)
+			}
+			value, err := strconv.ParseUint(d[2], 0, 8*size)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid %s: %v", index+1, d[1], err)
+			}
+			memBytes = append(memBytes, directiveBytes(backend.ByteOrder(), size, value)...)
+		}
+		if backend.ObjdumpShowsValues() && len(memBytes) != 4 {
+			// all of the instructions the decoders of these architectures translate are 4 bytes, so this is
+			// either more than 1 instruction or data
+			continue
+		}
+
+		// the bytes are kept in the order objdump shows them, see MemoryBytes
+		instrBytes := memBytes
+		if backend.ObjdumpShowsValues() && backend.ByteOrder() == binary.LittleEndian {
+			reverseEndianness(instrBytes)
+		}
+		directiveLines = append(directiveLines, DirectiveLine{
+			Index: index,
+			Instruction: MachineInstruction{
+				RawInstruction:  line,
+				Bytes:           instrBytes,
+				BytesEndianness: backend.ByteOrder(),
+			},
+			indent:  match[1],
+			comment: match[3] + match[4],
+		})
+	}
+	return directiveLines, nil
+}
+
+// directiveBytes returns the bytes a directive of the size puts into memory for the value
+func directiveBytes(order binary.ByteOrder, size int, value uint64) []byte {
+	b := make([]byte, 8)
+	switch size {
+	case 8:
+		order.PutUint64(b, value)
+	case 4:
+		order.PutUint32(b, uint32(value))
+	case 2:
+		order.PutUint16(b, uint16(value))
+	default:
+		b[0] = byte(value)
+	}
+	return b[:size]
+}
+
+// Rewrite returns the line with the directives replaced by the translation, keeping the indentation and comment
+func (d DirectiveLine) Rewrite(translation string) string {
+	if strings.HasPrefix(d.comment, "//") {
+		return d.indent + translation + " " + d.comment
+	}
+	return d.indent + translation + d.comment
+}
@@ -0,0 +1,68 @@
+package assembler
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseDirectiveLines(t *testing.T) {
+	tt := []struct {
+		arch  string
+		lines []string
+		// the index of each directive line, along with it's bytes
+		indexes []int
+		bytes   [][]byte
+	}{
+		{"arm64", []string{
+			"TEXT ·f(SB), NOSPLIT, $0-0",
+			"    WORD $0x6e391e60; // eor v0.16b, v19.16b, v25.16b",
+			"    MOVD R0, R1",
+			// more than one instruction
+			"    DWORD $0x6e391e606e391e60",
+			"    WORD $1",
+		}, []int{1, 4}, [][]byte{{0x6e, 0x39, 0x1e, 0x60}, {0x00, 0x00, 0x00, 0x01}}},
+		{"amd64", []string{
+			"    WORD $0x8948; BYTE $0xe5; // mov %rsp %rbp",
+			"    LONG $0x0424548b",
+		}, []int{0, 1}, [][]byte{{0x48, 0x89, 0xe5}, {0x8b, 0x54, 0x24, 0x04}}},
+		{"ppc64", []string{
+			"    WORD $0x7c0802a6; // mflr r0",
+		}, []int{0}, [][]byte{{0x7c, 0x08, 0x02, 0xa6}}},
+		{"arm", []string{
+			"    // switch to Thumb state",
+			"    WORD $0xf8d0b580; // push {r7 lr} // ldr.w r3 [r0 #4]",
+			"    // switch back to ARM state",
+			"    WORD $0xe1a0200e; // mov r2 lr",
+		}, []int{3}, [][]byte{{0xe1, 0xa0, 0x20, 0x0e}}},
+	}
+	for _, test := range tt {
+		directiveLines, err := ParseDirectiveLines(test.arch, test.lines)
+		ok := err == nil && len(directiveLines) == len(test.indexes)
+		for i := 0; ok && i < len(directiveLines); i++ {
+			ok = directiveLines[i].Index == test.indexes[i] && bytes.Equal(directiveLines[i].Instruction.Bytes, test.bytes[i])
+		}
+		if !ok {
+			t.Errorf("Unable to parse %s directive lines %q, got: (lines=%+v, err=%v) want: (indexes=%v, bytes=%x).", test.arch, test.lines, directiveLines, err, test.indexes, test.bytes)
+		}
+	}
+}
+
+func TestDirectiveLineRewrite(t *testing.T) {
+	lines := []string{
+		"    WORD $0x6e391e60;  // eor v0.16b, v19.16b, v25.16b",
+		"\tWORD $0x6e391e60\r",
+	}
+	want := []string{
+		"    VEOR V25.B16, V19.B16, V0.B16 // eor v0.16b, v19.16b, v25.16b",
+		"\tVEOR V25.B16, V19.B16, V0.B16\r",
+	}
+	directiveLines, err := ParseDirectiveLines("arm64", lines)
+	if err != nil || len(directiveLines) != len(lines) {
+		t.Fatalf("Unable to parse directive lines %q, got: (lines=%+v, err=%v).", lines, directiveLines, err)
+	}
+	for i, line := range directiveLines {
+		if got := line.Rewrite("VEOR V25.B16, V19.B16, V0.B16"); got != want[i] {
+			t.Errorf("Unable to rewrite directive line %q, got: %q want: %q.", lines[i], got, want[i])
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package assembler
+
+import (
+	"fmt"
+)
+
+// minPaddingAlign is the smallest alignment a run of NOP's is taken to be alignment padding for, as smaller ones are
+// more likely to be NOP's that are there for another reason, i.e. to fill a delay slot
+const minPaddingAlign = 16
+
+// paddingRun is a run of NOP's in the instructions of a function which pads the instruction following it to an
+// alignment
+type paddingRun struct {
+	// The indexes of the first instruction in the run, and of the first instruction after it
+	start, end int
+	// The alignment guessed for the run, see paddingAlignment
+	align int
+}
+
+// AlignPadding takes out the alignment padding the native assembler put in between the instructions of a function,
+// i.e. for a ".p2align 4" in front of a loop, as the padding is only correct at the address the function was at in
+// the object file
+// The instruction after the padding gets the alignment to be written out with PCALIGN instead, if the architecture
+// and the Go 1.x release with the minor version goVersion support it, and the padding at the end of the function,
+// which aligns whatever follows the function, is just dropped
+// The padding can only be taken out if none of the instructions depend on their address in a way that can't be
+// written with a label, see branchLabels, otherwise it is kept and a warning is returned for each run of padding
+// which then ends up at the wrong alignment
+func AlignPadding(arch string, instrs []MachineInstruction, goVersion int, tryTranslate bool) ([]MachineInstruction, []string) {
+	backend, ok := Backend(arch)
+	if !ok || len(instrs) == 0 {
+		return instrs, nil
+	}
+	targets, movable := paddingTargets(arch, instrs, tryTranslate)
+	runs := paddingRuns(backend, instrs, targets)
+	if len(runs) == 0 {
+		return instrs, nil
+	}
+
+	pcAlign, hasPCAlign := backend.PCAlign()
+
+	var warnings []string
+	drop := make(map[int]bool)
+	aligned := make([]MachineInstruction, len(instrs))
+	copy(aligned, instrs)
+	for _, run := range runs {
+		start := instrs[run.start].Address
+		trailing := run.end == len(instrs)
+		if !movable || branchesInto(targets, instrs, run) {
+			if !trailing {
+				warnings = append(warnings, fmt.Sprintf("alignment padding at 0x%x can't be taken out as the instructions depend on their address, so it won't align the instruction at 0x%x to %d bytes", start, instrs[run.end].Address, run.align))
+			}
+			continue
+		}
+
+		if !trailing {
+			align := run.align
+			if hasPCAlign && align < pcAlign.Min {
+				align = pcAlign.Min
+			}
+			switch {
+			case !hasPCAlign:
+				warnings = append(warnings, fmt.Sprintf("alignment padding at 0x%x is kept as the Go assembler doesn't have PCALIGN for %s, so it won't align the instruction at 0x%x to %d bytes", start, arch, instrs[run.end].Address, run.align))
+				continue
+			case goVersion < pcAlign.GoVersion:
+				warnings = append(warnings, fmt.Sprintf("alignment padding at 0x%x is kept as PCALIGN for %s needs at least Go 1.%d, so it won't align the instruction at 0x%x to %d bytes", start, arch, pcAlign.GoVersion, instrs[run.end].Address, run.align))
+				continue
+			case align > pcAlign.Max:
+				warnings = append(warnings, fmt.Sprintf("alignment padding at 0x%x is kept as PCALIGN for %s can't align to %d bytes", start, arch, align))
+				continue
+			}
+			aligned[run.end].Align = align
+		}
+		for i := run.start; i < run.end; i++ {
+			drop[i] = true
+		}
+	}
+
+	if len(drop) == 0 {
+		return aligned, warnings
+	}
+	kept := make([]MachineInstruction, 0, len(aligned)-len(drop))
+	for i, instr := range aligned {
+		if !drop[i] {
+			kept = append(kept, instr)
+		}
+	}
+	return kept, warnings
+}
+
+// paddingRuns returns the runs of NOP's in the instructions which look like alignment padding, i.e. which end at an
+// address that is aligned to the alignment guessed for the run
+// As a NOP written in the source can just as well end up in front of an aligned address, a run is only taken to be
+// padding if it has a multi-byte NOP in it, or if it ends in front of one of the targets of the branches (i.e. the
+// start of a loop)
+func paddingRuns(backend ArchBackend, instrs []MachineInstruction, targets map[uint64]string) []paddingRun {
+	var runs []paddingRun
+	for i := 0; i < len(instrs); {
+		if instrs[i].Data || !backend.IsPadding(instrs[i]) {
+			i++
+			continue
+		}
+		start := i
+		multiByte := false
+		for i < len(instrs) && !instrs[i].Data && backend.IsPadding(instrs[i]) {
+			multiByte = multiByte || isMultiByteNOP(backend, instrs[i])
+			i++
+		}
+
+		last := instrs[i-1]
+		end := last.Address + uint64(len(last.Bytes))
+		_, target := targets[end]
+		align := paddingAlignment(end - instrs[start].Address)
+		if end%uint64(align) == 0 && (multiByte || target) {
+			runs = append(runs, paddingRun{start: start, end: i, align: align})
+		}
+	}
+	return runs
+}
+
+// isMultiByteNOP returns whether the instruction is one of the x86 NOP's longer than a byte, i.e.
+// "nopw 0x0(%rax,%rax,1)", which the native assembler uses for padding but hardly anyone writes in the source
+func isMultiByteNOP(backend ArchBackend, instr MachineInstruction) bool {
+	_, x86 := backend.(x86Backend)
+	return x86 && len(instr.Bytes) > 1
+}
+
+// paddingAlignment returns the alignment guessed for a run of padding of length bytes, which is the smallest power of
+// two larger than the run, but at least minPaddingAlign
+// The address the run ends at can't tell the alignment, as it's aligned to more than the assembler was asked for
+// just as often, i.e. a ".p2align 4" which happens to end at 0x40
+func paddingAlignment(length uint64) int {
+	align := minPaddingAlign
+	for uint64(align) <= length {
+		align *= 2
+	}
+	return align
+}
+
+// paddingTargets returns the targets of the branches in the instructions, and whether the instructions can be moved
+// around, which is when every branch is written with a label, or there aren't any and nothing else depends on the
+// address of the instructions, see WriteInstructions
+func paddingTargets(arch string, instrs []MachineInstruction, tryTranslate bool) (map[uint64]string, bool) {
+	labels, ok := branchTargets(arch, instrs)
+	if !ok {
+		return nil, false
+	}
+	if len(labels) == 0 {
+		return nil, true
+	}
+	return labels, tryTranslate && labelsAllowed(arch, instrs)
+}
+
+// branchesInto returns whether a branch goes into the run of padding, or for padding at the end of the function, to
+// the end of the function, which moves once the padding is taken out
+func branchesInto(targets map[uint64]string, instrs []MachineInstruction, run paddingRun) bool {
+	start := instrs[run.start].Address
+	last := instrs[run.end-1]
+	end := last.Address + uint64(len(last.Bytes))
+	trailing := run.end == len(instrs)
+	for target := range targets {
+		if target >= start && (target < end || (trailing && target == end)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package assembler
+
+import (
+	"testing"
+)
+
+// paddedLoop returns the amd64 instructions of a function with a loop aligned with ".p2align 4", as well as the
+// padding at the end of the function
+func paddedLoop() []MachineInstruction {
+	return []MachineInstruction{
+		{Address: 0x0, Bytes: []byte{0x48, 0x8b, 0x74, 0x24, 0x08}}, // mov 0x8(%rsp),%rsi
+		{Address: 0x5, Bytes: []byte{0x48, 0x8b, 0x4c, 0x24, 0x10}}, // mov 0x10(%rsp),%rcx
+		{Address: 0xa, Bytes: []byte{0x48, 0x31, 0xc0}},             // xor %rax,%rax
+		{Address: 0xd, Bytes: []byte{0x0f, 0x1f, 0x00}},             // nopl (%rax)
+		{Address: 0x10, Bytes: []byte{0x48, 0x03, 0x06}},            // add (%rsi),%rax
+		{Address: 0x13, Bytes: []byte{0x48, 0x83, 0xc6, 0x08}},      // add $0x8,%rsi
+		{Address: 0x17, Bytes: []byte{0x48, 0xff, 0xc9}},            // dec %rcx
+		{Address: 0x1a, Bytes: []byte{0x75, 0xf4}},                  // jne 10 <sum+0x10>
+		{Address: 0x1c, Bytes: []byte{0xc3}},                        // ret
+		{Address: 0x1d, Bytes: []byte{0x0f, 0x1f, 0x00}},            // nopl (%rax)
+	}
+}
+
+func TestAlignPadding(t *testing.T) {
+	tt := []struct {
+		name         string
+		arch         string
+		instrs       []MachineInstruction
+		goVersion    int
+		tryTranslate bool
+		addresses    []uint64
+		align        map[uint64]int
+		warnings     int
+	}{
+		{
+			name:         "PCALIGN",
+			arch:         "amd64",
+			instrs:       paddedLoop(),
+			goVersion:    LatestGoVersion,
+			tryTranslate: true,
+			addresses:    []uint64{0x0, 0x5, 0xa, 0x10, 0x13, 0x17, 0x1a, 0x1c},
+			align:        map[uint64]int{0x10: 16},
+		},
+		{
+			// the padding ends at an address aligned to 64 bytes, but it's too short for more than 16
+			name: "p2align 4 at 0x40",
+			arch: "amd64",
+			instrs: []MachineInstruction{
+				{Address: 0x38, Bytes: []byte{0x48, 0x31, 0xc0}},             // xor %rax,%rax
+				{Address: 0x3b, Bytes: []byte{0x0f, 0x1f, 0x44, 0x00, 0x00}}, // nopl 0x0(%rax,%rax,1)
+				{Address: 0x40, Bytes: []byte{0x48, 0xff, 0xc0}},             // inc %rax
+				{Address: 0x43, Bytes: []byte{0xc3}},                         // ret
+			},
+			goVersion:    LatestGoVersion,
+			tryTranslate: true,
+			addresses:    []uint64{0x38, 0x40, 0x43},
+			align:        map[uint64]int{0x40: 16},
+		},
+		{
+			name:         "Go release without PCALIGN",
+			arch:         "amd64",
+			instrs:       paddedLoop(),
+			goVersion:    20,
+			tryTranslate: true,
+			addresses:    []uint64{0x0, 0x5, 0xa, 0xd, 0x10, 0x13, 0x17, 0x1a, 0x1c},
+			warnings:     1,
+		},
+		{
+			name:         "branches without labels",
+			arch:         "amd64",
+			instrs:       paddedLoop(),
+			goVersion:    LatestGoVersion,
+			tryTranslate: false,
+			addresses:    []uint64{0x0, 0x5, 0xa, 0xd, 0x10, 0x13, 0x17, 0x1a, 0x1c, 0x1d},
+			warnings:     1,
+		},
+		{
+			// the NOP isn't in front of an aligned address, so it isn't padding
+			name: "NOP",
+			arch: "arm64",
+			instrs: []MachineInstruction{
+				{Address: 0x0, Bytes: []byte{0xd5, 0x03, 0x20, 0x1f}}, // nop
+				{Address: 0x4, Bytes: []byte{0xd6, 0x5f, 0x03, 0xc0}}, // ret
+			},
+			goVersion:    LatestGoVersion,
+			tryTranslate: true,
+			addresses:    []uint64{0x0, 0x4},
+		},
+		{
+			// the NOP's end in front of an aligned address, but nothing branches there
+			name: "NOP's in front of an aligned address",
+			arch: "arm64",
+			instrs: []MachineInstruction{
+				{Address: 0x0, Bytes: []byte{0xd2, 0x80, 0x00, 0x80}},  // mov x0, #0x4
+				{Address: 0x4, Bytes: []byte{0xd5, 0x03, 0x20, 0x1f}},  // nop
+				{Address: 0x8, Bytes: []byte{0xd5, 0x03, 0x20, 0x1f}},  // nop
+				{Address: 0xc, Bytes: []byte{0xd5, 0x03, 0x20, 0x1f}},  // nop
+				{Address: 0x10, Bytes: []byte{0xd6, 0x5f, 0x03, 0xc0}}, // ret
+			},
+			goVersion:    LatestGoVersion,
+			tryTranslate: true,
+			addresses:    []uint64{0x0, 0x4, 0x8, 0xc, 0x10},
+		},
+		{
+			name: "NOP's in front of a loop",
+			arch: "arm64",
+			instrs: []MachineInstruction{
+				{Address: 0x0, Bytes: []byte{0xd2, 0x80, 0x00, 0x80}},  // mov x0, #0x4
+				{Address: 0x4, Bytes: []byte{0xd5, 0x03, 0x20, 0x1f}},  // nop
+				{Address: 0x8, Bytes: []byte{0xd5, 0x03, 0x20, 0x1f}},  // nop
+				{Address: 0xc, Bytes: []byte{0xd5, 0x03, 0x20, 0x1f}},  // nop
+				{Address: 0x10, Bytes: []byte{0xf1, 0x00, 0x04, 0x00}}, // subs x0, x0, #0x1
+				{Address: 0x14, Bytes: []byte{0x54, 0xff, 0xff, 0xe1}}, // b.ne 10
+				{Address: 0x18, Bytes: []byte{0xd6, 0x5f, 0x03, 0xc0}}, // ret
+			},
+			goVersion:    LatestGoVersion,
+			tryTranslate: true,
+			addresses:    []uint64{0x0, 0x10, 0x14, 0x18},
+			align:        map[uint64]int{0x10: 16},
+		},
+		{
+			name: "no PCALIGN",
+			arch: "arm",
+			instrs: []MachineInstruction{
+				{Address: 0x0, Bytes: []byte{0xe3, 0xa0, 0x00, 0x04}},  // mov r0, #4
+				{Address: 0x4, Bytes: []byte{0xe3, 0x20, 0xf0, 0x00}},  // nop
+				{Address: 0x8, Bytes: []byte{0xe3, 0x20, 0xf0, 0x00}},  // nop
+				{Address: 0xc, Bytes: []byte{0xe3, 0x20, 0xf0, 0x00}},  // nop
+				{Address: 0x10, Bytes: []byte{0xe2, 0x50, 0x00, 0x01}}, // subs r0, r0, #1
+				{Address: 0x14, Bytes: []byte{0x1a, 0xff, 0xff, 0xfd}}, // bne 10
+				{Address: 0x18, Bytes: []byte{0xe1, 0x2f, 0xff, 0x1e}}, // bx lr
+			},
+			goVersion:    LatestGoVersion,
+			tryTranslate: true,
+			addresses:    []uint64{0x0, 0x4, 0x8, 0xc, 0x10, 0x14, 0x18},
+			warnings:     1,
+		},
+	}
+	for _, test := range tt {
+		instrs, warnings := AlignPadding(test.arch, test.instrs, test.goVersion, test.tryTranslate)
+		var addresses []uint64
+		align := make(map[uint64]int)
+		for _, instr := range instrs {
+			addresses = append(addresses, instr.Address)
+			if instr.Align != 0 {
+				align[instr.Address] = instr.Align
+			}
+		}
+		if !equalAddresses(addresses, test.addresses) || len(align) != len(test.align) || len(warnings) != test.warnings {
+			t.Errorf("Unable to align padding for %s, got: (addresses=%x, align=%v, warnings=%q) want: (addresses=%x, align=%v, warnings=%d).", test.name, addresses, align, warnings, test.addresses, test.align, test.warnings)
+			continue
+		}
+		for address, want := range test.align {
+			if align[address] != want {
+				t.Errorf("Unable to align padding for %s, got: (align=%v) want: (align=%v).", test.name, align, test.align)
+			}
+		}
+	}
+}
+
+func equalAddresses(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestIsPadding(t *testing.T) {
+	tt := []struct {
+		arch    string
+		bytes   []byte
+		padding bool
+	}{
+		{"amd64", []byte{0x90}, true},
+		{"amd64", []byte{0x66, 0x0f, 0x1f, 0x44, 0x00, 0x00}, true},
+		{"amd64", []byte{0xc3}, false},
+		{"arm", []byte{0xe3, 0x20, 0xf0, 0x00}, true},
+		{"arm64", []byte{0xd5, 0x03, 0x20, 0x1f}, true},
+		{"ppc64le", []byte{0x00, 0x00, 0x00, 0x60}, true},
+		{"ppc64", []byte{0x60, 0x00, 0x00, 0x00}, true},
+		{"riscv64", []byte{0x00, 0x00, 0x00, 0x13}, true},
+		{"riscv64", []byte{0x00, 0x01}, true},
+		{"loong64", []byte{0x03, 0x40, 0x00, 0x00}, true},
+		{"mipsle", []byte{0x00, 0x00, 0x00, 0x00}, true},
+		{"s390x", []byte{0x07, 0x07}, true},
+		{"s390x", []byte{0x07, 0xfe}, false},
+	}
+	for _, test := range tt {
+		backend, _ := Backend(test.arch)
+		if got := backend.IsPadding(MachineInstruction{Bytes: test.bytes}); got != test.padding {
+			t.Errorf("Unable to tell if %s instruction %x is padding, got: %t want: %t.", test.arch, test.bytes, got, test.padding)
+		}
+	}
+}
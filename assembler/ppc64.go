@@ -0,0 +1,227 @@
+package assembler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/arch/ppc64/ppc64asm"
+)
+
+func init() {
+	RegisterBackend(ppc64Backend{littleEndian: false})
+	RegisterBackend(ppc64Backend{littleEndian: true})
+}
+
+// ppc64Backend is the ArchBackend for ppc64 and ppc64le
+type ppc64Backend struct {
+	littleEndian bool
+}
+
+func (b ppc64Backend) Arch() string {
+	if b.littleEndian {
+		return "ppc64le"
+	}
+	return "ppc64"
+}
+
+func (b ppc64Backend) MinGoVersion() int {
+	return 5
+}
+
+func (b ppc64Backend) GNUTargets() []string {
+	if b.littleEndian {
+		return []string{"powerpc64le", "ppc64le"}
+	}
+	return []string{"powerpc64", "ppc64"}
+}
+
+func (b ppc64Backend) ByteOrder() binary.ByteOrder {
+	if b.littleEndian {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// ObjdumpShowsValues returns false, as objdump shows ppc64 instructions as bytes in memory order for both byte orders
+func (b ppc64Backend) ObjdumpShowsValues() bool {
+	return false
+}
+
+// Directives returns only WORD = 4 bytes, as ppc64 instructions are always 4 bytes (prefixed instructions are 2 of
+// these) and the Go assembler has no smaller directive for ppc64 - anything which doesn't fill whole WORD's is packed
+// into WORD's by WriteInstructions
+func (b ppc64Backend) Directives() []Directive {
+	return []Directive{{"WORD", 4}}
+}
+
+// writesFunction returns whether any of the instructions don't fill whole WORD's, see writeWordPackedInstructions
+func (b ppc64Backend) writesFunction(instrs []MachineInstruction) bool {
+	return !wordsFill(instrs)
+}
+
+func (b ppc64Backend) writeFunction(w io.Writer, instrs []MachineInstruction, tryTranslate bool) error {
+	return writeWordPackedInstructions(b.Arch(), w, instrs, tryTranslate)
+}
+
+func (b ppc64Backend) Translate(instr MachineInstruction, w io.Writer) error {
+	return instr.writePPC64Supported(b.Arch(), w)
+}
+
+// IsPadding returns whether the instruction is the ppc64 nop (ori r0, r0, 0)
+func (b ppc64Backend) IsPadding(instr MachineInstruction) bool {
+	return len(instr.Bytes) == 4 && b.ByteOrder().Uint32(instr.Bytes) == 0x60000000
+}
+
+func (b ppc64Backend) PCAlign() (PCAlignment, bool) {
+	return PCAlignment{GoVersion: 13, Min: 8, Max: 64}, true
+}
+
+func (b ppc64Backend) TranslationNeedsVerification() bool {
+	return false
+}
+
+// writePPC64Supported translates a ppc64 or ppc64le instruction into plan9 syntax using ppc64asm
+func (instr MachineInstruction) writePPC64Supported(arch string, w io.Writer) error {
+	// the ppc64 decoder takes the bytes in the order they appear in memory, along with the byte order
+	goInstr, err := ppc64asm.Decode(instr.MemoryBytes(arch), instr.byteOrder(arch))
+	if err != nil || goInstr.Op == 0 || goInstr.Len != len(instr.Bytes) {
+		// Then we couldn't decode this instruction and we should
+		// use the WORD method
+		return fmt.Errorf(unrecognizedInstr, instr.Command)
+	}
+
+	// Branches are only decoded as absolute addresses, which the Go assembler doesn't accept,
+	// so use the WORD method for those too
+	for _, arg := range goInstr.Args {
+		switch arg.(type) {
+		case ppc64asm.PCRel, ppc64asm.Label:
+			return fmt.Errorf(unrecognizedInstr, instr.Command)
+		}
+	}
+
+	// ppc64asm drops an index register of 0 (which means no index register) from indexed loads and stores, i.e.
+	// "MOVBZ (R5),R3" for "lbzx r3,0,r5", which the Go assembler encodes as "lbz r3,0(r5)" instead, and it drops
+	// the exclusive access hint of lwarx and friends
+	op := goInstr.Op.String()
+	if strings.HasSuffix(op, "x") && goInstr.Args[1] == ppc64asm.R0 {
+		return fmt.Errorf(unrecognizedInstr, instr.Command)
+	}
+	if strings.HasSuffix(op, "arx") && goInstr.Args[3] != nil && goInstr.Args[3] != ppc64asm.Imm(0) {
+		return fmt.Errorf(unrecognizedInstr, instr.Command)
+	}
+
+	goSyntax := ppc64asm.GoSyntax(goInstr, instr.Address, nil)
+	if !ppc64GoSyntaxAccepted(goSyntax) {
+		return fmt.Errorf(unrecognizedInstr, instr.Command)
+	}
+
+	fmt.Fprintf(w, "%s \t", goSyntax)
+	return nil
+}
+
+// ppc64GoSyntaxAccepted returns whether the Go assembler accepts the output of ppc64asm.GoSyntax
+// Only the mnemonics in ppc64Ops are known to be the same for both, the rest are left to the WORD method.
+// The disassembler keeps immediates in the position they have in the native syntax, i.e. "ADD R3,$1,R3" for
+// "addi r3,r3,1", but the Go assembler expects a single immediate as the first operand, i.e. "ADD $1,R3,R3",
+// so anything else is left to the WORD method
+func ppc64GoSyntaxAccepted(goSyntax string) bool {
+	fields := strings.SplitN(goSyntax, " ", 2)
+	if !ppc64Ops[fields[0]] {
+		return false
+	}
+	if len(fields) == 1 {
+		return true
+	}
+	operands := strings.Split(fields[1], ",")
+	for i, operand := range operands {
+		if strings.HasPrefix(operand, "$") && i != 0 {
+			return false
+		}
+		if ppc64GRegister.MatchString(operand) || strings.Contains(operand, "(0)") {
+			// R30 is g for the Go assembler, and ppc64asm writes a base register of 0 (which means no base
+			// register) as "(0)", neither of which it accepts
+			return false
+		}
+		if m := ppc64Displacement.FindStringSubmatch(operand); m != nil {
+			// the Go assembler loads displacements within 8 bytes of the limits into R31 first
+			if d, err := strconv.Atoi(m[1]); err != nil || d < -32760 || d > 32759 {
+				return false
+			}
+		}
+	}
+	// the Go assembler keeps track of the changes to the stack pointer (R1), which writing it would upset
+	if operands[len(operands)-1] == "R1" || (strings.HasSuffix(fields[0], "U") && strings.Contains(fields[1], "(R1)")) {
+		return false
+	}
+	return true
+}
+
+var (
+	// ppc64GRegister matches R30, which holds g in Go
+	ppc64GRegister = regexp.MustCompile(`\bR30\b`)
+	// ppc64Displacement matches the displacement of a memory operand, i.e. "-8" in "-8(R1)"
+	ppc64Displacement = regexp.MustCompile(`^(-?[0-9]+)\(R[0-9]+\)`)
+)
+
+// ppc64Ops are the mnemonics ppc64asm.GoSyntax writes the way the Go assembler expects them, which isn't the case
+// for i.e. HWSYNC (SYNC for the Go assembler), NOP (which the Go assembler doesn't emit anything for), LMW, LQ or most
+// of the VSX scalar instructions
+var ppc64Ops = map[string]bool{
+	// fixed point, branches and storage
+	"ADD": true, "ADDC": true, "ADDCC": true, "ADDCCC": true, "ADDE": true, "ADDME": true, "ADDZE": true, "AND": true,
+	"ANDCC": true, "ANDN": true, "ANDNCC": true, "BL": true, "BR": true, "CFUGED": true, "CMP": true, "CMPB": true,
+	"CMPU": true, "CMPW": true, "CMPWU": true, "CNTLZD": true, "CNTLZDM": true, "CNTLZW": true, "CNTTZD": true,
+	"CNTTZW": true, "DARN": true, "DIVD": true, "DIVDECC": true, "DIVDEU": true, "DIVDU": true, "DIVDUCC": true,
+	"EIEIO": true, "EQV": true, "EXTSB": true, "EXTSH": true, "EXTSW": true, "EXTSWCC": true, "HASHCHKP": true,
+	"HASHSTP": true, "ISEL": true, "ISYNC": true, "LBAR": true, "LDAR": true, "LWAR": true, "LWSYNC": true,
+	"MADDHD": true, "MADDHDU": true, "MADDLD": true, "MODSD": true, "MODUD": true, "MOVB": true, "MOVBU": true,
+	"MOVBZ": true, "MOVBZU": true, "MOVD": true, "MOVDBR": true, "MOVDU": true, "MOVH": true, "MOVHBR": true,
+	"MOVHU": true, "MOVHZ": true, "MOVHZU": true, "MOVW": true, "MOVWBR": true, "MOVWU": true, "MOVWZ": true,
+	"MOVWZU": true, "MULHD": true, "MULHDCC": true, "MULHW": true, "MULHWU": true, "MULHWUCC": true, "MULLD": true,
+	"MULLDCC": true, "MULLDV": true, "MULLDVCC": true, "MULLW": true, "MULLWCC": true, "NAND": true, "NEG": true,
+	"NEGCC": true, "NOR": true, "NORCC": true, "OR": true, "ORCC": true, "ORN": true, "POPCNTD": true,
+	"POPCNTW": true, "RET": true, "SETB": true, "SLD": true, "SLW": true, "SLWCC": true, "SRAD": true, "SRAW": true,
+	"SRD": true, "SRW": true, "STBCCC": true, "STDCCC": true, "STWCCC": true, "SUB": true, "SUBC": true,
+	"SUBCC": true, "SUBCCC": true, "SUBZE": true,
+	// floating point
+	"FABS": true, "FADD": true, "FADDS": true, "FCFID": true, "FCFIDS": true, "FCFIDU": true, "FCMPO": true,
+	"FCMPU": true, "FCTID": true, "FCTIDZ": true, "FCTIW": true, "FCTIWZ": true, "FDIV": true, "FDIVS": true,
+	"FDIVSCC": true, "FMADD": true, "FMADDCC": true, "FMADDS": true, "FMADDSCC": true, "FMOVD": true, "FMOVDU": true,
+	"FMOVS": true, "FMOVSU": true, "FMSUB": true, "FMSUBCC": true, "FMSUBS": true, "FMSUBSCC": true, "FMUL": true,
+	"FMULCC": true, "FMULS": true, "FMULSCC": true, "FNABS": true, "FNEG": true, "FNMADD": true, "FNMADDCC": true,
+	"FNMADDS": true, "FNMADDSCC": true, "FNMSUB": true, "FNMSUBCC": true, "FNMSUBS": true, "FNMSUBSCC": true,
+	"FRIM": true, "FRIN": true, "FRIP": true, "FRIZ": true, "FRSP": true, "FRSQRTE": true, "FSEL": true,
+	"FSELCC": true, "FSQRT": true, "FSQRTS": true, "FSUB": true, "FSUBCC": true, "FSUBS": true,
+	// vector and VSX
+	"LVEBX": true, "LVSL": true, "LVSR": true, "LVX": true, "LVXL": true, "LXSDX": true, "LXSIWAX": true, "LXV": true,
+	"LXVD2X": true, "LXVH8X": true, "LXVLL": true, "LXVP": true, "LXVW4X": true, "MFVSRD": true, "MFVSRLD": true,
+	"MFVSRWZ": true, "MTVSRBMI": true, "MTVSRD": true, "MTVSRDD": true, "MTVSRWA": true, "MTVSRWS": true,
+	"MTVSRWZ": true, "STVEBX": true, "STVEHX": true, "STVX": true, "STXSDX": true, "STXSIWX": true, "STXV": true,
+	"STXVB16X": true, "STXVD2X": true, "STXVH8X": true, "STXVW4X": true, "VADDCUQ": true, "VADDECUQ": true,
+	"VADDEUQM": true, "VADDSBS": true, "VADDUBM": true, "VADDUDM": true, "VADDUHS": true, "VADDUQM": true,
+	"VADDUWM": true, "VAND": true, "VANDC": true, "VBPERMD": true, "VCIPHER": true, "VCIPHERLAST": true,
+	"VCLRLB": true, "VCLZDM": true, "VCMPEQUB": true, "VCMPEQUBCC": true, "VCMPEQUH": true, "VCMPEQUQ": true,
+	"VCMPEQUW": true, "VCMPEQUWCC": true, "VCMPGTSD": true, "VCMPGTSW": true, "VCMPGTUDCC": true, "VCMPGTUW": true,
+	"VCMPNEZB": true, "VCMPNEZBCC": true, "VCTZDM": true, "VCTZLSBB": true, "VDIVESD": true, "VDIVEUQ": true,
+	"VDIVSD": true, "VDIVUD": true, "VDIVUW": true, "VEQV": true, "VEXPANDHM": true, "VEXTDDVLX": true,
+	"VEXTDDVRX": true, "VEXTDUBVLX": true, "VEXTDUBVRX": true, "VEXTDUHVLX": true, "VEXTDUHVRX": true,
+	"VEXTDUWVLX": true, "VEXTDUWVRX": true, "VINSBLX": true, "VINSBVRX": true, "VINSDRX": true, "VINSHVLX": true,
+	"VINSWRX": true, "VINSWVRX": true, "VMODSD": true, "VMRGEW": true, "VMRGOW": true, "VMSUMCUD": true,
+	"VMSUMUDM": true, "VMULESB": true, "VMULESW": true, "VMULEUH": true, "VMULEUW": true, "VMULHSW": true,
+	"VMULHUW": true, "VMULOSH": true, "VMULOUW": true, "VMULUWM": true, "VNAND": true, "VNCIPHER": true,
+	"VNCIPHERLAST": true, "VNOR": true, "VOR": true, "VPDEPD": true, "VPERM": true, "VPERMR": true, "VPERMXOR": true,
+	"VPMSUMB": true, "VPMSUMD": true, "VPMSUMH": true, "VRLD": true, "VRLW": true, "VSBOX": true, "VSEL": true,
+	"VSL": true, "VSLH": true, "VSLW": true, "VSPLTISB": true, "VSPLTISW": true, "VSR": true, "VSRAB": true,
+	"VSRAH": true, "VSRAQ": true, "VSRAW": true, "VSRO": true, "VSRW": true, "VSUBECUQ": true, "VSUBEUQM": true,
+	"VSUBUBM": true, "VSUBUWM": true, "VXOR": true, "XOR": true, "XSCVDPSP": true, "XSCVDPSXDS": true,
+	"XSCVSPDP": true, "XSCVSXDDP": true, "XSMAXCQP": true, "XSMAXJDP": true, "XSMINJDP": true, "XVBF16GER2NP": true,
+	"XVBF16GER2PN": true, "XVBF16GER2PP": true, "XVF16GER2PN": true, "XVF16GER2PP": true, "XVF32GERNP": true,
+	"XVF32GERPP": true, "XVF64GER": true, "XVF64GERNN": true, "XVF64GERPN": true, "XVI16GER2": true,
+	"XVI16GER2S": true, "XVI4GER8": true, "XVI4GER8PP": true, "XVI8GER4SPP": true, "XXBRD": true, "XXBRW": true,
+	"XXLAND": true, "XXLANDC": true, "XXLEQV": true, "XXLNAND": true, "XXLOR": true, "XXLORC": true, "XXLXOR": true,
+	"XXMRGHW": true, "XXMRGLW": true, "XXPERM": true, "XXSEL": true,
+}
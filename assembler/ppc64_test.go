@@ -0,0 +1,53 @@
+package assembler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPPC64Translation(t *testing.T) {
+	tt := []struct {
+		bytes       []byte
+		translation string
+	}{
+		{[]byte{0x7c, 0x64, 0x29, 0xd2}, "MULLD R5,R4,R3"},
+		{[]byte{0x7c, 0x64, 0x28, 0xee}, "MOVBZU (R5)(R4),R3"},
+		// R30 is g for the Go assembler
+		{[]byte{0xe8, 0x7e, 0x00, 0x08}, ""},
+		// lbzx r3,0,r5 would be written without it's index register, which the Go assembler encodes as lbz
+		{[]byte{0x7c, 0x60, 0x28, 0xae}, ""},
+		// lwarx r3,r4,r5,1 would be written without it's hint
+		{[]byte{0x7c, 0x64, 0x28, 0x29}, ""},
+		// lmw and xsadddp aren't known to the Go assembler under the same names
+		{[]byte{0xbb, 0xa1, 0xff, 0xf4}, ""},
+		{[]byte{0xf0, 0x01, 0x11, 0x00}, ""},
+		// the Go assembler tracks the changes to R1 itself
+		{[]byte{0xf8, 0x21, 0xff, 0xe1}, ""},
+		// the Go assembler splits up displacements this close to the limit, using R31
+		{[]byte{0xe8, 0x64, 0x7f, 0xfc}, ""},
+	}
+	for _, test := range tt {
+		var buf bytes.Buffer
+		err := MachineInstruction{Bytes: test.bytes}.writePPC64Supported("ppc64", &buf)
+		translation := strings.TrimSpace(buf.String())
+		if translation != test.translation || (err == nil) != (test.translation != "") {
+			t.Errorf("Unable to translate ppc64 instruction %x, got: (err=%v, translation=%q) want: %q.", test.bytes, err, translation, test.translation)
+		}
+	}
+}
+
+func TestWriteInstructionsPPC64Packed(t *testing.T) {
+	// objdump shows the bytes at the end of the section which don't fill an instruction on their own
+	instrs := []MachineInstruction{
+		{Command: "blr", Bytes: []byte{0x4e, 0x80, 0x00, 0x20}},
+		{Command: ".byte", Arguments: []string{"0x01"}, Bytes: []byte{0x01}},
+		{Command: ".short", Arguments: []string{"0x0203"}, Bytes: []byte{0x02, 0x03}},
+	}
+	var buf bytes.Buffer
+	err := WriteInstructions("ppc64", &buf, instrs, false)
+	want := "WORD $0x4e800020; // blr WORD $0x01020300; // .byte 0x01 // .short 0x0203 // padded with zeros"
+	if got := adjustWhitespace(buf.String()); err != nil || got != want {
+		t.Errorf("Unable to write packed ppc64 instructions, got: (err=%v,\noutput=%s\n) want: (err=nil,\noutput=%s\n).", err, got, want)
+	}
+}
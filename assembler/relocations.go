@@ -0,0 +1,89 @@
+package assembler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// relocationKinds describe what relocations are used for, going by the parts of the names of the relocation types
+// which are the same across architectures, in the order they are checked in
+var relocationKinds = []struct {
+	parts       []string
+	description string
+}{
+	{[]string{"TLS", "TPOFF", "TPREL", "DTPOFF", "DTPREL", "DTPMOD"}, "a thread local storage access"},
+	{[]string{"GOT"}, "an access through the global offset table"},
+	{[]string{"PLT"}, "a call through the procedure linkage table"},
+	{[]string{"CALL", "JUMP", "JMP", "JAL", "BRANCH", "_B26", "PC24", "REL24", "REL14"}, "a call or branch"},
+	{[]string{"PC", "PREL"}, "a PC-relative reference"},
+}
+
+// relocationKind returns a description of what the type of relocation is used for, i.e. "a call through the
+// procedure linkage table" for R_X86_64_PLT32
+func relocationKind(relocType string) string {
+	for _, kind := range relocationKinds {
+		for _, part := range kind.parts {
+			if strings.Contains(relocType, part) {
+				return kind.description
+			}
+		}
+	}
+	return "an absolute reference"
+}
+
+// describeSymbol returns a description of the symbol a relocation refers to for diagnostics, i.e. "the undefined
+// symbol memcpy"
+func describeSymbol(name string, symbols []Symbol) string {
+	for _, sym := range symbols {
+		if sym.Name != name {
+			continue
+		}
+		switch {
+		case sym.Section == "*UND*":
+			return "the undefined symbol " + name
+		case sym.Debugging && sym.Section == name:
+			return "the section " + name
+		case sym.Function:
+			return "the function " + name
+		case sym.IsData():
+			return "the data symbol " + name
+		}
+		return fmt.Sprintf("the symbol %s in %s", name, sym.Section)
+	}
+	return "the symbol " + name
+}
+
+// isResolved returns whether the relocations of the instruction are taken care of, as it's either rewritten to refer
+// to Go symbols, part of a jump through a table, or is a call to one of the PC thunks, which are rewritten when
+// written out
+func (instr MachineInstruction) isResolved(arch string) bool {
+	return instr.SymbolReference != "" || instr.InReference || instr.JumpTable != nil || instr.isPCThunkCall(arch)
+}
+
+// CheckRelocations returns an error naming the instruction and the symbol for the first relocation in the
+// instructions of a function which isn't taken care of by rewriting the instruction (see ResolveDataReferences,
+// ResolveCalls and ResolveJumpTables), as the bytes of the instruction only hold a placeholder for the linker, so it would assemble fine
+// but then point nowhere
+func CheckRelocations(arch string, instrs []MachineInstruction, symbols []Symbol) error {
+	for _, instr := range instrs {
+		if instr.isResolved(arch) {
+			continue
+		}
+		// position independent code has an error of it's own, as it comes with a way out
+		if err := instr.checkPIC(arch); err != nil {
+			return err
+		}
+		for _, reloc := range instr.Relocations {
+			name, _ := reloc.target()
+			description := describeSymbol(name, symbols)
+			hint := ""
+			if strings.HasPrefix(description, "the undefined symbol") {
+				hint = fmt.Sprintf(", unless it's mapped onto a Go function with a \"%s%s=pkg·function\" directive in the Go file", ExternDirective, name)
+			}
+			return fmt.Errorf("instruction \"%s\" at %#x refers to %s through %s (%s), which isn't supported in Go assembly%s",
+				strings.TrimSpace(instr.InstructionString), instr.Address, description, reloc.Type,
+				relocationKind(reloc.Type), hint)
+		}
+	}
+	return nil
+}
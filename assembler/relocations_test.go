@@ -0,0 +1,87 @@
+package assembler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRelocationTarget(t *testing.T) {
+	tables := []struct {
+		symbol string
+		name   string
+		addend int64
+	}{
+		{"memcpy", "memcpy", 0},
+		{".rodata-0x4", ".rodata", -4},
+		{"K+0x10", "K", 16},
+		{"__x86.get_pc_thunk.bx", "__x86.get_pc_thunk.bx", 0},
+	}
+
+	for _, table := range tables {
+		name, addend := Relocation{Symbol: table.symbol}.target()
+		if name != table.name || addend != table.addend {
+			t.Errorf("Unable to parse relocation target %s, got: (name=%s, addend=%d) want: (name=%s, addend=%d).", table.symbol, name, addend, table.name, table.addend)
+		}
+	}
+}
+
+func TestCheckRelocations(t *testing.T) {
+	symbols := []Symbol{
+		{Name: "memcpy", Section: "*UND*"},
+		{Name: "v", Section: ".tbss", Object: true},
+	}
+	tables := []struct {
+		name   string
+		arch   string
+		instrs []MachineInstruction
+		err    string
+	}{
+		{
+			name: "external call",
+			arch: "amd64",
+			instrs: []MachineInstruction{
+				{Address: 0x4, InstructionString: "call   9 <f+0x9>", Bytes: []byte{0xe8, 0, 0, 0, 0},
+					Relocations: []Relocation{{0x5, "R_X86_64_PLT32", "memcpy-0x4"}}},
+			},
+			err: `instruction "call   9 <f+0x9>" at 0x4 refers to the undefined symbol memcpy through R_X86_64_PLT32 (a call through the procedure linkage table), which isn't supported in Go assembly, unless it's mapped onto a Go function with a "//asm2go:extern memcpy=pkg·function" directive`,
+		},
+		{
+			name: "thread local storage",
+			arch: "arm64",
+			instrs: []MachineInstruction{
+				{Address: 0x0, InstructionString: "add x0, x0, #0x0", Bytes: []byte{0x91, 0, 0, 0},
+					Relocations: []Relocation{{0x0, "R_AARCH64_TLSLE_ADD_TPREL_LO12", "v"}}},
+			},
+			err: "refers to the symbol v in .tbss through R_AARCH64_TLSLE_ADD_TPREL_LO12 (a thread local storage access)",
+		},
+		{
+			name: "386 global offset table",
+			arch: "386",
+			instrs: []MachineInstruction{
+				{Address: 0x5, InstructionString: "add    $0x1,%eax", Bytes: []byte{0x05, 0x01, 0, 0, 0},
+					Relocations: []Relocation{{0x6, "R_386_GOTPC", "_GLOBAL_OFFSET_TABLE_"}}},
+			},
+			err: "assemble without -fPIC",
+		},
+		{
+			name: "resolved",
+			arch: "386",
+			instrs: []MachineInstruction{
+				{Address: 0x0, Command: "call", Bytes: []byte{0xe8, 0, 0, 0, 0},
+					Relocations: []Relocation{{0x1, "R_386_PC32", "__x86.get_pc_thunk.bx"}}},
+				{Address: 0x5, Bytes: []byte{0x8d, 0x05, 0, 0, 0, 0}, SymbolReference: "LEAL K<>(SB), AX",
+					Relocations: []Relocation{{0x7, "R_386_32", ".rodata"}}},
+			},
+		},
+	}
+
+	for _, table := range tables {
+		err := CheckRelocations(table.arch, table.instrs, symbols)
+		switch {
+		case table.err == "" && err != nil:
+			t.Errorf("Unable to check relocations in %s : %v", table.name, err)
+		case table.err != "" && (err == nil || !strings.Contains(err.Error(), table.err)):
+			t.Errorf("Expected an error for relocations in %s, got: (err=%v) want: (err=%s).", table.name, err, table.err)
+		}
+	}
+}
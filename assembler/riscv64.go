@@ -0,0 +1,237 @@
+package assembler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"regexp"
+
+	"golang.org/x/arch/riscv64/riscv64asm"
+)
+
+// riscv64CNop is the encoding of c.nop, which is used to pad a compressed instruction at the end of a function
+// out to a full WORD
+const riscv64CNop = 0x0001
+
+func init() {
+	RegisterBackend(riscv64Backend{})
+}
+
+// riscv64Backend is the ArchBackend for riscv64
+type riscv64Backend struct{}
+
+func (riscv64Backend) Arch() string {
+	return "riscv64"
+}
+
+func (riscv64Backend) MinGoVersion() int {
+	return 14
+}
+
+func (riscv64Backend) GNUTargets() []string {
+	return []string{"riscv64"}
+}
+
+func (riscv64Backend) ByteOrder() binary.ByteOrder {
+	return binary.LittleEndian
+}
+
+func (riscv64Backend) ObjdumpShowsValues() bool {
+	return true
+}
+
+// Directives returns only WORD = 4 bytes, as that is the only directive for riscv64 - 2 byte compressed instructions
+// are packed together into WORD's by WriteInstructions
+func (riscv64Backend) Directives() []Directive {
+	return []Directive{{"WORD", 4}}
+}
+
+func (riscv64Backend) Translate(instr MachineInstruction, w io.Writer) error {
+	return instr.writeRISCV64Supported(w)
+}
+
+// IsPadding returns whether the instruction is nop (addi zero, zero, 0) or c.nop
+func (riscv64Backend) IsPadding(instr MachineInstruction) bool {
+	switch len(instr.Bytes) {
+	case 2:
+		return binary.BigEndian.Uint16(instr.Bytes) == riscv64CNop
+	case 4:
+		return binary.BigEndian.Uint32(instr.Bytes) == 0x00000013
+	}
+	return false
+}
+
+func (riscv64Backend) PCAlign() (PCAlignment, bool) {
+	return PCAlignment{GoVersion: 23, Min: 4, Max: 2048}, true
+}
+
+func (riscv64Backend) TranslationNeedsVerification() bool {
+	return false
+}
+
+// writesFunction returns true, as the compressed instructions have to be packed into WORD's with the instructions
+// around them
+func (riscv64Backend) writesFunction(instrs []MachineInstruction) bool {
+	return true
+}
+
+func (riscv64Backend) writeFunction(w io.Writer, instrs []MachineInstruction, tryTranslate bool) error {
+	return writeRISCV64Instructions(w, instrs, tryTranslate)
+}
+
+// goVersion returns 23 for the bit manipulation (Zba, Zbb and Zbs) instructions, which are the only ones translated
+// that the Go assembler didn't accept since the riscv64 port
+func (b riscv64Backend) goVersion(instr MachineInstruction, goSyntax string) int {
+	goInstr, err := riscv64asm.Decode(instr.littleEndianBytes("riscv64"))
+	if err != nil {
+		return b.MinGoVersion()
+	}
+	switch goInstr.Op {
+	case riscv64asm.ADD_UW, riscv64asm.SH1ADD, riscv64asm.SH1ADD_UW, riscv64asm.SH2ADD, riscv64asm.SH2ADD_UW,
+		riscv64asm.SH3ADD, riscv64asm.SH3ADD_UW, riscv64asm.SLLI_UW,
+		riscv64asm.CLZ, riscv64asm.CLZW, riscv64asm.CTZ, riscv64asm.CTZW, riscv64asm.CPOP, riscv64asm.CPOPW,
+		riscv64asm.SEXT_B, riscv64asm.SEXT_H, riscv64asm.ZEXT_H, riscv64asm.ORC_B, riscv64asm.REV8,
+		riscv64asm.BCLR, riscv64asm.BCLRI, riscv64asm.BEXT, riscv64asm.BEXTI,
+		riscv64asm.BINV, riscv64asm.BINVI, riscv64asm.BSET, riscv64asm.BSETI:
+		return 23
+	}
+	return b.MinGoVersion()
+}
+
+// writeRISCV64Supported translates a riscv64 instruction into plan9 syntax using riscv64asm
+// The translation is only kept when the Go assembler will encode it exactly the same way as the original
+// instruction, see riscv64EncodingIsStable
+func (instr MachineInstruction) writeRISCV64Supported(w io.Writer) error {
+	// the riscv64 decoder expects the bytes in little endian, whatever the byte order of the object
+	instrBytes := instr.littleEndianBytes("riscv64")
+	goInstr, err := riscv64asm.Decode(instrBytes)
+	if err != nil || goInstr.Op == 0 || goInstr.Len != len(instr.Bytes) || !riscv64EncodingIsStable(goInstr) {
+		// Then we couldn't decode this instruction, or the Go assembler may encode it differently,
+		// so we should use the WORD method
+		return fmt.Errorf(unrecognizedInstr, instr.Command)
+	}
+
+	fmt.Fprintf(w, "%s \t", riscv64asm.GoSyntax(goInstr, instr.Address, nil, nil))
+	return nil
+}
+
+// riscv64EncodingIsStable reports whether the Go assembler will encode the output of riscv64asm.GoSyntax for
+// inst with exactly the same 4 bytes
+func riscv64EncodingIsStable(inst riscv64asm.Inst) bool {
+	switch inst.Op {
+	case riscv64asm.LW, riscv64asm.LD, riscv64asm.FLD,
+		riscv64asm.SW, riscv64asm.SD, riscv64asm.FSD,
+		riscv64asm.ADDI, riscv64asm.ADDIW, riscv64asm.LUI,
+		riscv64asm.SLLI, riscv64asm.SRLI, riscv64asm.SRAI, riscv64asm.ANDI,
+		riscv64asm.ADD, riscv64asm.ADDW, riscv64asm.SUB, riscv64asm.SUBW,
+		riscv64asm.AND, riscv64asm.OR, riscv64asm.XOR,
+		riscv64asm.EBREAK:
+		// The Go assembler turns these into compressed instructions wherever the operands allow it
+		return false
+	case riscv64asm.AUIPC, riscv64asm.JAL, riscv64asm.JALR,
+		riscv64asm.BEQ, riscv64asm.BNE, riscv64asm.BLT, riscv64asm.BGE, riscv64asm.BLTU, riscv64asm.BGEU:
+		// PC-relative instructions are laid out again by the Go assembler
+		return false
+	case riscv64asm.ANDN, riscv64asm.ORN, riscv64asm.XNOR,
+		riscv64asm.MIN, riscv64asm.MINU, riscv64asm.MAX, riscv64asm.MAXU,
+		riscv64asm.ROL, riscv64asm.ROLW, riscv64asm.ROR, riscv64asm.RORW, riscv64asm.RORI, riscv64asm.RORIW:
+		// Unless GORISCV64 is at least rva22u64, these are replaced with a sequence of base instructions
+		return false
+	case riscv64asm.FENCE_I:
+		// the Go assembler doesn't have this one
+		return false
+	case riscv64asm.ORI:
+		// riscv64asm writes ori with zero as the destination as the Zicbop prefetch hints, whatever it's immediate
+		if inst.Args[0] == riscv64asm.X0 {
+			return false
+		}
+	}
+
+	for _, arg := range inst.Args {
+		switch arg := arg.(type) {
+		case riscv64asm.CSR:
+			// riscv64asm writes most CSR's as i.e. "CSR(2121)", and the Go assembler only knows a few of them
+			return false
+		case riscv64asm.Reg, riscv64asm.RegOffset, riscv64asm.RegPtr:
+			// X4 is TP and X27 is g for the Go assembler, and it doesn't accept the names X4 and X27
+			if riscv64Register.MatchString(arg.String()) {
+				return false
+			}
+		}
+	}
+
+	switch opcode := inst.Enc & 0x7f; opcode {
+	case 0x53:
+		// Floating point instructions with a rounding mode are always encoded with the Go assembler's default
+		// rounding mode, so only the ones without it can be translated, i.e. sign injection, min/max, compares,
+		// classify and moves
+		switch funct5 := inst.Enc >> 27; funct5 {
+		case 0x04, 0x05, 0x14, 0x1c, 0x1e:
+			return true
+		}
+		return false
+	case 0x43, 0x47, 0x4b, 0x4f:
+		// the fused multiply-add instructions also have a rounding mode
+		return false
+	case 0x2f:
+		// the Go assembler always sets it's own acquire/release bits for atomic instructions
+		return false
+	case 0x57:
+		// vector instructions
+		return false
+	case 0x07, 0x27:
+		// only the scalar floating point loads and stores, the rest are vector loads and stores
+		funct3 := (inst.Enc >> 12) & 0x7
+		return funct3 == 0x2 || funct3 == 0x3
+	}
+
+	return true
+}
+
+// riscv64Register matches X4 or X27 in an operand of riscv64asm, i.e. "x27" or "-8(x4)"
+var riscv64Register = regexp.MustCompile(`\bx(4|27)\b`)
+
+// riscv64Parcels returns the 16-bit parcels that make up the instruction, in the order they appear in memory
+// objdump shows RISC-V instructions as a single value for both compressed and normal instructions, so the low
+// parcel comes last in the bytes
+func (instr MachineInstruction) riscv64Parcels() ([]uint16, error) {
+	if len(instr.Bytes)%2 != 0 {
+		return nil, fmt.Errorf("instruction \"%s\" at %#x isn't made of 16-bit parcels", instr.Command, instr.Address)
+	}
+	parcels := make([]uint16, 0, len(instr.Bytes)/2)
+	for i := len(instr.Bytes) - 2; i >= 0; i -= 2 {
+		parcels = append(parcels, binary.BigEndian.Uint16(instr.Bytes[i:]))
+	}
+	return parcels, nil
+}
+
+// writeRISCV64Instructions writes out the instructions of a riscv64 function
+// The Go assembler only has a 4 byte WORD directive for riscv64, so 2 byte compressed instructions are packed
+// together with the instruction following them into a WORD, and if the function ends on a compressed instruction
+// it is padded with a c.nop
+func writeRISCV64Instructions(w io.Writer, instrs []MachineInstruction, tryTranslate bool) error {
+	h := halfwordWriter{w: w}
+	for _, instr := range instrs {
+		if instr.Align != 0 {
+			// the alignment padding in front of the instruction was taken out, see AlignPadding
+			h.pad(riscv64CNop, "c.nop")
+			fmt.Fprintf(w, "    PCALIGN $%d\n", instr.Align)
+		}
+		if h.aligned() && len(instr.Bytes) == 4 {
+			// this instruction fills a WORD on it's own
+			if err := instr.WriteOutput("riscv64", w, tryTranslate); err != nil {
+				return err
+			}
+			continue
+		}
+
+		parcels, err := instr.riscv64Parcels()
+		if err != nil {
+			return err
+		}
+		h.write(instr, parcels)
+	}
+	h.pad(riscv64CNop, "c.nop")
+
+	return nil
+}
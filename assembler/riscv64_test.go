@@ -0,0 +1,70 @@
+package assembler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteInstructionsRISCV64Compressed(t *testing.T) {
+	instrs := []MachineInstruction{
+		{Command: "li", Arguments: []string{"a5", "1"}, Bytes: []byte{0x47, 0x85}},
+		{Command: "mul", Arguments: []string{"a0", "a0", "a5"}, Bytes: []byte{0x02, 0xf5, 0x05, 0x33}},
+		{Command: "mv", Arguments: []string{"a1", "a0"}, Bytes: []byte{0x85, 0xaa}},
+		{Command: "mul", Arguments: []string{"a0", "a0", "a5"}, Bytes: []byte{0x02, 0xf5, 0x05, 0x33}},
+		{Command: "ret", Bytes: []byte{0x80, 0x82}},
+	}
+	var buf bytes.Buffer
+	err := WriteInstructions("riscv64", &buf, instrs, true)
+	want := "WORD $0x05334785; // li a5 1 // mul a0 a0 a5 WORD $0x85aa02f5; // mv a1 a0 MUL X15, X10, X10 // mul a0 a0 a5 WORD $0x00018082; // ret // padded with c.nop"
+	if got := adjustWhitespace(buf.String()); err != nil || got != want {
+		t.Errorf("Unable to write riscv64 instructions, got: (err=%v,\noutput=%s\n) want: (err=nil,\noutput=%s\n).", err, got, want)
+	}
+
+	// a compressed instruction on it's own can't be written out
+	buf.Reset()
+	err = instrs[0].WriteOutput("riscv64", &buf, true)
+	if err == nil || buf.Len() != 0 {
+		t.Errorf("Expected an error for compressed instruction (instr=%v), got: (err=%v, output=%s).", instrs[0], err, buf.String())
+	}
+}
+
+func TestWriteInstructionsRISCV64Align(t *testing.T) {
+	// the alignment padding in front of the loop was taken out, so the compressed instruction before it is padded
+	instrs := []MachineInstruction{
+		{Command: "li", Arguments: []string{"a5", "1"}, Bytes: []byte{0x47, 0x85}},
+		{Command: "mul", Arguments: []string{"a0", "a0", "a5"}, Bytes: []byte{0x02, 0xf5, 0x05, 0x33}, Align: 16},
+	}
+	var buf bytes.Buffer
+	err := WriteInstructions("riscv64", &buf, instrs, true)
+	want := "WORD $0x00014785; // li a5 1 // padded with c.nop PCALIGN $16 MUL X15, X10, X10 // mul a0 a0 a5"
+	if got := adjustWhitespace(buf.String()); err != nil || got != want {
+		t.Errorf("Unable to write aligned riscv64 instructions, got: (err=%v,\noutput=%s\n) want: (err=nil,\noutput=%s\n).", err, got, want)
+	}
+}
+
+func TestRISCV64Translation(t *testing.T) {
+	tt := []struct {
+		name        string
+		bytes       []byte
+		translation string
+	}{
+		{"sltu ra, s1, s9", []byte{0x01, 0x94, 0xb0, 0xb3}, "SLTU X25, X9, X1"},
+		// X27 is g and X4 is TP for the Go assembler
+		{"lb s0, 1177(s11)", []byte{0x49, 0x9d, 0x84, 0x03}, ""},
+		{"sltu s0, a4, s11", []byte{0x01, 0xb7, 0x34, 0x33}, ""},
+		{"xori s2, tp, -857", []byte{0xca, 0x72, 0x49, 0x13}, ""},
+		// riscv64asm writes the CSR as "CSR(2427)"
+		{"csrrw gp, 2427, a7", []byte{0x97, 0xb8, 0x91, 0xf3}, ""},
+		// newer riscv64asm writes this as a prefetch hint
+		{"ori zero, s9, -1183", []byte{0xb6, 0x1c, 0xe0, 0x13}, ""},
+	}
+	for _, test := range tt {
+		var buf bytes.Buffer
+		err := MachineInstruction{Bytes: test.bytes}.writeRISCV64Supported(&buf)
+		translation := strings.TrimSpace(buf.String())
+		if translation != test.translation || (err == nil) != (test.translation != "") {
+			t.Errorf("Unable to translate riscv64 instruction %s, got: (%q, err=%v) want: %q.", test.name, translation, err, test.translation)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package assembler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+func init() {
+	RegisterBackend(s390xBackend{})
+}
+
+// s390xBackend is the ArchBackend for s390x
+type s390xBackend struct{}
+
+func (s390xBackend) Arch() string {
+	return "s390x"
+}
+
+func (s390xBackend) MinGoVersion() int {
+	return 7
+}
+
+func (s390xBackend) GNUTargets() []string {
+	return []string{"s390x"}
+}
+
+func (s390xBackend) ByteOrder() binary.ByteOrder {
+	return binary.BigEndian
+}
+
+// ObjdumpShowsValues returns false, as objdump shows s390x instructions as bytes in memory order
+func (s390xBackend) ObjdumpShowsValues() bool {
+	return false
+}
+
+// Directives returns WORD = 4 bytes and BYTE = 1 byte - s390x instructions are 2, 4 or 6 bytes, but there is no
+// 2 byte directive, so a 6 byte instruction is a WORD followed by 2 BYTE's
+func (s390xBackend) Directives() []Directive {
+	return []Directive{{"WORD", 4}, {"BYTE", 1}}
+}
+
+// Translate never translates - golang.org/x/arch has an s390x disassembler (s390x/s390xasm), but what it's GoSyntax
+// writes hasn't been checked against the Go assembler, so s390x instructions are always written out as their bytes
+func (s390xBackend) Translate(instr MachineInstruction, w io.Writer) error {
+	return fmt.Errorf(unrecognizedInstr, instr.Command)
+}
+
+// IsPadding returns whether the instruction is one of the s390x nops, nopr (bcr 0, %r7) or nop (bc 0, 0)
+func (s390xBackend) IsPadding(instr MachineInstruction) bool {
+	switch len(instr.Bytes) {
+	case 2:
+		return binary.BigEndian.Uint16(instr.Bytes) == 0x0707
+	case 4:
+		return binary.BigEndian.Uint32(instr.Bytes) == 0x47000000
+	}
+	return false
+}
+
+// PCAlign returns false, as the Go assembler doesn't have PCALIGN for s390x
+func (s390xBackend) PCAlign() (PCAlignment, bool) {
+	return PCAlignment{}, false
+}
+
+func (s390xBackend) TranslationNeedsVerification() bool {
+	return false
+}
@@ -0,0 +1,71 @@
+package assembler
+
+import (
+	"fmt"
+	"io"
+)
+
+// wordsFill returns whether the instructions are all made up of whole WORD's, which is the smallest data directive
+// of the Go assembler for most RISC architectures
+func wordsFill(instrs []MachineInstruction) bool {
+	for _, instr := range instrs {
+		if len(instr.Bytes)%4 != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// writeWordPackedInstructions writes out the instructions of a function on an architecture where WORD is the
+// smallest data directive, packing anything which doesn't fill whole WORD's (i.e. the odd bytes objdump shows at the
+// end of a section, or data inside of code) into WORD's along with the instructions following it
+// The last WORD, and the one in front of an alignment, is padded with zeros, which are never executed as they
+// follow data
+func writeWordPackedInstructions(arch string, w io.Writer, instrs []MachineInstruction, tryTranslate bool) error {
+	order := ByteOrder(arch)
+	// the bytes which haven't been written out yet, in memory order
+	var pending []byte
+	// the instructions starting in the bytes that haven't been written out yet
+	var started []MachineInstruction
+	writeWord := func(word []byte) {
+		fmt.Fprintf(w, "    WORD $0x%08x; \t", order.Uint32(word))
+		for _, instr := range started {
+			instr.writeComment(w)
+		}
+		fmt.Fprintln(w)
+		started = nil
+	}
+
+	pad := func() {
+		if len(pending) != 0 {
+			writeWord(append(pending, make([]byte, 4-len(pending))...))
+			fmt.Fprintln(w, "    // padded with zeros")
+			pending = nil
+		}
+	}
+
+	for _, instr := range instrs {
+		if instr.Align != 0 {
+			// the alignment padding in front of the instruction was taken out, see AlignPadding
+			pad()
+			fmt.Fprintf(w, "    PCALIGN $%d\n", instr.Align)
+		}
+		if len(pending) == 0 && len(instr.Bytes)%4 == 0 {
+			// this instruction fills whole WORD's on it's own
+			if err := instr.WriteOutput(arch, w, tryTranslate); err != nil {
+				return err
+			}
+			continue
+		}
+
+		pending = append(pending, instr.MemoryBytes(arch)...)
+		started = append(started, instr)
+		for len(pending) >= 4 {
+			writeWord(pending[:4])
+			pending = pending[4:]
+		}
+	}
+	pad()
+
+	return nil
+}
@@ -0,0 +1,868 @@
+package assembler
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/arch/x86/x86asm"
+)
+
+func init() {
+	RegisterBackend(x86Backend{mode: 64})
+	RegisterBackend(x86Backend{mode: 32})
+}
+
+// x86Backend is the ArchBackend for amd64 and 386, with mode being the processor mode in bits (32 or 64)
+type x86Backend struct {
+	mode int
+}
+
+func (b x86Backend) Arch() string {
+	if b.mode == 32 {
+		return "386"
+	}
+	return "amd64"
+}
+
+// MinGoVersion returns 0, as both amd64 and 386 are supported since Go 1.0
+func (b x86Backend) MinGoVersion() int {
+	return 0
+}
+
+// GNUTargets returns no targets for amd64, as it's assembler is the native one, which is also used for 386
+// with "--32"
+func (b x86Backend) GNUTargets() []string {
+	if b.mode == 32 {
+		return []string{"i386", "i486", "i586", "i686"}
+	}
+	return nil
+}
+
+func (b x86Backend) ByteOrder() binary.ByteOrder {
+	return binary.LittleEndian
+}
+
+// ObjdumpShowsValues returns false, as objdump shows x86 instructions as bytes in memory order
+func (b x86Backend) ObjdumpShowsValues() bool {
+	return false
+}
+
+// Directives returns QUAD = 8 bytes, LONG = 4 bytes, WORD = 2 bytes and BYTE = 1 byte, as x86 has variable length
+// instructions - 386 has the same sizes except there is no QUAD
+func (b x86Backend) Directives() []Directive {
+	directives := []Directive{{"QUAD", 8}, {"LONG", 4}, {"WORD", 2}, {"BYTE", 1}}
+	if b.mode == 32 {
+		return directives[1:]
+	}
+	return directives
+}
+
+func (b x86Backend) Translate(instr MachineInstruction, w io.Writer) error {
+	return instr.writeX86Supported(b.mode, w)
+}
+
+// IsPadding returns whether the instruction is one of the (multi-byte) NOP's, i.e. "nopw 0x0(%rax,%rax,1)"
+func (b x86Backend) IsPadding(instr MachineInstruction) bool {
+	inst, err := x86asm.Decode(instr.Bytes, b.mode)
+	return err == nil && inst.Op == x86asm.NOP && inst.Len == len(instr.Bytes)
+}
+
+func (b x86Backend) PCAlign() (PCAlignment, bool) {
+	return PCAlignment{GoVersion: 21, Min: 8, Max: 2048}, true
+}
+
+func (b x86Backend) TranslationNeedsVerification() bool {
+	return false
+}
+
+// goVersion returns the Go release known to accept an instruction of the extensions listed in x86GoVersions, any
+// other instruction is accepted since Go 1.0 - the EVEX (AVX-512) instructions aren't translated at all
+func (b x86Backend) goVersion(instr MachineInstruction, goSyntax string) int {
+	inst, err := x86asm.Decode(instr.Bytes, b.mode)
+	if err != nil {
+		return b.MinGoVersion()
+	}
+	if minor, ok := x86GoVersions[inst.Op.String()]; ok {
+		return minor
+	}
+	return b.MinGoVersion()
+}
+
+func (b x86Backend) branch(instr MachineInstruction, symname func(uint64) (string, uint64)) (pcRelative, uint64, string) {
+	return instr.x86Branch(b.mode, symname)
+}
+
+func (b x86Backend) call(instr MachineInstruction) (directCall, bool) {
+	goInstr, err := x86asm.Decode(instr.Bytes, b.mode)
+	if err != nil || goInstr.Len != len(instr.Bytes) {
+		return directCall{}, false
+	}
+	rel, ok := goInstr.Args[0].(x86asm.Rel)
+	if !ok || (goInstr.Op != x86asm.CALL && !isX86Jump(goInstr.Op)) {
+		return directCall{}, false
+	}
+	return directCall{
+		call:        goInstr.Op == x86asm.CALL,
+		conditional: goInstr.Op != x86asm.CALL && goInstr.Op != x86asm.JMP,
+		target:      instr.Address + uint64(goInstr.Len) + uint64(int64(rel)),
+		// the Go assembler encodes calls and jumps to symbols as the opcode and a 32-bit displacement
+		resized: goInstr.Len != 5,
+	}, true
+}
+
+// jumpTables finds the jumps through tables gcc generates for switch statements, which are either
+// "jmp *TABLE(,%idx,8)" through a table of addresses, or in position independent code on amd64
+// "lea TABLE(%rip),%base; movslq (%base,%idx,4),%dst; add %base,%dst; jmp *%dst" through a table of the offsets of
+// the targets from the start of the table
+func (b x86Backend) jumpTables(instrs []MachineInstruction, section string, relocs map[string][]Relocation) error {
+	last := instrs[len(instrs)-1]
+	start, end := instrs[0].Address, last.Address+uint64(len(last.Bytes))
+
+	for i, instr := range instrs {
+		if len(instr.Relocations) != 1 || instr.InReference {
+			continue
+		}
+		reloc := instr.Relocations[0]
+		name, offset := reloc.target()
+		if _, ok := relocs[name]; !ok {
+			continue
+		}
+		inst, err := x86asm.Decode(instr.Bytes, b.mode)
+		relocOffset := int(reloc.Address - instr.Address)
+		if err != nil || inst.Len != len(instr.Bytes) || reloc.Address < instr.Address || relocOffset+4 > inst.Len {
+			continue
+		}
+		if b.mode == 32 {
+			// 386 objects keep the addend in the bytes of the instruction
+			offset += int64(int32(binary.LittleEndian.Uint32(instr.Bytes[relocOffset:])))
+		}
+
+		var index x86asm.Reg
+		var jumpEnd, size int
+		var relative bool
+		mem, _ := inst.Args[0].(x86asm.Mem)
+		switch {
+		case inst.Op == x86asm.JMP && mem.Base == 0 && mem.Index != 0 && int(mem.Scale) == b.mode/8:
+			index, jumpEnd, size = mem.Index, i, b.mode/8
+		case inst.Op == x86asm.LEA && reloc.Type == "R_X86_64_PC32" && i+3 < len(instrs):
+			var ok bool
+			if index, ok = x86RelativeJumpTable(inst, instrs[i+1:i+4]); !ok {
+				continue
+			}
+			// the relocation counts from the address it's applied at, while the lea counts from the end of itself
+			offset += int64(inst.Len - relocOffset)
+			jumpEnd, size, relative = i+3, 4, true
+		default:
+			continue
+		}
+
+		table := fmt.Sprintf("%s%+#x", name, offset)
+		reg, ok := x86GoRegister(index, b.mode)
+		if !ok {
+			return fmt.Errorf("instruction \"%s\" at %#x jumps through the table at %s with the index in %s, which isn't a %d-bit register",
+				strings.TrimSpace(instr.InstructionString), instr.Address, table, index, b.mode)
+		}
+		targets := tableTargets(relocs[name], uint64(offset), size, relative, section, start, end)
+		if len(targets) == 0 {
+			return fmt.Errorf("instruction \"%s\" at %#x jumps through the table at %s, but it's entries don't point into the function",
+				strings.TrimSpace(instr.InstructionString), instr.Address, table)
+		}
+
+		compare := "CMPQ"
+		if b.mode == 32 {
+			compare = "CMPL"
+		}
+		instrs[i].JumpTable = &JumpTable{
+			Table:     table,
+			Index:     reg,
+			Targets:   targets,
+			compare:   compare,
+			jumpEqual: "JEQ",
+			jump:      "JMP",
+		}
+		for j := i + 1; j <= jumpEnd; j++ {
+			instrs[j].InReference = true
+		}
+	}
+	return nil
+}
+
+// x86RelativeJumpTable returns the register holding the index for the jump through a table of relative offsets the
+// lea of the address of the table starts, or false if the lea isn't followed by the rest of the jump
+func x86RelativeJumpTable(lea x86asm.Inst, next []MachineInstruction) (x86asm.Reg, bool) {
+	var insts [3]x86asm.Inst
+	for i := range insts {
+		inst, err := x86asm.Decode(next[i].Bytes, 64)
+		if err != nil || inst.Len != len(next[i].Bytes) || len(next[i].Relocations) != 0 {
+			return 0, false
+		}
+		insts[i] = inst
+	}
+	load, add, jmp := insts[0], insts[1], insts[2]
+
+	// movslq (%base,%idx,4),%dst; add %base,%dst; jmp *%dst
+	base, _ := lea.Args[0].(x86asm.Reg)
+	dst, _ := load.Args[0].(x86asm.Reg)
+	mem, _ := load.Args[1].(x86asm.Mem)
+	if load.Op != x86asm.MOVSXD || base == 0 || dst == 0 || mem.Base != base || mem.Index == 0 || mem.Scale != 4 || mem.Disp != 0 {
+		return 0, false
+	}
+	if add.Op != x86asm.ADD || add.Args[0] != dst || add.Args[1] != base || jmp.Op != x86asm.JMP || jmp.Args[0] != dst {
+		return 0, false
+	}
+	return mem.Index, true
+}
+
+// x86GoRegister returns the Go name of the general purpose register of the size of the processor mode, i.e. "DI"
+// for RDI on amd64, or false if it's any other register
+func x86GoRegister(reg x86asm.Reg, mode int) (string, bool) {
+	switch {
+	case mode == 64 && reg >= x86asm.RAX && reg <= x86asm.RDI:
+		return strings.TrimPrefix(reg.String(), "R"), true
+	case mode == 64 && reg >= x86asm.R8 && reg <= x86asm.R15:
+		return reg.String(), true
+	case mode == 32 && reg >= x86asm.EAX && reg <= x86asm.EDI:
+		return strings.TrimPrefix(reg.String(), "E"), true
+	}
+	return "", false
+}
+
+// nativeABI is the System V calling convention on amd64, and cdecl on 386 with the arguments on the stack
+func (b x86Backend) nativeABI() nativeABI {
+	if b.mode == 32 {
+		return nativeABI{word: 4, mov: "MOVL", sp: "SP", result: "AX", saved: []string{"BX", "SI", "DI", "BP"}}
+	}
+	// BP is saved by the Go assembler for any function with a frame
+	return nativeABI{
+		word:   8,
+		mov:    "MOVQ",
+		sp:     "SP",
+		args:   []string{"DI", "SI", "DX", "CX", "R8", "R9"},
+		result: "AX",
+		saved:  []string{"BX", "R12", "R13", "R14", "R15"},
+	}
+}
+
+func (b x86Backend) resolveReferences(instrs []MachineInstruction, refs dataReferences) error {
+	for i := range instrs {
+		if instrs[i].JumpTable != nil || instrs[i].InReference {
+			// the reference to the table is written out as the compares and jumps for it's entries
+			continue
+		}
+		for _, reloc := range instrs[i].Relocations {
+			if name, _ := reloc.target(); !refs.isData(name) {
+				continue
+			}
+			if instrs[i].SymbolReference != "" {
+				return instrs[i].referenceError(reloc, "the instruction refers to more than one data symbol")
+			}
+			goSyntax, err := instrs[i].x86Reference(b.mode, reloc, refs)
+			if err != nil {
+				return err
+			}
+			instrs[i].SymbolReference = goSyntax
+		}
+	}
+	return nil
+}
+
+// x86ReferenceSentinel is put in place of the address a relocation fills in, so that it can be found in the output
+// of x86asm.GoSyntax and replaced with the reference to the Go symbol
+const x86ReferenceSentinel = 0x5ca1ab1e
+
+// x86Reference returns the x86 instruction in Go syntax with the address the relocation fills in replaced with a
+// reference to the data it points at, i.e. "LEAQ K<>+8(SB), AX" for "lea 0x0(%rip),%rax" with a relocation for K
+// The Go assembler encodes the reference with the same number of bytes as the original instruction, so the relative
+// offsets around it stay valid
+func (instr MachineInstruction) x86Reference(mode int, reloc Relocation, refs dataReferences) (string, error) {
+	inst, err := x86asm.Decode(instr.Bytes, mode)
+	if err != nil || inst.Len != len(instr.Bytes) {
+		return "", instr.referenceError(reloc, "the instruction couldn't be decoded")
+	}
+	switch reloc.Type {
+	case "R_X86_64_PC32", "R_X86_64_32", "R_X86_64_32S", "R_386_32":
+	default:
+		return "", instr.referenceError(reloc, "only absolute or PC-relative 32-bit references can be rewritten")
+	}
+	relocOffset := int(reloc.Address - instr.Address)
+	if reloc.Address < instr.Address || relocOffset+4 > inst.Len {
+		return "", instr.referenceError(reloc, "the relocation isn't inside of the instruction")
+	}
+	if opcode := x86OpcodeIndex(inst, instr.Bytes, false); opcode >= 0 && instr.Bytes[opcode] >= 0xa0 && instr.Bytes[opcode] <= 0xa3 {
+		return "", instr.referenceError(reloc, "the moffs form of MOV used for it has no Go syntax, use another register than the accumulator")
+	}
+
+	// The address is either the immediate, which always comes last, or the displacement of the memory argument
+	arg := -1
+	for i, a := range inst.Args {
+		switch a := a.(type) {
+		case x86asm.Imm:
+			if relocOffset+4 == inst.Len {
+				arg = i
+			}
+		case x86asm.Mem:
+			if arg == -1 && (a.Base == 0 || a.Base == x86asm.RIP || a.Base == x86asm.EIP) {
+				arg = i
+			}
+		}
+	}
+	if arg == -1 {
+		return "", instr.referenceError(reloc, "the address isn't an immediate or an absolute or PC-relative memory argument")
+	}
+
+	// 386 objects use REL relocations, which keep the addend in the bytes the relocation applies to, and PC-relative
+	// relocations count from the address of the relocation, while the instruction counts from the end of itself
+	name, offset := reloc.target()
+	if mode == 32 {
+		offset += int64(int32(binary.LittleEndian.Uint32(instr.Bytes[relocOffset:])))
+	}
+	if strings.HasSuffix(reloc.Type, "_PC32") {
+		offset += int64(inst.Len - relocOffset)
+	}
+	ref, ok := refs.reference(name, offset)
+	if !ok {
+		return "", instr.referenceError(reloc, fmt.Sprintf("%s%+#x isn't inside of any data symbol", name, offset))
+	}
+
+	switch a := inst.Args[arg].(type) {
+	case x86asm.Imm:
+		inst.Args[arg] = x86asm.Imm(x86ReferenceSentinel)
+	case x86asm.Mem:
+		a.Base, a.Disp = 0, x86ReferenceSentinel
+		inst.Args[arg] = a
+	}
+	goSyntax, ok := x86GoSyntax(inst, mode, instr.Address)
+	if !ok {
+		return "", instr.referenceError(reloc, "the Go assembler doesn't know the instruction under the name x86asm has for it")
+	}
+	return strings.Replace(goSyntax, fmt.Sprintf("%#x", x86ReferenceSentinel), ref, 1), nil
+}
+
+// writeX86Supported translates an x86 instruction into plan9 syntax using x86asm, with mode being
+// the processor mode in bits (32 or 64)
+// The translation is only kept when the Go assembler will encode it with exactly the same number of
+// bytes as the original instruction, otherwise the relative displacements in the surrounding raw-encoded
+// instructions would no longer point at the right place
+func (instr MachineInstruction) writeX86Supported(mode int, w io.Writer) error {
+	goInstr, err := x86asm.Decode(instr.Bytes, mode)
+	if err != nil || goInstr.Len != len(instr.Bytes) || !x86EncodingIsStable(goInstr, instr.Bytes) {
+		// Then we couldn't decode this instruction, or the Go assembler may encode it differently,
+		// so we should use the BYTE/WORD/LONG method
+		return fmt.Errorf(unrecognizedInstr, instr.Command)
+	}
+	goSyntax, ok := x86GoSyntax(goInstr, mode, instr.Address)
+	if !ok {
+		return fmt.Errorf(unrecognizedInstr, instr.Command)
+	}
+
+	fmt.Fprintf(w, "%s \t", goSyntax)
+	return nil
+}
+
+// x86GoSyntax returns the instruction in the syntax of the Go assembler for mode, or false if the Go assembler isn't
+// known to accept it. x86asm.GoSyntax names most instructions like Intel does, while the Go assembler knows many of
+// them under other names, i.e. "MOVZX AL, AX" is MOVBLZX, so only the instructions with a known Go name are written
+func x86GoSyntax(inst x86asm.Inst, mode int, pc uint64) (string, bool) {
+	goSyntax := x86asm.GoSyntax(inst, pc, nil)
+	// the Go assembler has LOCK as an instruction of it's own
+	lock := strings.HasPrefix(goSyntax, "LOCK ")
+	goSyntax = strings.TrimPrefix(goSyntax, "LOCK ")
+
+	fields := strings.SplitN(goSyntax, " ", 2)
+	name, ok := x86GoName(inst, mode, fields[0])
+	if !ok {
+		return "", false
+	}
+	fields[0] = name
+	if lock {
+		fields[0] = "LOCK; " + name
+	}
+	return strings.Join(fields, " "), true
+}
+
+// x86GoName returns the name the Go assembler knows the instruction under, given the name x86asm.GoSyntax has for it,
+// or false if it's not one of x86Ops and there is no known Go name for it
+func x86GoName(inst x86asm.Inst, mode int, name string) (string, bool) {
+	op := inst.Op.String()
+	suffix := x86Suffix(inst.DataSize)
+	switch {
+	case inst.Op == x86asm.NOP && inst.Args[0] == nil:
+		// the Go assembler only has the multi-byte NOP's
+		return "", false
+	case inst.Op == x86asm.RET && inst.Args[0] != nil:
+		// the Go assembler has no RET which pops it's arguments
+		return "", false
+	case mode == 32 && inst.Args[3] != nil:
+		// the Go assembler for 386 can't handle instructions with 4 operands, i.e. "VPERM2I128 $0x20, Y1, Y2, Y0"
+		return "", false
+	case mode == 32 && (inst.Op == x86asm.INC || inst.Op == x86asm.DEC) && x86ArgSize(inst, inst.Args[0]) == 16:
+		// the 1 byte forms 386 has for them are only used by the Go assembler for 32-bit registers
+		return "", false
+	case inst.Op == x86asm.MOVZX || inst.Op == x86asm.MOVSX || inst.Op == x86asm.MOVSXD:
+		// i.e. MOVBLZX, MOVWQSX or MOVLQSX, with the size of the source and the size of the destination
+		from := x86Suffix(x86ArgSize(inst, inst.Args[1]))
+		extend := "SX"
+		if inst.Op == x86asm.MOVZX {
+			extend = "ZX"
+		}
+		return "MOV" + from + suffix + extend, from != "" && suffix != ""
+	case inst.Op == x86asm.IMUL && inst.Args[2] != nil:
+		return "IMUL3" + suffix, suffix != ""
+	case inst.Op == x86asm.BSWAP || inst.Op == x86asm.LZCNT || inst.Op == x86asm.TZCNT:
+		return op + suffix, suffix != ""
+	case inst.Op == x86asm.CRC32:
+		// the suffix is the size of the source
+		from := x86Suffix(x86ArgSize(inst, inst.Args[1]))
+		return op + from, from != ""
+	case strings.HasPrefix(op, "CMOV") && x86Conditions[strings.TrimPrefix(op, "CMOV")] != "":
+		return "CMOV" + suffix + x86Conditions[strings.TrimPrefix(op, "CMOV")], suffix != ""
+	case strings.HasPrefix(op, "SET") && x86Conditions[strings.TrimPrefix(op, "SET")] != "":
+		return "SET" + x86Conditions[strings.TrimPrefix(op, "SET")], true
+	case x86Renames[name] != "":
+		return x86Renames[name], true
+	case x86Ops[op] && suffix != "" && name == op+suffix && x86ArgSize(inst, inst.Args[0]) != 0:
+		// x86asm.GoSyntax takes the suffix from the operand size, even for byte registers, i.e. "ADDL AL, BL", so it's
+		// taken from the destination instead
+		return op + x86Suffix(x86ArgSize(inst, inst.Args[0])), true
+	}
+	return name, x86Ops[op]
+}
+
+// x86Suffix returns the suffix the Go assembler has for an operand of size bits, i.e. "L" for 32 bits
+func x86Suffix(size int) string {
+	switch size {
+	case 8:
+		return "B"
+	case 16:
+		return "W"
+	case 32:
+		return "L"
+	case 64:
+		return "Q"
+	}
+	return ""
+}
+
+// x86ArgSize returns the size in bits of a general purpose register or memory argument, or 0 for any other argument
+func x86ArgSize(inst x86asm.Inst, arg x86asm.Arg) int {
+	switch arg := arg.(type) {
+	case x86asm.Mem:
+		return inst.MemBytes * 8
+	case x86asm.Reg:
+		switch {
+		case arg >= x86asm.AL && arg <= x86asm.R15B:
+			return 8
+		case arg >= x86asm.AX && arg <= x86asm.R15W:
+			return 16
+		case arg >= x86asm.EAX && arg <= x86asm.R15L:
+			return 32
+		case arg >= x86asm.RAX && arg <= x86asm.R15:
+			return 64
+		}
+	}
+	return 0
+}
+
+// x86Conditions are the names of the conditions of CMOVcc and SETcc in the Go assembler, by their Intel names
+var x86Conditions = map[string]string{
+	"O": "OS", "NO": "OC", "B": "CS", "AE": "CC", "E": "EQ", "NE": "NE", "BE": "LS", "A": "HI",
+	"S": "MI", "NS": "PL", "P": "PS", "NP": "PC", "L": "LT", "GE": "GE", "LE": "LE", "G": "GT",
+}
+
+// x86Renames are the instructions which the Go assembler knows under another name than x86asm.GoSyntax uses
+var x86Renames = map[string]string{
+	"MOVD":       "MOVL",
+	"MOVDQA":     "MOVO",
+	"MOVDQU":     "MOVOU",
+	"MOVSD_XMM":  "MOVSD",
+	"CVTDQ2PD":   "CVTPL2PD",
+	"CVTDQ2PS":   "CVTPL2PS",
+	"CVTSI2SDL":  "CVTSL2SD",
+	"CVTSI2SDQ":  "CVTSQ2SD",
+	"CVTSI2SSL":  "CVTSL2SS",
+	"CVTSI2SSQ":  "CVTSQ2SS",
+	"CVTTPS2DQ":  "CVTTPS2PL",
+	"CVTTSD2SIL": "CVTTSD2SL",
+	"CVTTSD2SIQ": "CVTTSD2SQ",
+	"CVTTSS2SIL": "CVTTSS2SL",
+	"CVTTSS2SIQ": "CVTTSS2SQ",
+	"PCMPEQD":    "PCMPEQL",
+	"PMULUDQ":    "PMULULQ",
+	"PSLLD":      "PSLLL",
+	"PSRAD":      "PSRAL",
+	"PSRLD":      "PSRLL",
+	"PSUBD":      "PSUBL",
+	"PUNPCKHDQ":  "PUNPCKHLQ",
+	"PUNPCKLDQ":  "PUNPCKLLQ",
+}
+
+// x86Ops are the instructions (by their x86asm names) which x86asm.GoSyntax writes the way the Go assembler takes
+// them, checked with go tool asm. Any other instruction is only translated if x86GoName knows it's Go name, as the Go
+// assembler rejects i.e. "MOVZX AL, AX" or "CMOVE SI, AX". PUSH and POP aren't included, as the Go assembler checks
+// them against the frame of the function
+var x86Ops = map[string]bool{
+	// general purpose
+	"ADC": true, "ADD": true, "AND": true, "BSF": true, "BSR": true, "BTS": true, "CDQ": true, "CDQE": true,
+	"CLC": true, "CLD": true, "CMC": true, "CMP": true, "CMPXCHG": true, "CMPXCHG16B": true, "CQO": true,
+	"CWDE": true, "DEC": true, "DIV": true, "HLT": true, "IDIV": true, "IMUL": true, "INC": true, "LAHF": true,
+	"LEA": true, "MOV": true, "MUL": true, "NEG": true, "NOP": true, "NOT": true, "OR": true, "POPCNT": true,
+	"RET": true, "ROL": true, "ROR": true, "SAHF": true, "SAR": true, "SBB": true, "SHL": true, "SHR": true,
+	"STC": true, "SUB": true, "TEST": true, "UD2": true, "XADD": true, "XCHG": true, "XOR": true,
+	// system
+	"CPUID": true, "LFENCE": true, "MFENCE": true, "PAUSE": true, "PREFETCHNTA": true, "PREFETCHT0": true,
+	"RDTSC": true, "SFENCE": true, "XGETBV": true,
+	// SSE
+	"ADDPD": true, "ADDPS": true, "ADDSD": true, "ADDSS": true, "ANDNPS": true, "ANDPD": true, "ANDPS": true,
+	"COMISD": true, "CVTSD2SS": true, "CVTSS2SD": true, "DIVSD": true, "DIVSS": true, "EMMS": true, "MAXSD": true,
+	"MINSD": true, "MOVAPD": true, "MOVAPS": true, "MOVHLPS": true, "MOVLHPS": true, "MOVMSKPS": true,
+	"MOVNTDQ": true, "MOVNTI": true, "MOVQ": true, "MOVSS": true, "MOVUPD": true, "MOVUPS": true, "MULPS": true,
+	"MULSD": true, "MULSS": true, "ORPS": true, "PADDB": true, "PADDD": true, "PADDQ": true, "PADDW": true,
+	"PALIGNR": true, "PAND": true, "PANDN": true, "PCMPEQB": true, "PEXTRD": true, "PINSRD": true, "PMAXSD": true,
+	"PMINUD": true, "PMOVMSKB": true, "PMULLD": true, "PMULLW": true, "POR": true, "PSHUFB": true, "PSHUFD": true,
+	"PSHUFLW": true, "PSLLDQ": true, "PSLLQ": true, "PSRLDQ": true, "PSRLQ": true, "PSUBB": true, "PSUBQ": true,
+	"PTEST": true, "PUNPCKHQDQ": true, "PUNPCKLBW": true, "PUNPCKLQDQ": true, "PXOR": true, "SHUFPD": true,
+	"SHUFPS": true, "SQRTSD": true, "SQRTSS": true, "SUBSD": true, "UCOMISD": true, "UCOMISS": true,
+	"UNPCKLPS": true, "XORPD": true, "XORPS": true,
+	// AES, CLMUL and SHA
+	"AESDEC": true, "AESENC": true, "AESENCLAST": true, "AESKEYGENASSIST": true, "PCLMULQDQ": true,
+	"SHA256RNDS2": true,
+	// AVX and AVX2
+	"VADDPS": true, "VEXTRACTI128": true, "VFMADD213SD": true, "VFMADD231PS": true, "VINSERTI128": true,
+	"VMOVD": true, "VMOVDQA": true, "VMOVDQU": true, "VMOVQ": true, "VMULPD": true, "VPADDD": true, "VPADDQ": true,
+	"VPALIGNR": true, "VPAND": true, "VPBLENDD": true, "VPBROADCASTD": true, "VPCMPEQB": true, "VPERM2I128": true,
+	"VPERMQ": true, "VPMOVMSKB": true, "VPSHUFB": true, "VPSLLD": true, "VPSRLDQ": true, "VPTEST": true,
+	"VPUNPCKLQDQ": true, "VPXOR": true, "VXORPS": true,
+}
+
+// x86GoVersions are the Go releases known to accept the instructions of x86Ops (by their x86asm names) which came
+// after the general purpose and SSE2 ones, Go 1.10 added the full AVX, AVX2, FMA, SSE3 and SSE4 sets
+var x86GoVersions = goVersions(map[int]string{
+	10: `
+AESDEC AESENC AESENCLAST AESKEYGENASSIST CRC32 PALIGNR PCLMULQDQ PEXTRD PINSRD PMAXSD PMINUD PMULLD POPCNT
+PSHUFB PTEST VADDPS VEXTRACTI128 VFMADD213SD VFMADD231PS VINSERTI128 VMOVD VMOVDQA VMOVDQU VMOVQ VMULPD
+VPADDD VPADDQ VPALIGNR VPAND VPBLENDD VPBROADCASTD VPCMPEQB VPERM2I128 VPERMQ VPMOVMSKB VPSHUFB VPSLLD
+VPSRLDQ VPTEST VPUNPCKLQDQ VPXOR VXORPS
+`,
+	LatestGoVersion: `
+CMPXCHG16B LZCNT SHA256RNDS2 TZCNT UD2 XGETBV
+`,
+})
+
+// x86EVEXPrefix is the first byte of the 4 byte EVEX prefix of AVX-512 instructions
+const x86EVEXPrefix = 0x62
+
+// x86EncodingIsStable reports whether the Go assembler will encode inst using the same number of bytes
+// as the original encoding src. The Go assembler always picks the shortest encoding available, as does
+// gas for plain instructions, so this mostly checks that src wasn't forced into a longer form, i.e.
+// through relocation placeholders, or explicit displacement/immediate sizes
+func x86EncodingIsStable(inst x86asm.Inst, src []byte) bool {
+	// PC-relative instructions (branches, RIP-relative addressing) are laid out again by the
+	// Go assembler, so they can never be translated as is
+	if inst.PCRel != 0 {
+		return false
+	}
+
+	vex, evex := false, false
+	for _, p := range inst.Prefix {
+		if p == 0 {
+			break
+		}
+		switch {
+		case p.IsVEX() || p&0xFF == x86EVEXPrefix:
+			// x86asm only has IsVEX, as older releases don't decode EVEX at all
+			vex, evex = true, p&0xFF == x86EVEXPrefix
+		case p.IsREX():
+		case p&(x86asm.PrefixIgnored|x86asm.PrefixInvalid) != 0:
+			// redundant prefixes are dropped by the Go assembler
+			return false
+		case p&0xFF == x86asm.PrefixAddrSize:
+			// the Go assembler has no syntax for address size overrides
+			return false
+		case p&0xFF == x86asm.PrefixCS, p&0xFF == x86asm.PrefixDS, p&0xFF == x86asm.PrefixES,
+			p&0xFF == x86asm.PrefixFS, p&0xFF == x86asm.PrefixGS, p&0xFF == x86asm.PrefixSS:
+			// segment overrides are only understood by the Go assembler in a few special cases
+			return false
+		}
+		if vex {
+			break
+		}
+	}
+
+	// The Go assembler picks between MOVL, sign-extended MOVQ and MOVABS depending on the value of the
+	// immediate, which gas doesn't do
+	if inst.Op == x86asm.MOV && inst.DataSize == 64 && isX86Imm(inst.Args[1]) {
+		return false
+	}
+
+	opcodeIndex := x86OpcodeIndex(inst, src, vex)
+	if opcodeIndex < 0 {
+		return false
+	}
+
+	// Check that the immediate used the shortest encoding, the Go assembler uses the sign-extended 8-bit
+	// immediate form of these opcodes whenever the value fits
+	if !vex {
+		switch src[opcodeIndex] {
+		case 0x68, 0x69, 0x81:
+			for _, arg := range inst.Args {
+				if imm, ok := arg.(x86asm.Imm); ok && imm == x86asm.Imm(int8(imm)) {
+					return false
+				}
+			}
+		case 0xa0, 0xa1, 0xa2, 0xa3:
+			// moffs forms have no equivalent in Go syntax
+			return false
+		}
+	}
+
+	// Finally check that every memory argument used the shortest displacement available
+	for _, arg := range inst.Args {
+		mem, ok := arg.(x86asm.Mem)
+		if !ok {
+			continue
+		}
+		if mem.Segment != 0 {
+			// this includes the implicit segments of string operations, which Go syntax doesn't have
+			return false
+		}
+		if evex && mem.Disp != 0 {
+			// EVEX uses compressed displacements, which we don't try to figure out here
+			return false
+		}
+		if x86DisplacementSize(src, opcodeIndex) != x86MinimalDisplacementSize(mem) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// x86OpcodeIndex returns the index in src of the (last) opcode byte of inst, or -1 if it couldn't be found
+func x86OpcodeIndex(inst x86asm.Inst, src []byte, vex bool) int {
+	i := 0
+	// Skip over all the legacy prefixes and REX
+	for i < len(src) && isX86LegacyPrefix(src[i]) {
+		i++
+	}
+	if inst.Mode == 64 && i < len(src) && src[i]&0xF0 == 0x40 {
+		i++
+	}
+	if i >= len(src) {
+		return -1
+	}
+
+	switch {
+	case vex && src[i] == 0xC5:
+		// 2 byte VEX prefix, the opcode map is implied
+		i += 2
+	case vex && src[i] == 0xC4:
+		// 3 byte VEX prefix, the opcode map is implied
+		i += 3
+	case vex && src[i] == x86EVEXPrefix:
+		// EVEX prefix, the opcode map is implied
+		i += 4
+	case src[i] == 0x0F:
+		i++
+		if i < len(src) && (src[i] == 0x38 || src[i] == 0x3A) {
+			i++
+		}
+	}
+	if i >= len(src) {
+		return -1
+	}
+
+	return i
+}
+
+// x86DisplacementSize returns the number of displacement bytes encoded by the ModRM byte which follows the
+// opcode at opcodeIndex
+func x86DisplacementSize(src []byte, opcodeIndex int) int {
+	if opcodeIndex+1 >= len(src) {
+		return -1
+	}
+	modrm := src[opcodeIndex+1]
+	mod, rm := modrm>>6, modrm&7
+	switch {
+	case mod == 3:
+		return 0
+	case mod == 1:
+		return 1
+	case mod == 2:
+		return 4
+	case rm == 5:
+		return 4
+	case rm == 4:
+		// SIB byte follows, and a base of 5 means there is no base register, only a 32-bit displacement
+		if opcodeIndex+2 < len(src) && src[opcodeIndex+2]&7 == 5 {
+			return 4
+		}
+	}
+	return 0
+}
+
+// x86MinimalDisplacementSize returns the number of displacement bytes that the shortest encoding of mem uses
+func x86MinimalDisplacementSize(mem x86asm.Mem) int {
+	switch {
+	case mem.Base == 0:
+		// without a base register, the displacement is always 32 bits
+		return 4
+	case mem.Disp == 0 && mem.Base != x86asm.BP && mem.Base != x86asm.EBP && mem.Base != x86asm.RBP &&
+		mem.Base != x86asm.R13W && mem.Base != x86asm.R13L && mem.Base != x86asm.R13:
+		// BP and R13 can't be encoded as a base without a displacement
+		return 0
+	case mem.Disp == int64(int8(mem.Disp)):
+		return 1
+	}
+	return 4
+}
+
+func isX86LegacyPrefix(b byte) bool {
+	switch b {
+	case 0xF0, 0xF2, 0xF3, 0x2E, 0x36, 0x3E, 0x26, 0x64, 0x65, 0x66, 0x67:
+		return true
+	}
+	return false
+}
+
+func isX86Imm(arg x86asm.Arg) bool {
+	_, ok := arg.(x86asm.Imm)
+	return ok
+}
+
+// x86Branch returns how the x86 instruction depends on it's address, see MachineInstruction.branch
+func (instr MachineInstruction) x86Branch(mode int, symname func(uint64) (string, uint64)) (pcRelative, uint64, string) {
+	goInstr, err := x86asm.Decode(instr.Bytes, mode)
+	if err != nil || goInstr.Len != len(instr.Bytes) {
+		// we don't know what this is, so it has to stay where it is
+		return positionDependent, 0, ""
+	}
+	if goInstr.PCRel == 0 {
+		return notPCRelative, 0, ""
+	}
+
+	rel, ok := goInstr.Args[0].(x86asm.Rel)
+	if !ok || !isX86Jump(goInstr.Op) {
+		// i.e. RIP-relative addressing, calls, or LOOP, which the Go assembler only has short forms of
+		return positionDependent, 0, ""
+	}
+
+	target := instr.Address + uint64(goInstr.Len) + uint64(int64(rel))
+	return labelBranch, target, x86asm.GoSyntax(goInstr, instr.Address, symname)
+}
+
+// isX86Jump returns whether op is an unconditional or conditional jump, which the Go assembler knows under
+// the same names as x86asm.GoSyntax uses for them
+func isX86Jump(op x86asm.Op) bool {
+	switch op {
+	case x86asm.JMP,
+		x86asm.JA, x86asm.JAE, x86asm.JB, x86asm.JBE, x86asm.JE, x86asm.JNE,
+		x86asm.JG, x86asm.JGE, x86asm.JL, x86asm.JLE,
+		x86asm.JO, x86asm.JNO, x86asm.JP, x86asm.JNP, x86asm.JS, x86asm.JNS:
+		return true
+	}
+	return false
+}
+
+// pcThunkPrefix is the prefix of the thunks gcc generates for 32-bit x86 position independent code, i.e.
+// __x86.get_pc_thunk.bx loads the return address (the address of the instruction after the call) into ebx
+const pcThunkPrefix = "__x86.get_pc_thunk."
+
+// IsPCThunk returns whether the symbol is one of the __x86.get_pc_thunk.* functions
+func IsPCThunk(symbol string) bool {
+	_, ok := pcThunkRegister(symbol)
+	return ok
+}
+
+// pcThunkRegister returns the Go name of the register that the PC thunk symbol loads the PC into
+func pcThunkRegister(symbol string) (string, bool) {
+	if !strings.HasPrefix(symbol, pcThunkPrefix) {
+		return "", false
+	}
+	switch reg := strings.TrimPrefix(symbol, pcThunkPrefix); reg {
+	case "ax", "bx", "cx", "dx", "si", "di", "bp":
+		return strings.ToUpper(reg), true
+	}
+	return "", false
+}
+
+// pcThunkRegister returns the Go name of the register loaded by the PC thunk the instruction calls on 386, if it is
+// a call to one of the thunks, which are only used by 32-bit position independent code
+func (b x86Backend) pcThunkRegister(instr MachineInstruction) (string, bool) {
+	if b.mode != 32 {
+		return "", false
+	}
+	return instr.x86PCThunkRegister()
+}
+
+// checkPIC returns an error for the position independent code on 386 which can't be written in Go, see check386PIC
+func (b x86Backend) checkPIC(instr MachineInstruction) error {
+	if b.mode != 32 {
+		return nil
+	}
+	return instr.check386PIC()
+}
+
+// x86PCThunkRegister returns the Go name of the register loaded by the PC thunk this instruction calls,
+// if it is a call to one of the thunks
+func (instr MachineInstruction) x86PCThunkRegister() (string, bool) {
+	if !strings.HasPrefix(instr.Command, "call") {
+		return "", false
+	}
+	// The thunk is usually referenced through a relocation, but if it is defined in the same section and
+	// isn't global, then the call has already been resolved and objdump shows the name of the target
+	for _, reloc := range instr.Relocations {
+		if reg, ok := pcThunkRegister(reloc.Symbol); ok {
+			return reg, true
+		}
+	}
+	for _, arg := range instr.Arguments {
+		if start, end := strings.Index(arg, "<"), strings.LastIndex(arg, ">"); start != -1 && end > start {
+			if reg, ok := pcThunkRegister(arg[start+1 : end]); ok {
+				return reg, true
+			}
+		}
+	}
+	return "", false
+}
+
+// pcThunkGoName returns the name of the file-private Go implementation of the PC thunk for reg
+func pcThunkGoName(reg string) string {
+	return fmt.Sprintf("x86_get_pc_thunk_%s<>(SB)", strings.ToLower(reg))
+}
+
+// writePCThunkCall rewrites a call to the PC thunk for reg into a call to the Go implementation of that thunk.
+// The Go CALL has the same 5 byte encoding as the original call, so relative offsets around it aren't affected
+func writePCThunkCall(w io.Writer, reg string) {
+	fmt.Fprintf(w, "CALL %s \t", pcThunkGoName(reg))
+}
+
+// WritePCThunk writes a Go implementation of the PC thunk which loads the PC into reg, for use with calls
+// rewritten by WriteOutput
+func WritePCThunk(w io.Writer, reg string) {
+	fmt.Fprintf(w, `// %s%s loads the return address into %s
+TEXT %s, NOSPLIT, $0-0
+    MOVL 0(SP), %s
+    RET
+`,
+		pcThunkPrefix,
+		strings.ToLower(reg),
+		reg,
+		pcThunkGoName(reg),
+		reg,
+	)
+}
+
+// check386PIC returns an error if the instruction uses position independent addressing through the global
+// offset table, which can't work in Go as the Go linker doesn't create one for assembly functions
+func (instr MachineInstruction) check386PIC() error {
+	for _, reloc := range instr.Relocations {
+		switch reloc.Type {
+		case "R_386_GOTPC", "R_386_GOTOFF", "R_386_GOT32", "R_386_GOT32X", "R_386_PLT32":
+			return fmt.Errorf("instruction \"%s\" at %#x uses the global offset table through %s (%s), which isn't supported in Go assembly - assemble without -fPIC, or only use the __x86.get_pc_thunk.* functions to read the PC",
+				strings.TrimSpace(instr.InstructionString), instr.Address, reloc.Symbol, reloc.Type)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package assembler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestInstructionGOTRelocation(t *testing.T) {
+	instr := MachineInstruction{
+		InstructionString: "add    $0x1,%eax",
+		Command:           "add",
+		Arguments:         []string{"$0x1", "%eax"},
+		Bytes:             []byte{0x05, 0x01, 0x00, 0x00, 0x00},
+		Address:           5,
+		Relocations: []Relocation{
+			{Address: 6, Type: "R_386_GOTPC", Symbol: "_GLOBAL_OFFSET_TABLE_"},
+		},
+	}
+	var buf bytes.Buffer
+	err := instr.WriteOutput("386", &buf, true)
+	if err == nil || !strings.Contains(err.Error(), "_GLOBAL_OFFSET_TABLE_") || buf.Len() != 0 {
+		t.Errorf("Expected an error for GOT relocation of (instr=%v), got: (err=%v, output=%s).", instr, err, buf.String())
+	}
+}
+
+func TestWritePCThunk(t *testing.T) {
+	var buf bytes.Buffer
+	WritePCThunk(&buf, "BX")
+	want := "// __x86.get_pc_thunk.bx loads the return address into BX TEXT x86_get_pc_thunk_bx<>(SB), NOSPLIT, $0-0 MOVL 0(SP), BX RET"
+	if got := adjustWhitespace(buf.String()); got != want {
+		t.Errorf("Unable to write PC thunk, got: (output=%s\n) want: (output=%s\n).", got, want)
+	}
+}
+
+func TestPCThunkRegister(t *testing.T) {
+	call := MachineInstruction{
+		Command:     "call",
+		Arguments:   []string{"5"},
+		Bytes:       []byte{0xe8, 0, 0, 0, 0},
+		Relocations: []Relocation{{Address: 1, Type: "R_386_PC32", Symbol: "__x86.get_pc_thunk.bx"}},
+	}
+	local := MachineInstruction{Command: "call", Arguments: []string{"20", "<__x86.get_pc_thunk.cx>"}, Bytes: []byte{0xe8, 0x0b, 0, 0, 0}}
+	tables := []struct {
+		arch  string
+		instr MachineInstruction
+		reg   string
+	}{
+		{"386", call, "BX"},
+		{"386", local, "CX"},
+		// only 32-bit position independent code uses the thunks
+		{"amd64", call, ""},
+		{"386", MachineInstruction{Command: "call", Arguments: []string{"20", "<f>"}, Bytes: []byte{0xe8, 0x0b, 0, 0, 0}}, ""},
+	}
+	for _, table := range tables {
+		if reg, _ := table.instr.PCThunkRegister(table.arch); reg != table.reg {
+			t.Errorf("Unable to find PC thunk register of %v on %s, got: %q want: %q.", table.instr.Arguments, table.arch, reg, table.reg)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteInstructions("386", &buf, []MachineInstruction{call}, true); err != nil || !strings.Contains(buf.String(), "CALL x86_get_pc_thunk_bx<>(SB)") {
+		t.Errorf("Unable to rewrite call to PC thunk, got: (err=%v, output=%s).", err, buf.String())
+	}
+}
+
+func TestX86GoSyntax(t *testing.T) {
+	tables := []struct {
+		mode   int
+		bytes  []byte
+		output string
+	}{
+		// movdqa (%rdi),%xmm0
+		{64, []byte{0x66, 0x0f, 0x6f, 0x07}, "MOVO 0(DI), X0"},
+		// movdqu %xmm1,(%rsi)
+		{64, []byte{0xf3, 0x0f, 0x7f, 0x0e}, "MOVOU X1, 0(SI)"},
+		// movzbl (%rdi),%eax
+		{64, []byte{0x0f, 0xb6, 0x07}, "MOVBLZX 0(DI), AX"},
+		// movzwq %ax,%rax
+		{64, []byte{0x48, 0x0f, 0xb7, 0xc0}, "MOVWQZX AX, AX"},
+		// movsbl 0x1(%rdi),%eax
+		{64, []byte{0x0f, 0xbe, 0x47, 0x01}, "MOVBLSX 0x1(DI), AX"},
+		// movslq %edi,%rax
+		{64, []byte{0x48, 0x63, 0xc7}, "MOVLQSX DI, AX"},
+		// cmove %rsi,%rax
+		{64, []byte{0x48, 0x0f, 0x44, 0xc6}, "CMOVQEQ SI, AX"},
+		// cmovb %esi,%eax
+		{64, []byte{0x0f, 0x42, 0xc6}, "CMOVLCS SI, AX"},
+		// sete %al
+		{64, []byte{0x0f, 0x94, 0xc0}, "SETEQ AL"},
+		// add %al,%bl - x86asm.GoSyntax writes ADDL
+		{64, []byte{0x00, 0xc3}, "ADDB AL, BL"},
+		// imul $0x3,%rsi,%rax
+		{64, []byte{0x48, 0x6b, 0xc6, 0x03}, "IMUL3Q $0x3, SI, AX"},
+		// lock xadd %eax,(%rdi)
+		{64, []byte{0xf0, 0x0f, 0xc1, 0x07}, "LOCK; XADDL AX, 0(DI)"},
+		// cvttsd2si %xmm0,%rax
+		{64, []byte{0xf2, 0x48, 0x0f, 0x2c, 0xc0}, "CVTTSD2SQ X0, AX"},
+		// movzbl %al,%eax
+		{32, []byte{0x0f, 0xb6, 0xc0}, "MOVBLZX AL, AX"},
+		// the Go assembler only has the multi-byte NOP's
+		{64, []byte{0x90}, ""},
+		// ret $0x8
+		{64, []byte{0xc2, 0x08, 0x00}, ""},
+		// push %rbx, which the Go assembler counts against the frame of the function
+		{64, []byte{0x53}, ""},
+		// vperm2i128 $0x20,%ymm1,%ymm2,%ymm0, as the Go assembler for 386 doesn't take 4 operands
+		{32, []byte{0xc4, 0xe3, 0x6d, 0x46, 0xc1, 0x20}, ""},
+	}
+	for _, table := range tables {
+		var buf bytes.Buffer
+		err := MachineInstruction{Bytes: table.bytes}.writeX86Supported(table.mode, &buf)
+		output := strings.TrimSpace(buf.String())
+		if output != table.output || (err == nil) != (table.output != "") {
+			t.Errorf("Unable to translate %x in %d-bit mode, got: (err=%v, output=%q) want: %q.", table.bytes, table.mode, err, output, table.output)
+		}
+	}
+}
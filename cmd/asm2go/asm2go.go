@@ -5,23 +5,28 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"flag"
 	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/token"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"text/tabwriter"
 
 	"github.com/anonymouse64/asm2go/assembler"
 	"github.com/anonymouse64/asm2go/assembler/gnu"
+	"github.com/anonymouse64/asm2go/assembler/goasm"
 )
 
 type arrayFlags []string
@@ -60,13 +65,14 @@ type FunctionDeclaration struct {
 }
 
 // makeAssembler uses the user-specified assemblerName + assemblerFile to fill in details about the assembler
-// to use for assembling the program
-func makeAssembler(assemblerName string, assemblerFile string) (assembler.Assembler, error) {
+// to use for assembling the program, asOpts are the options that will be passed to the assembler, which may
+// change the architecture being assembled for (i.e. "--32" for an amd64 assembler)
+func makeAssembler(assemblerName string, assemblerFile string, asOpts []string) (assembler.Assembler, error) {
 	// First see if we have the name of this assembler, in which case we can just try to find a corresponding assembler file
 	var err error
 	var assemblerExecName string
 	_, assemblerExec := filepath.Split(assemblerFile)
-	arch := runtime.GOARCH
+	arch := archForOptions(runtime.GOARCH, asOpts)
 	switch assemblerName {
 	case "":
 		// We don't have the name, so look in the file, which should be an absolute file
@@ -86,25 +92,10 @@ func makeAssembler(assemblerName string, assemblerFile string) (assembler.Assemb
 			} else {
 				prefix = ""
 			}
-			// Use gas assembler, check what architecture
-			if strings.Contains(assemblerFile, "arm") {
-				return gnu.GnuAssembler{
-					AsExecutable:   assemblerFile,
-					Arch:           "arm",
-					Prefix:         prefix,
-					BinToolsFolder: binToolsFolder,
-				}, nil
-			} else if strings.Contains(assemblerFile, "aarch64") {
-				return gnu.GnuAssembler{
-					AsExecutable:   assemblerFile,
-					Arch:           "arm64",
-					Prefix:         prefix,
-					BinToolsFolder: binToolsFolder,
-				}, nil
-			}
+			// Use gas assembler, check what architecture from the name of the assembler
 			return gnu.GnuAssembler{
 				AsExecutable:   assemblerFile,
-				Arch:           arch,
+				Arch:           archFromAssemblerName(assemblerExec, arch),
 				Prefix:         prefix,
 				BinToolsFolder: binToolsFolder,
 			}, nil
@@ -114,9 +105,13 @@ func makeAssembler(assemblerName string, assemblerFile string) (assembler.Assemb
 		default:
 			return assembler.InvalidAssembler(), fmt.Errorf("%s is not supported yet", assemblerFile)
 		}
-	case "arm-linux-gnueabihf-as":
-		arch = "arm"
-		assemblerExecName = "arm-linux-gnueabihf-as"
+	default:
+		// Cross GNU assemblers are named after the target triplet, i.e. "arm-linux-gnueabihf-as"
+		if _, ok := assembler.BackendForGNUAssembler(assemblerName); !ok || !strings.HasSuffix(assemblerName, "-as") {
+			return assembler.InvalidAssembler(), fmt.Errorf("%s is not supported yet", assemblerName)
+		}
+		arch = archFromAssemblerName(assemblerName, arch)
+		assemblerExecName = assemblerName
 		fallthrough
 	case "gas":
 		if assemblerExecName == "" {
@@ -140,11 +135,32 @@ func makeAssembler(assemblerName string, assemblerFile string) (assembler.Assemb
 			Prefix:         prefix,
 			BinToolsFolder: binToolsFolder,
 		}, nil
-	default:
-		return assembler.InvalidAssembler(), fmt.Errorf("%s is not supported yet", assemblerName)
 	}
 }
 
+// archFromAssemblerName returns the architecture that the GNU assembler with the specified name assembles for,
+// or defaultArch if the name doesn't specify the architecture (i.e. the native "as")
+func archFromAssemblerName(name string, defaultArch string) string {
+	if backend, ok := assembler.BackendForGNUAssembler(name); ok {
+		return backend.Arch()
+	}
+	return defaultArch
+}
+
+// archForOptions returns the architecture that an assembler for arch will assemble for when passed asOpts,
+// this is needed because the native assembler on amd64 can also assemble 32-bit code with "--32"
+func archForOptions(arch string, asOpts []string) string {
+	for _, opt := range asOpts {
+		switch {
+		case opt == "--32" && arch == "amd64":
+			arch = "386"
+		case opt == "--64" && arch == "386":
+			arch = "amd64"
+		}
+	}
+	return arch
+}
+
 // getStringFromFilePosition gets the associated string from a file given a start and end position
 func getStringFromFilePosition(fset *token.FileSet, start, end token.Pos) (string, error) {
 	// Check that the start comes before the end
@@ -377,8 +393,16 @@ func parseGoLangFileForFuncDecls(goSrc string) (map[string]FunctionDeclaration,
 // Additionally, argument information isn't parsed to do anything with the instructions itself, but is used to populate the go comment above
 // the function implementation itself. If a symbol is deemed "interesting" (see comments in main() for explicit explanation of this creiterion),
 // but doesn't have a corresponding golang function, then no such export comment is generated for it and that symbol/function is assumed to be
-// just available inside the assembly file
-func generatePlan9Assembly(goDeclarationFile, outputFile, arch string, syms map[string][]assembler.MachineInstruction) error {
+// just available inside the assembly file as a file-private symbol (see goFunctions)
+// The data symbols are written out as DATA and GLOBL directives before the functions, and the instructions referring
+// to them are rewritten to refer to the Go symbols for the data, as are calls and jumps between the functions and
+// calls to the undefined symbols mapped onto Go functions by the extern directives in the Go file, and jumps through
+// the tables found through dataRelocations, any other relocation in the instructions is an error naming the symbol
+// from objectSymbols it refers to
+// If verifier isn't nil, every translated instruction is checked against the Go assembler, and the whole output is
+// assembled for arch afterwards to make sure it builds. If summary is set, a comment with how many of the
+// instructions were translated is added after each function
+func generatePlan9Assembly(goDeclarationFile, outputFile, arch string, syms map[string][]assembler.MachineInstruction, data []assembler.DataSymbol, dataRelocations map[string][]assembler.Relocation, objectSymbols []assembler.Symbol, privateGlobals bool, verifier *goasm.Verifier, goVersion int, summary bool) error {
 
 	// First make sure the goDeclarationFile exists
 	if goDeclarationFile == "" {
@@ -409,7 +433,9 @@ func generatePlan9Assembly(goDeclarationFile, outputFile, arch string, syms map[
 		defer f.Close()
 		output = f
 	}
-	w := tabwriter.NewWriter(output, 0, 0, 1, ' ', 0)
+	// Keep a copy of the output to assemble it after it has been generated
+	var generated bytes.Buffer
+	w := tabwriter.NewWriter(io.MultiWriter(output, &generated), 0, 0, 1, ' ', 0)
 
 	// Add a header to the file generated to show what command generated this file and also
 	// always include the textflag.h include file for stuff like NOSPLIT, NOPTR, etc.
@@ -418,16 +444,46 @@ func generatePlan9Assembly(goDeclarationFile, outputFile, arch string, syms map[
 
 `, strings.Join(os.Args[1:], " "))
 
+	// Write out the data symbols first, with the contents of each followed by the GLOBL declaring it
+	for _, d := range data {
+		assembler.WriteData(arch, w, d)
+		fmt.Fprintln(w)
+	}
+
+	// Calls and jumps between the functions go to the Go symbols for them, and calls to undefined symbols go to the
+	// Go functions they are mapped onto
+	functions, err := goFunctions(syms, decls, objectSymbols, privateGlobals)
+	if err != nil {
+		return fmt.Errorf("error: %v : %s", err, goDeclarationFile)
+	}
+	externs, err := parseExternDirectives(goDeclarationFile)
+	if err != nil {
+		return err
+	}
+	nosplit, err := nosplitFunctions(filepath.Dir(goDeclarationFile), outputFile)
+	if err != nil {
+		return err
+	}
+	externFuncs, err := externFunctions(arch, externs, objectSymbols, nosplit)
+	if err != nil {
+		return fmt.Errorf("error: %v : %s", err, goDeclarationFile)
+	}
+	functions = append(functions, externFuncs...)
+	calledExterns := make(map[string]bool)
+
+	// Keep track of the registers of any PC thunks that are called, so we can emit Go implementations for them
+	pcThunkRegs := make(map[string]bool)
+
 	// For each symbol in the list, which should only be functions, other types aren't yet supported
 	// add the assembly TEXT signature
 	for sym, instrs := range syms {
-		funcDecl, ok := decls[sym]
-		if !ok {
-			// Then this symbol doesn't have a corresponding go function that calls it, so we can just insert it into the file
-			// as a basic TEXT with reported stack size of 0 and no flags
-			// TODO implement...
-			return fmt.Errorf("error: symbol %s not found in go file declaration : %s", sym, goDeclarationFile)
+		var caller assembler.Function
+		for _, f := range functions {
+			if f.Name == sym {
+				caller = f
+			}
 		}
+		funcDecl := decls[sym]
 
 		// Calculate the total number of bytes for the args + results
 		var totalBytes uintptr
@@ -440,54 +496,281 @@ func generatePlan9Assembly(goDeclarationFile, outputFile, arch string, syms map[
 
 		// TODO: get the golang function signature and include it in the assembly signature comment
 
+		// Jumps through tables in the data sections are rewritten to jump to labels for the entries, which the
+		// calls rely on when they change size
+		if err := assembler.ResolveJumpTables(arch, instrs, caller.Symbol, dataRelocations); err != nil {
+			return fmt.Errorf("error: symbol %s : %v", sym, err)
+		}
+
+		// Calls and jumps to the other functions are rewritten before the signature, as they decide the flags
+		if err := assembler.ResolveCalls(arch, instrs, caller.Symbol, functions); err != nil {
+			return fmt.Errorf("error: symbol %s : %v", sym, err)
+		}
+		// Any of the functions can be on the way to a call to an extern, which needs g to be where Go keeps it
+		if len(externFuncs) != 0 {
+			if err := assembler.CheckGRegister(arch, instrs); err != nil {
+				return fmt.Errorf("error: symbol %s : %v", sym, err)
+			}
+		}
+
 		// Format the function signature
-		fmt.Fprintf(w,
-			`%s
-TEXT ·%s(SB), %s, $%d-8
+		if _, ok := decls[sym]; ok {
+			fmt.Fprintf(w,
+				`%s
+TEXT %s(SB), %s, $%d-8
 `,
-			"// "+funcDecl.SignatureString,
-			sym,
-			// TODO: handle flags here
-			"0",
-			totalBytes,
-		)
-
-		// NOTE: for arm64, currently the disassembler doesn't sync with the assembler
+				"// "+funcDecl.SignatureString,
+				caller.GoName,
+				assembler.TextFlags(instrs),
+				totalBytes,
+			)
+		} else {
+			// Functions without a declaration can only be called from the other functions, so they never have a Go
+			// frame or arguments of their own
+			fmt.Fprintf(w,
+				`// %s isn't declared in Go, it's only called from the other functions
+TEXT %s(SB), NOSPLIT|NOFRAME, $0-0
+`,
+				sym,
+				caller.GoName,
+			)
+		}
+
+		// NOTE: for some architectures (i.e. arm64), currently the disassembler doesn't sync with the assembler
 		// and so we shouldn't try to translate supported op codes because the dissassembler
-		// produces syntax that the assembler doesn't understand
+		// produces syntax that the assembler doesn't understand, unless every translation is verified
 		trySupportedTranslation := true
-		if arch == "arm64" {
+		if backend, ok := assembler.Backend(arch); ok && backend.TranslationNeedsVerification() && verifier == nil {
 			trySupportedTranslation = false
 		}
 
+		// References to data in the object file are written as references to the Go symbols for the data
+		if err := assembler.ResolveDataReferences(arch, instrs, data); err != nil {
+			return fmt.Errorf("error: symbol %s : %v", sym, err)
+		}
+		if err := assembler.CheckRelocations(arch, instrs, objectSymbols); err != nil {
+			return fmt.Errorf("error: symbol %s : %v", sym, err)
+		}
+
+		// Alignment padding is only right at the address the function was at in the object file, so it's taken out
+		// in favour of PCALIGN where possible
+		var warnings []string
+		instrs, warnings = assembler.AlignPadding(arch, instrs, goVersion, trySupportedTranslation)
+		for _, warning := range warnings {
+			fmt.Fprintf(os.Stderr, "warning: symbol %s : %s\n", sym, warning)
+		}
+		if trySupportedTranslation && verifier != nil {
+			if err := verifier.VerifyTranslations(arch, instrs); err != nil {
+				return fmt.Errorf("error: symbol %s : %v", sym, err)
+			}
+		}
+
 		// Now output all of the instructions for this symbol
+		err := assembler.WriteInstructions(arch, w, instrs, trySupportedTranslation)
+		if err != nil {
+			return fmt.Errorf("error: symbol %s : %v", sym, err)
+		}
 		for _, instr := range instrs {
-			err := instr.WriteOutput(arch, w, trySupportedTranslation)
-			if err != nil {
-				return err
+			if reg, ok := instr.PCThunkRegister(arch); ok {
+				pcThunkRegs[reg] = true
 			}
+			calledExterns[instr.Callee] = true
 		}
 
 		// Finally for this symbol append a RET to the end
 		// this handles all returns in all architectures
 		fmt.Fprintln(w, "    RET")
+		if summary {
+			assembler.WriteSummary(arch, w, instrs, trySupportedTranslation)
+		}
+	}
+
+	// Add the implementations of the PC thunks that were called, in a consistent order
+	var regs []string
+	for reg := range pcThunkRegs {
+		regs = append(regs, reg)
+	}
+	sort.Strings(regs)
+	for _, reg := range regs {
+		fmt.Fprintln(w)
+		assembler.WritePCThunk(w, reg)
+	}
+
+	// Add the functions calling the Go functions the called externs are mapped onto
+	for _, e := range externs {
+		if calledExterns[e.Name] {
+			fmt.Fprintln(w)
+			if err := assembler.WriteExtern(arch, w, e); err != nil {
+				return err
+			}
+		}
 	}
 
 	// Flush all output
 	w.Flush()
 
+	if verifier != nil {
+		return verifyOutput(verifier, arch, outputFile, generated.Bytes())
+	}
+
 	return nil
 }
 
+// goFunctions returns the functions in syms along with the names of the Go symbols they are written out as, which
+// is the name of the Go declaration for them in decls, or a file-private symbol (i.e. "helper<>") for local functions
+// without one, which are only called from the other functions
+// Global symbols without a declaration are an error, as the declaration is most likely missing or misspelled, unless
+// privateGlobals is set, in which case they are written out as file-private symbols too, like the local ones
+// Local symbols that aren't functions (i.e. a label in the middle of a function without the .L prefix) are always an
+// error, as the code before them would fall through into them
+func goFunctions(syms map[string][]assembler.MachineInstruction, decls map[string]FunctionDeclaration, objectSymbols []assembler.Symbol, privateGlobals bool) ([]assembler.Function, error) {
+	var functions []assembler.Function
+	for _, sym := range objectSymbols {
+		if _, ok := syms[sym.Name]; !ok {
+			continue
+		}
+		_, declared := decls[sym.Name]
+		switch {
+		case declared:
+			functions = append(functions, assembler.Function{Symbol: sym, GoName: "·" + sym.Name})
+			continue
+		case sym.Global && !privateGlobals:
+			return nil, fmt.Errorf("symbol %s not found in go file declaration (use -undeclared-globals=private to write it out as a file-private symbol)", sym.Name)
+		case !sym.Global && !sym.Function:
+			return nil, fmt.Errorf("symbol %s not found in go file declaration, and it isn't a function (mark it with \".type %s, %%function\" if it is one)", sym.Name, sym.Name)
+		}
+		functions = append(functions, assembler.Function{Symbol: sym, GoName: assembler.PrivateName(sym.Name)})
+	}
+	return functions, nil
+}
+
+// parseExternDirectives returns the mappings of undefined symbols onto Go functions from the extern directives in the
+// comments of the Go file, i.e. "//asm2go:extern memcpy=runtime·memmove args=3"
+func parseExternDirectives(goSrc string) ([]assembler.Extern, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, goSrc, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var externs []assembler.Extern
+	for _, group := range f.Comments {
+		for _, comment := range group.List {
+			if !strings.HasPrefix(comment.Text, assembler.ExternDirective) {
+				continue
+			}
+			e, err := assembler.ParseExtern(strings.TrimPrefix(comment.Text, assembler.ExternDirective))
+			if err != nil {
+				return nil, fmt.Errorf("error: %s : %v", fset.Position(comment.Pos()), err)
+			}
+			externs = append(externs, e)
+		}
+	}
+	return externs, nil
+}
+
+// externFunctions returns the undefined symbols in objectSymbols which are mapped onto Go functions by externs, along
+// with the names of the Go functions calling them which the calls to the symbols are rewritten to call
+// nosplit are the NOSPLIT assembly functions of the package, which are the only ones of it the externs can be mapped
+// onto, see assembler.CheckExternTarget
+func externFunctions(arch string, externs []assembler.Extern, objectSymbols []assembler.Symbol, nosplit map[string]bool) ([]assembler.Function, error) {
+	var functions []assembler.Function
+	for _, e := range externs {
+		for _, sym := range objectSymbols {
+			if sym.Name != e.Name || sym.Section != "*UND*" {
+				continue
+			}
+			if err := assembler.CheckExtern(arch, e); err != nil {
+				return nil, err
+			}
+			if err := assembler.CheckExternTarget(e, nosplit); err != nil {
+				return nil, err
+			}
+			functions = append(functions, assembler.Function{Symbol: sym, GoName: e.GoName()})
+		}
+	}
+	return functions, nil
+}
+
+// nosplitTEXT matches the TEXT directive of a NOSPLIT assembly function of the package, i.e.
+// "TEXT ·cstrlen(SB), NOSPLIT|NOFRAME, $0-16", with the name of the function
+var nosplitTEXT = regexp.MustCompile(`(?m)^\s*TEXT\s+(·\w+)\(SB\)\s*,\s*[A-Z|]*\bNOSPLIT\b`)
+
+// nosplitFunctions returns the NOSPLIT assembly functions in the assembly files in dir, other than outputFile which is
+// about to be generated
+func nosplitFunctions(dir, outputFile string) (map[string]bool, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.s"))
+	if err != nil {
+		return nil, err
+	}
+	nosplit := make(map[string]bool)
+	for _, file := range files {
+		if outputFile != "" && filepath.Clean(file) == filepath.Clean(outputFile) {
+			continue
+		}
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range nosplitTEXT.FindAllStringSubmatch(string(src), -1) {
+			nosplit[m[1]] = true
+		}
+	}
+	return nosplit, nil
+}
+
+// verifyOutput makes sure the generated assembly builds for arch with the Go assembler
+func verifyOutput(verifier *goasm.Verifier, arch, outputFile string, generated []byte) error {
+	if outputFile == "" {
+		// the output only went to stdout, so it needs a file to be assembled
+		f, err := ioutil.TempFile("", "asm2go-*.s")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+		if _, err := f.Write(generated); err != nil {
+			return err
+		}
+		outputFile = f.Name()
+	}
+
+	return verifier.AssembleFile(arch, outputFile)
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "modernize" {
+		modernizeMain(os.Args[2:])
+		return
+	}
+
 	// Setup flags
 	flag.Var(&assemblerOptions, "as-opts", "Assembler options to use")
 	assemblerOpt := flag.String("as", "gas", "assembler to use")
 	fileOpt := flag.String("file", "", "file to assemble")
 	goFileOpt := flag.String("gofile", "", "go file with function declarations")
 	outputFile := flag.String("out", "", "output file to place data in (empty uses stdout)")
+	summaryOpt := flag.Bool("summary", false, "add a comment after each function with how many instructions were translated")
+	verifyOpt := flag.Bool("verify", false, "check every translated instruction and the output with the go tool of the Go toolchain on the $PATH")
+	goVersionOpt := flag.String("go", "", "oldest Go release the output has to build with, i.e. 1.21 (empty uses everything the newest release accepts)")
+	undeclaredGlobalsOpt := flag.String("undeclared-globals", "error", "what to do with global functions without a Go declaration: error (as the declaration is most likely missing or misspelled) or private (write them out as file-private symbols, like local functions)")
 	flag.Parse()
 
+	if *undeclaredGlobalsOpt != "private" && *undeclaredGlobalsOpt != "error" {
+		fmt.Printf("invalid value %q for -undeclared-globals, must be error or private\n", *undeclaredGlobalsOpt)
+		os.Exit(1)
+	}
+
+	goVersion := assembler.LatestGoVersion
+	if *goVersionOpt != "" {
+		var err error
+		goVersion, err = assembler.ParseGoVersion(*goVersionOpt)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
 	file := *fileOpt
 
 	// Check if the file exists
@@ -505,17 +788,17 @@ func main() {
 	var as assembler.Assembler
 	// First handle named assemblers, then check if the assembler specified is a file
 	if assemblerString == "gas" || assemblerString == "as" || assemblerString == "gcc" {
-		as, err = makeAssembler("gas", "")
+		as, err = makeAssembler("gas", "", assemblerOptions)
 	} else if assemblerString == "yasm" {
 		// TODO
 	} else if assemblerString == "armcc" {
 		// TODO
 	} else if _, statErr := os.Stat(*assemblerOpt); statErr == nil {
 		// assembler is a valid file path
-		as, err = makeAssembler("", *assemblerOpt)
+		as, err = makeAssembler("", *assemblerOpt, assemblerOptions)
 	} else if _, statErr := os.Stat(assemblerOnPath); statErr == nil {
 		// assembler is a file that exists on the $PATH
-		as, err = makeAssembler("", assemblerOnPath)
+		as, err = makeAssembler("", assemblerOnPath, assemblerOptions)
 	} else {
 		fmt.Printf("assembler %s not supported\n", *assemblerOpt)
 		os.Exit(1)
@@ -548,15 +831,33 @@ func main() {
 	// - Not a File symbol
 	// - Section is not "*UND*" (i.e. it's not in an undefined section, i.e. another object file)
 	// - Section is not "*ABS*" (i.e. it is a symbol associated with a particular section)
+	// - Not one of gcc's __x86.get_pc_thunk.* functions, calls to these are rewritten and Go implementations of them
+	//   are generated instead
+	// - Not an ELF mapping symbol ($a, $t, $d, ...), these are kept separately to tell ARM and Thumb code apart
+	// The useful symbols in the data sections (.data, .rodata, .bss, ...) are kept separately from the functions
 	usefulSymbolMap := make(map[string]assembler.Symbol)
+	dataSymbolMap := make(map[string]assembler.Symbol)
 	var usefulSymbolNames []string
+	var mappingSymbols []assembler.Symbol
 	for _, sym := range syms {
-		if !sym.Debugging && !sym.Warning && !sym.File && sym.Section != "*UND*" && sym.Section != "*ABS*" {
+		if sym.IsMappingSymbol() {
+			mappingSymbols = append(mappingSymbols, sym)
+			continue
+		}
+		if !sym.Debugging && !sym.Warning && !sym.File && sym.Section != "*UND*" && sym.Section != "*ABS*" && !assembler.IsPCThunk(sym.Name) {
+			if sym.IsData() {
+				dataSymbolMap[sym.Name] = sym
+				continue
+			}
 			usefulSymbolNames = append(usefulSymbolNames, sym.Name)
 			usefulSymbolMap[sym.Name] = sym
 		}
 	}
 
+	for _, warning := range sizeWarnings(usefulSymbolNames, usefulSymbolMap) {
+		fmt.Fprintln(os.Stderr, warning)
+	}
+
 	// fmt.Printf("useful symbols are : %#v\n", pretty.Formatter(usefulSymbolNames))
 
 	symsToInstructions, err := as.ProcessMachineCodeToInstructions(objectFile, usefulSymbolMap)
@@ -567,11 +868,83 @@ func main() {
 
 	// fmt.Printf("symbols + instructions: %#v\n", pretty.Formatter(symsToInstructions))
 
+	dataContents, err := as.ProcessDataSymbols(objectFile, dataSymbolMap)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	dataRelocations, err := as.ProcessDataRelocations(objectFile)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	dataSymbols := make([]assembler.DataSymbol, 0, len(dataContents))
+	for name, contents := range dataContents {
+		dataSymbols = append(dataSymbols, assembler.DataSymbol{Symbol: dataSymbolMap[name], Bytes: contents})
+	}
+	// keep the data in the order it's in the object file
+	sort.Slice(dataSymbols, func(i, j int) bool {
+		a, b := dataSymbols[i], dataSymbols[j]
+		if a.Section != b.Section {
+			return a.Section < b.Section
+		}
+		if a.ValueAddressField != b.ValueAddressField {
+			return a.ValueAddressField < b.ValueAddressField
+		}
+		return a.Name < b.Name
+	})
+
+	// Use the mapping symbols to find any Thumb code
+	for sym, instrs := range symsToInstructions {
+		assembler.ApplyMappingSymbols(instrs, usefulSymbolMap[sym].Section, mappingSymbols)
+	}
+
+	// The byte order of the object decides between the big and little endian variants of an architecture, as
+	// i.e. a mips assembler run with -EL assembles for mipsle
+	arch := as.Architecture()
+	for _, instrs := range symsToInstructions {
+		if len(instrs) != 0 {
+			arch = assembler.ArchForByteOrder(arch, instrs[0].BytesEndianness)
+			break
+		}
+	}
+
+	// Only translate into instructions that the oldest Go release the output is for accepts
+	if err := assembler.CheckGoVersion(arch, goVersion); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for _, instrs := range symsToInstructions {
+		assembler.RestrictToGoVersion(arch, instrs, goVersion)
+	}
+
 	// Now that we have a complete symbol -> instructions map we can begin generating go/plan9 assembly code for
 	// all of the functions
-	err = generatePlan9Assembly(*goFileOpt, *outputFile, as.Architecture(), symsToInstructions)
+	var verifier *goasm.Verifier
+	if *verifyOpt {
+		verifier, err = goasm.NewVerifier()
+		if err != nil {
+			fmt.Printf("error finding go toolchain for verification: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	err = generatePlan9Assembly(*goFileOpt, *outputFile, arch, symsToInstructions, dataSymbols, dataRelocations, syms, *undeclaredGlobalsOpt == "private", verifier, goVersion, *summaryOpt)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 }
+
+// sizeWarnings returns a warning for each of the symbols without a size, as the instructions of a function end at
+// it's size, a function without one (i.e. a label without a .size directive) is taken to go up to the next symbol,
+// which includes any data or padding after it
+func sizeWarnings(names []string, syms map[string]assembler.Symbol) []string {
+	var warnings []string
+	for _, name := range names {
+		if sym := syms[name]; sym.AlignmentSizeField == 0 {
+			warnings = append(warnings, fmt.Sprintf("warning: symbol %s : it has no size, so it's taken to go up to the next symbol in %s, add \".size %s, .-%s\" after it's last instruction",
+				name, sym.Section, name, name))
+		}
+	}
+	return warnings
+}
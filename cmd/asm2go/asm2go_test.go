@@ -1,13 +1,18 @@
 package main
 
 import (
+	"io/ioutil"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/anonymouse64/asm2go/assembler"
 	"github.com/anonymouse64/asm2go/assembler/gnu"
+	"github.com/anonymouse64/asm2go/assembler/goasm"
 )
 
 type assemblerTest struct {
@@ -15,6 +20,7 @@ type assemblerTest struct {
 	err  error
 	name string
 	file string
+	opts []string
 }
 
 func TestMakeAssembler(t *testing.T) {
@@ -35,6 +41,7 @@ func TestMakeAssembler(t *testing.T) {
 			nil,
 			"gas",
 			"",
+			nil,
 		},
 		{gnu.GnuAssembler{
 			AsExecutable:   gasExec,
@@ -45,9 +52,39 @@ func TestMakeAssembler(t *testing.T) {
 			nil,
 			"",
 			gasExec,
+			nil,
 		},
 	}
 
+	// the native amd64 assembler can also assemble for 386
+	if runtime.GOARCH == "amd64" {
+		tables = append(tables,
+			[]assemblerTest{
+				{gnu.GnuAssembler{
+					AsExecutable:   gasExec,
+					Arch:           "386",
+					BinToolsFolder: gasExecFolder,
+					Prefix:         "",
+				},
+					nil,
+					"gas",
+					"",
+					[]string{"--32"},
+				},
+				{gnu.GnuAssembler{
+					AsExecutable:   gasExec,
+					Arch:           "386",
+					BinToolsFolder: gasExecFolder,
+					Prefix:         "",
+				},
+					nil,
+					"",
+					gasExec,
+					[]string{"--32"},
+				},
+			}...)
+	}
+
 	armGas, err := exec.LookPath("arm-linux-gnueabihf-as")
 	if err != nil {
 		t.Logf("arm gnu as not available on the system, not testing")
@@ -65,6 +102,7 @@ func TestMakeAssembler(t *testing.T) {
 					nil,
 					"",
 					armGas,
+					nil,
 				},
 				{gnu.GnuAssembler{
 					AsExecutable:   armGas,
@@ -75,14 +113,15 @@ func TestMakeAssembler(t *testing.T) {
 					nil,
 					"arm-linux-gnueabihf-as",
 					"",
+					nil,
 				},
 			}...)
 	}
 
 	for _, table := range tables {
-		as, err := makeAssembler(table.name, table.file)
+		as, err := makeAssembler(table.name, table.file, table.opts)
 		if !compareAsGnuAssemblers(as, table.as) || err != table.err {
-			t.Errorf("Unable to make assembler of (name=%s, file=%s), got: (as=%#v, err=%v) want: (as=%#v, err=%v).", table.name, table.file, as, err, table.as, table.err)
+			t.Errorf("Unable to make assembler of (name=%s, file=%s, opts=%v), got: (as=%#v, err=%v) want: (as=%#v, err=%v).", table.name, table.file, table.opts, as, err, table.as, table.err)
 		}
 	}
 }
@@ -99,3 +138,179 @@ func compareAsGnuAssemblers(as assembler.Assembler, g assembler.Assembler) bool
 	// it's not a GnuAssembler, so return false
 	return false
 }
+
+func TestArchFromAssemblerName(t *testing.T) {
+	tables := []struct {
+		name string
+		arch string
+	}{
+		{"as", runtime.GOARCH},
+		{"arm-linux-gnueabihf-as", "arm"},
+		{"aarch64-linux-gnu-as", "arm64"},
+		{"i686-linux-gnu-as", "386"},
+		{"loongarch64-linux-gnu-as", "loong64"},
+		{"mips-linux-gnu-as", "mips"},
+		{"mipsel-linux-gnu-as", "mipsle"},
+		{"mips64-linux-gnuabi64-as", "mips64"},
+		{"mips64el-linux-gnuabi64-as", "mips64le"},
+		{"powerpc64-linux-gnu-as", "ppc64"},
+		{"powerpc64le-linux-gnu-as", "ppc64le"},
+		{"riscv64-linux-gnu-as", "riscv64"},
+		{"s390x-linux-gnu-as", "s390x"},
+	}
+
+	for _, table := range tables {
+		arch := archFromAssemblerName(table.name, runtime.GOARCH)
+		if arch != table.arch {
+			t.Errorf("Unable to determine architecture of (name=%s), got: (arch=%s) want: (arch=%s).", table.name, arch, table.arch)
+		}
+	}
+}
+
+func TestArchFromFileName(t *testing.T) {
+	tables := []struct {
+		file string
+		arch string
+	}{
+		{"keccak/keccak_arm64.s", "arm64"},
+		{"keccak_arm.s", "arm"},
+		{"add_mips64le.s", "mips64le"},
+		{"add_amd64.go", ""},
+		{"add.s", ""},
+	}
+
+	for _, table := range tables {
+		if arch := archFromFileName(table.file); arch != table.arch {
+			t.Errorf("Unable to determine architecture of (file=%s), got: (arch=%s) want: (arch=%s).", table.file, arch, table.arch)
+		}
+	}
+}
+
+func TestGoFunctions(t *testing.T) {
+	syms := map[string][]assembler.MachineInstruction{"f": nil, "helper": nil, "G": nil, "loop": nil}
+	decls := map[string]FunctionDeclaration{"f": {Name: "f"}}
+	objectSymbols := []assembler.Symbol{
+		{Name: "f", Section: ".text", Global: true, Function: true},
+		{Name: "helper", Section: ".text", Local: true, Function: true},
+		{Name: "G", Section: ".text", Global: true, Function: true},
+		{Name: "loop", Section: ".text", Local: true},
+		{Name: "memcpy", Section: "*UND*"},
+	}
+	tables := []struct {
+		name           string
+		privateGlobals bool
+		noLoop         bool
+		goNames        map[string]string
+		err            string
+	}{
+		{
+			name:           "private globals",
+			privateGlobals: true,
+			noLoop:         true,
+			goNames:        map[string]string{"f": "·f", "helper": "helper<>", "G": "G<>"},
+		},
+		{
+			name:   "undeclared global",
+			noLoop: true,
+			err:    "symbol G not found in go file declaration",
+		},
+		{
+			name:           "label",
+			privateGlobals: true,
+			err:            "symbol loop not found in go file declaration, and it isn't a function",
+		},
+	}
+
+	for _, table := range tables {
+		tableSyms := make(map[string][]assembler.MachineInstruction)
+		for name, instrs := range syms {
+			if name != "loop" || !table.noLoop {
+				tableSyms[name] = instrs
+			}
+		}
+		functions, err := goFunctions(tableSyms, decls, objectSymbols, table.privateGlobals)
+		switch {
+		case table.err != "":
+			if err == nil || !strings.Contains(err.Error(), table.err) {
+				t.Errorf("Unable to reject functions for %s, got: (err=%v) want: (err=%s).", table.name, err, table.err)
+			}
+			continue
+		case err != nil:
+			t.Errorf("Unable to get functions for %s : %v", table.name, err)
+			continue
+		}
+		goNames := make(map[string]string)
+		for _, f := range functions {
+			goNames[f.Name] = f.GoName
+		}
+		if !reflect.DeepEqual(goNames, table.goNames) {
+			t.Errorf("Unable to name functions for %s, got: %v want: %v.", table.name, goNames, table.goNames)
+		}
+	}
+}
+
+func TestModernizeAssembly(t *testing.T) {
+	verifier, err := goasm.NewVerifier()
+	if err != nil {
+		t.Skipf("go toolchain not available on the system, skipping : %v.", err)
+	}
+
+	src := "#include \"textflag.h\"\n\n" +
+		"// func F()\n" +
+		"TEXT ·F(SB), NOSPLIT, $0-0\n" +
+		"    WORD $0x6e391e60;  // eor v0.16b, v19.16b, v25.16b\n" +
+		"    WORD $0xd2a00020;  // mov x0, #0x10000\n" +
+		"    WORD $0xd65f03c0;  // ret\n"
+	want := "#include \"textflag.h\"\n\n" +
+		"// func F()\n" +
+		"TEXT ·F(SB), NOSPLIT, $0-0\n" +
+		"    VEOR V25.B16, V19.B16, V0.B16 // eor v0.16b, v19.16b, v25.16b\n" +
+		"    WORD $0xd2a00020;  // mov x0, #0x10000\n" +
+		"    WORD $0xd65f03c0;  // ret\n"
+	got, rewritten, err := modernizeAssembly(verifier, "arm64", []byte(src), assembler.LatestGoVersion)
+	if err != nil || string(got) != want || rewritten != 1 {
+		t.Errorf("Unable to modernize assembly, got: (err=%v, rewritten=%d,\noutput=%s\n) want: (err=nil, rewritten=1,\noutput=%s\n).", err, rewritten, got, want)
+	}
+
+	// the oldest Go release to build with doesn't have VEOR
+	got, rewritten, err = modernizeAssembly(verifier, "arm64", []byte(src), 10)
+	if err != nil || string(got) != src || rewritten != 0 {
+		t.Errorf("Unable to modernize assembly for Go 1.10, got: (err=%v, rewritten=%d,\noutput=%s\n) want: (err=nil, rewritten=0,\noutput=%s\n).", err, rewritten, got, src)
+	}
+}
+
+func TestSizeWarnings(t *testing.T) {
+	syms := map[string]assembler.Symbol{
+		"sized":  {Name: "sized", Section: ".text", Function: true, AlignmentSizeField: 0xc},
+		"nosize": {Name: "nosize", Section: ".text", Function: true},
+	}
+	got := sizeWarnings([]string{"sized", "nosize"}, syms)
+	want := []string{`warning: symbol nosize : it has no size, so it's taken to go up to the next symbol in .text, add ".size nosize, .-nosize" after it's last instruction`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unable to warn about symbols without a size, got: %q want: %q.", got, want)
+	}
+}
+
+func TestNosplitFunctions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asm2go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"cstrlen_amd64.s": "#include \"textflag.h\"\n\nTEXT ·cstrlen(SB), NOFRAME|NOSPLIT, $0-16\n\tRET\nTEXT ·grow(SB), $64-0\n\tRET\n",
+		"out_amd64.s":     "TEXT ·generated(SB), NOSPLIT, $0-0\n\tRET\n",
+	}
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the output file is about to be generated, so it's functions don't count
+	got, err := nosplitFunctions(dir, filepath.Join(dir, "out_amd64.s"))
+	want := map[string]bool{"·cstrlen": true}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Unable to find the NOSPLIT functions, got: (err=%v, functions=%v) want: (err=nil, functions=%v).", err, got, want)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anonymouse64/asm2go/assembler"
+	"github.com/anonymouse64/asm2go/assembler/goasm"
+)
+
+// archFromFileName returns the architecture from the "_GOARCH.s" suffix of the name of a Go assembly file, or
+// an empty string if it doesn't have one
+func archFromFileName(file string) string {
+	name := strings.TrimSuffix(filepath.Base(file), ".s")
+	for _, arch := range assembler.Architectures() {
+		if strings.HasSuffix(name, "_"+arch) {
+			return arch
+		}
+	}
+	return ""
+}
+
+// modernizeAssembly rewrites the data directives in the Go assembly for arch to Go mnemonics, wherever the Go
+// assembler encodes the translation into exactly the same bytes, and where the Go release with the minor version
+// goVersion accepts it
+// Every other line of the source is left as it is, and the number of rewritten lines is returned
+func modernizeAssembly(verifier *goasm.Verifier, arch string, src []byte, goVersion int) ([]byte, int, error) {
+	lines := strings.Split(string(src), "\n")
+	directiveLines, err := assembler.ParseDirectiveLines(arch, lines)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	instrs := make([]assembler.MachineInstruction, len(directiveLines))
+	for i, line := range directiveLines {
+		instrs[i] = line.Instruction
+	}
+	assembler.RestrictToGoVersion(arch, instrs, goVersion)
+	if err := verifier.VerifyTranslations(arch, instrs); err != nil {
+		return nil, 0, err
+	}
+
+	rewritten := 0
+	for i, line := range directiveLines {
+		if instrs[i].KeepBytes {
+			continue
+		}
+		// RET is expanded into the epilogue of the function by the Go assembler when it has a frame, which the
+		// verification doesn't see, so it stays as it is
+		if translation, ok := instrs[i].Translation(arch); ok && strings.Fields(translation)[0] != "RET" {
+			lines[line.Index] = line.Rewrite(translation)
+			rewritten++
+		}
+	}
+	return []byte(strings.Join(lines, "\n")), rewritten, nil
+}
+
+// modernizeMain implements "asm2go modernize", which upgrades existing Go assembly files
+func modernizeMain(args []string) {
+	flags := flag.NewFlagSet("modernize", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage of asm2go modernize: asm2go modernize [options] file.s\n")
+		flags.PrintDefaults()
+	}
+	archOpt := flags.String("arch", "", "architecture of the file (empty uses the _GOARCH.s suffix of the file name)")
+	goVersionOpt := flags.String("go", "", "oldest Go release the file has to build with, i.e. 1.21 (empty uses everything the newest release accepts)")
+	writeOpt := flags.Bool("w", false, "write the result back to the file instead of stdout")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	file := flags.Arg(0)
+
+	arch := *archOpt
+	if arch == "" {
+		arch = archFromFileName(file)
+		if arch == "" {
+			fmt.Printf("unable to tell the architecture of %s from it's name, use -arch\n", file)
+			os.Exit(1)
+		}
+	}
+	goVersion := assembler.LatestGoVersion
+	if *goVersionOpt != "" {
+		var err error
+		goVersion, err = assembler.ParseGoVersion(*goVersionOpt)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	// only translations the Go assembler encodes into the same bytes are used, so the go tool is always needed
+	verifier, err := goasm.NewVerifier()
+	if err != nil {
+		fmt.Printf("error finding go toolchain for verification: %v\n", err)
+		os.Exit(1)
+	}
+	modernized, rewritten, err := modernizeAssembly(verifier, arch, src, goVersion)
+	if err != nil {
+		fmt.Printf("error modernizing %s: %v\n", file, err)
+		os.Exit(1)
+	}
+
+	if !*writeOpt {
+		os.Stdout.Write(modernized)
+		return
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := ioutil.WriteFile(file, modernized, info.Mode()); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "%s: rewrote %d lines\n", file, rewritten)
+}